@@ -0,0 +1,433 @@
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RootEnv points at a directory of bindings laid out as described at
+// https://servicebinding.io: one directory per binding, with a file per
+// credential and the type and provider of the service in files of those
+// names.
+const RootEnv = "SERVICE_BINDING_ROOT"
+
+var ErrNotFound = errors.New("no matching service binding")
+
+// Binding is a service bound to the app, from VCAP_SERVICES or from
+// SERVICE_BINDING_ROOT.
+type Binding struct {
+	Name        string
+	Label       string
+	Provider    string
+	Tags        []string
+	Credentials Credentials
+	// Path is the directory a binding from SERVICE_BINDING_ROOT was read
+	// from. It is empty for VCAP_SERVICES.
+	Path string
+}
+
+type Bindings []Binding
+
+// Credentials hold the values of a binding. VCAP_SERVICES credentials can be
+// any JSON value; those read from files are strings.
+type Credentials map[string]interface{}
+
+// AmbiguousError is returned by One when more than one binding matches.
+type AmbiguousError struct {
+	Names []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("more than one matching service binding: %s", strings.Join(e.Names, ", "))
+}
+
+// Load reads VCAP_SERVICES and SERVICE_BINDING_ROOT. Either may be unset. The
+// bindings that could be read are returned along with the first error.
+func Load() (Bindings, error) {
+	var bindings Bindings
+	var errs []error
+
+	if vcapServices := os.Getenv("VCAP_SERVICES"); vcapServices != "" {
+		b, err := FromVCAPServices(vcapServices)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse VCAP_SERVICES: %w", err))
+		}
+		bindings = append(bindings, b...)
+	}
+
+	if root := os.Getenv(RootEnv); root != "" {
+		b, err := FromDirectory(root)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to read %s: %w", RootEnv, err))
+		}
+		bindings = append(bindings, b...)
+	}
+
+	if len(errs) > 0 {
+		return bindings, errs[0]
+	}
+	return bindings, nil
+}
+
+// FromVCAPServices parses the contents of VCAP_SERVICES. Services are
+// ordered by label, then as listed, so lookups do not depend on map order.
+func FromVCAPServices(vcapServices string) (Bindings, error) {
+	var services map[string][]struct {
+		Name        string                 `json:"name"`
+		Label       string                 `json:"label"`
+		Provider    *string                `json:"provider"`
+		Tags        []string               `json:"tags"`
+		Credentials map[string]interface{} `json:"credentials"`
+	}
+	if err := json.Unmarshal([]byte(vcapServices), &services); err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, 0, len(services))
+	for label := range services {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var bindings Bindings
+	for _, label := range labels {
+		for _, service := range services[label] {
+			b := Binding{
+				Name:        service.Name,
+				Label:       service.Label,
+				Tags:        service.Tags,
+				Credentials: service.Credentials,
+			}
+			if b.Label == "" {
+				b.Label = label
+			}
+			if service.Provider != nil {
+				b.Provider = *service.Provider
+			}
+			bindings = append(bindings, b)
+		}
+	}
+
+	return bindings, nil
+}
+
+// FromDirectory reads the bindings under root. Hidden files, such as the
+// ..data links of a Kubernetes volume, are skipped.
+func FromDirectory(root string) (Bindings, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings Bindings
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(root, entry.Name())
+		if info, err := os.Stat(dir); err != nil {
+			return bindings, err
+		} else if !info.IsDir() {
+			continue
+		}
+
+		b, err := fromBindingDir(dir)
+		if err != nil {
+			return bindings, err
+		}
+		bindings = append(bindings, b)
+	}
+
+	return bindings, nil
+}
+
+func fromBindingDir(dir string) (Binding, error) {
+	b := Binding{Name: filepath.Base(dir), Credentials: Credentials{}, Path: dir}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return Binding{}, err
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		if info, err := os.Stat(path); err != nil {
+			return Binding{}, err
+		} else if info.IsDir() {
+			continue
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return Binding{}, err
+		}
+		value := strings.TrimRight(string(contents), "\r\n")
+
+		switch file.Name() {
+		case "type":
+			b.Label = value
+		case "provider":
+			b.Provider = value
+		case "tags":
+			b.Tags = splitTags(value)
+		default:
+			b.Credentials[file.Name()] = value
+		}
+	}
+
+	return b, nil
+}
+
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// VCAPServices renders the bindings in the layout of VCAP_SERVICES, for
+// libraries that only read that.
+func (bs Bindings) VCAPServices() ([]byte, error) {
+	type service struct {
+		Name        string      `json:"name"`
+		Label       string      `json:"label"`
+		Provider    *string     `json:"provider"`
+		Tags        []string    `json:"tags"`
+		Credentials Credentials `json:"credentials"`
+	}
+
+	services := map[string][]service{}
+	for _, b := range bs {
+		s := service{Name: b.Name, Label: b.Label, Tags: b.Tags, Credentials: b.Credentials}
+		if b.Provider != "" {
+			provider := b.Provider
+			s.Provider = &provider
+		}
+		if s.Tags == nil {
+			s.Tags = []string{}
+		}
+		if s.Credentials == nil {
+			s.Credentials = Credentials{}
+		}
+		services[b.Label] = append(services[b.Label], s)
+	}
+
+	return json.Marshal(services)
+}
+
+// Query selects bindings. A binding matches when any of Label, Name and Tag
+// that are set match it, and it has every credential in Credentials.
+type Query struct {
+	Label       *regexp.Regexp
+	Name        *regexp.Regexp
+	Tag         *regexp.Regexp
+	Credentials []string
+}
+
+// Matching is a query for bindings whose label, name or one of whose tags
+// contains pattern, ignoring case.
+func Matching(pattern string) Query {
+	re := regexp.MustCompile("(?i)" + pattern)
+	return Query{Label: re, Name: re, Tag: re}
+}
+
+// Named is a query for bindings whose name contains pattern, ignoring case.
+func Named(pattern string) Query {
+	return Query{Name: regexp.MustCompile("(?i)" + pattern)}
+}
+
+// Tagged is a query for bindings with one of tags, ignoring case.
+func Tagged(tags ...string) Query {
+	quoted := make([]string, len(tags))
+	for i, tag := range tags {
+		quoted[i] = regexp.QuoteMeta(tag)
+	}
+	return Query{Tag: regexp.MustCompile("(?i)^(" + strings.Join(quoted, "|") + ")$")}
+}
+
+// WithCredentials narrows the query to bindings that have each of keys.
+func (q Query) WithCredentials(keys ...string) Query {
+	q.Credentials = append(append([]string{}, q.Credentials...), keys...)
+	return q
+}
+
+func (q Query) Matches(b Binding) bool {
+	for _, key := range q.Credentials {
+		if !b.Credentials.Has(key) {
+			return false
+		}
+	}
+
+	if q.Label != nil && q.Label.MatchString(b.Label) {
+		return true
+	}
+	if q.Name != nil && q.Name.MatchString(b.Name) {
+		return true
+	}
+	if q.Tag != nil {
+		for _, tag := range b.Tags {
+			if q.Tag.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Find returns every binding that matches q.
+func (bs Bindings) Find(q Query) Bindings {
+	var found Bindings
+	for _, b := range bs {
+		if q.Matches(b) {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// First returns the first binding that matches q.
+func (bs Bindings) First(q Query) (Binding, bool) {
+	for _, b := range bs {
+		if q.Matches(b) {
+			return b, true
+		}
+	}
+	return Binding{}, false
+}
+
+// One returns the binding that matches q. It returns ErrNotFound when none
+// match and an *AmbiguousError when several do.
+func (bs Bindings) One(q Query) (Binding, error) {
+	found := bs.Find(q)
+
+	switch len(found) {
+	case 0:
+		return Binding{}, ErrNotFound
+	case 1:
+		return found[0], nil
+	default:
+		names := make([]string, len(found))
+		for i, b := range found {
+			names[i] = b.Name
+		}
+		return Binding{}, &AmbiguousError{Names: names}
+	}
+}
+
+// String describes the binding for logs. Credential values are left out.
+func (b Binding) String() string {
+	details := []string{}
+	if b.Label != "" {
+		details = append(details, "label "+b.Label)
+	}
+	if len(b.Tags) > 0 {
+		details = append(details, "tags "+strings.Join(b.Tags, ", "))
+	}
+	if keys := b.Credentials.Keys(); len(keys) > 0 {
+		details = append(details, "credentials "+strings.Join(keys, ", "))
+	}
+
+	if len(details) == 0 {
+		return b.Name
+	}
+	return fmt.Sprintf("%s (%s)", b.Name, strings.Join(details, "; "))
+}
+
+// Redact replaces the binding's credential values in s, so that commands and
+// errors that may contain them can be logged.
+func (b Binding) Redact(s string) string {
+	var values []string
+	for _, key := range b.Credentials.Keys() {
+		// short values such as ports or flags are not secret, and replacing
+		// them would mangle the rest of the text
+		if value := b.Credentials.String(key); len(value) >= 6 {
+			values = append(values, value)
+		}
+	}
+
+	// longer values first, in case one contains another
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, value := range values {
+		s = strings.ReplaceAll(s, value, "[REDACTED]")
+	}
+	return s
+}
+
+func (c Credentials) Has(key string) bool {
+	value, ok := c[key]
+	return ok && value != nil && value != ""
+}
+
+// Keys returns the names of the credentials, sorted.
+func (c Credentials) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns a credential as a string, formatting numbers and booleans,
+// or "" when it is missing or is an object or array.
+func (c Credentials) String(key string) string {
+	switch value := c[key].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return ""
+	}
+}
+
+// Bool returns a credential that is true or "true".
+func (c Credentials) Bool(key string) bool {
+	value, err := strconv.ParseBool(c.String(key))
+	return err == nil && value
+}
+
+// Int returns a credential that is a number or a string of one.
+func (c Credentials) Int(key string) (int, error) {
+	if !c.Has(key) {
+		return 0, fmt.Errorf("credential %s is missing", key)
+	}
+
+	value, err := strconv.Atoi(c.String(key))
+	if err != nil {
+		return 0, fmt.Errorf("credential %s is not an integer", key)
+	}
+	return value, nil
+}
+
+// Map returns a credential that is an object, or a JSON object in a string,
+// as credentials read from files are.
+func (c Credentials) Map(key string) (map[string]interface{}, bool) {
+	switch value := c[key].(type) {
+	case map[string]interface{}:
+		return value, true
+	case string:
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &m); err == nil {
+			return m, true
+		}
+	}
+	return nil, false
+}
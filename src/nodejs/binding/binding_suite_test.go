@@ -0,0 +1,13 @@
+package binding_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBinding(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Binding Suite")
+}
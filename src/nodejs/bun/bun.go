@@ -0,0 +1,104 @@
+package bun
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Lockfiles are the text and binary lockfiles written by bun install.
+var Lockfiles = []string{"bun.lock", "bun.lockb"}
+
+type Command interface {
+	Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error
+	Run(cmd *exec.Cmd) error
+}
+
+type Bun struct {
+	Command Command
+	Log     *libbuildpack.Logger
+	Retry   retry.Policy
+}
+
+// IsBunApp reports whether an app uses Bun: it has a Bun lockfile, requests
+// a version in engines.bun, or names bun in its packageManager field.
+func IsBunApp(buildDir, engine, packageManager string) (bool, error) {
+	if engine != "" || strings.HasPrefix(packageManager, "bun@") {
+		return true, nil
+	}
+
+	lockfile, err := FindLockfile(buildDir)
+	return lockfile != "", err
+}
+
+// FindLockfile returns the name of the app's Bun lockfile, or "" when it
+// has none.
+func FindLockfile(buildDir string) (string, error) {
+	for _, name := range Lockfiles {
+		exists, err := libbuildpack.FileExists(filepath.Join(buildDir, name))
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// CacheDir is where bun keeps downloaded packages between stagings.
+func CacheDir(cacheDir string) string {
+	return filepath.Join(cacheDir, ".bun", "install", "cache")
+}
+
+func (b *Bun) Build(buildDir, cacheDir string) error {
+	lockfile, err := FindLockfile(buildDir)
+	if err != nil {
+		return err
+	}
+
+	installArgs := []string{"install"}
+	if lockfile != "" {
+		b.Log.Info("Installing node modules (%s)", lockfile)
+		installArgs = append(installArgs, "--frozen-lockfile")
+	} else {
+		b.Log.Info("Installing node modules (package.json)")
+		b.Log.Warning("No bun lockfile found, dependency versions may differ from the ones tested locally. Commit bun.lock to stage reproducibly.")
+	}
+
+	return b.Retry.Do(b.Log, "bun install", func(out io.Writer) error {
+		return b.Command.Run(b.command(buildDir, cacheDir, out, installArgs...))
+	})
+}
+
+func (b *Bun) Prune(buildDir, cacheDir string) error {
+	b.Log.Info("Pruning devDependencies")
+
+	installArgs := []string{"install", "--production", "--ignore-scripts"}
+	if lockfile, err := FindLockfile(buildDir); err != nil {
+		return err
+	} else if lockfile != "" {
+		installArgs = append(installArgs, "--frozen-lockfile")
+	}
+
+	return b.Command.Run(b.command(buildDir, cacheDir, b.Log.Output(), installArgs...))
+}
+
+func (b *Bun) command(buildDir, cacheDir string, out io.Writer, args ...string) *exec.Cmd {
+	cmd := exec.Command("bun", args...)
+	cmd.Dir = buildDir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"BUN_INSTALL_CACHE_DIR="+CacheDir(cacheDir),
+		"npm_config_nodedir="+os.Getenv("NODE_HOME"),
+	)
+	return cmd
+}
@@ -0,0 +1,170 @@
+package bun_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/bun"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate mockgen -source=bun.go --destination=mocks_test.go --package=bun_test
+
+var _ = Describe("Bun", func() {
+	var (
+		err         error
+		buildDir    string
+		cacheDir    string
+		b           *bun.Bun
+		logger      *libbuildpack.Logger
+		buffer      *bytes.Buffer
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDir, err = os.MkdirTemp("", "nodejs-buildpack.cache.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = new(bytes.Buffer)
+
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		b = &bun.Bun{
+			Log:     logger,
+			Command: mockCommand,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	Describe("IsBunApp", func() {
+		It("is false for an app without bun", func() {
+			Expect(bun.IsBunApp(buildDir, "", "yarn@1.22.22")).To(BeFalse())
+		})
+
+		It("is true when engines.bun is set", func() {
+			Expect(bun.IsBunApp(buildDir, "1.1.x", "")).To(BeTrue())
+		})
+
+		It("is true when the packageManager field names bun", func() {
+			Expect(bun.IsBunApp(buildDir, "", "bun@1.1.30")).To(BeTrue())
+		})
+
+		DescribeTable("is true when there is a bun lockfile",
+			func(lockfile string) {
+				Expect(os.WriteFile(filepath.Join(buildDir, lockfile), []byte{}, 0644)).To(Succeed())
+				Expect(bun.IsBunApp(buildDir, "", "")).To(BeTrue())
+			},
+			Entry("text lockfile", "bun.lock"),
+			Entry("binary lockfile", "bun.lockb"),
+		)
+	})
+
+	Describe("Build", func() {
+		var (
+			oldNodeHome string
+			installArgs []string
+			installEnv  []string
+		)
+
+		BeforeEach(func() {
+			oldNodeHome = os.Getenv("NODE_HOME")
+			Expect(os.Setenv("NODE_HOME", "test_node_home")).To(Succeed())
+
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) error {
+				Expect(cmd.Dir).To(Equal(buildDir))
+				installArgs = cmd.Args
+				installEnv = cmd.Env
+				return nil
+			})
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_HOME", oldNodeHome)).To(Succeed())
+		})
+
+		Context("the app has a bun lockfile", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "bun.lock"), []byte("{}"), 0644)).To(Succeed())
+			})
+
+			It("runs bun install with a frozen lockfile", func() {
+				Expect(b.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Installing node modules (bun.lock)"))
+				Expect(installArgs).To(Equal([]string{"bun", "install", "--frozen-lockfile"}))
+			})
+
+			It("keeps the bun cache in the cache dir", func() {
+				Expect(b.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(installEnv).To(ContainElement("BUN_INSTALL_CACHE_DIR=" + filepath.Join(cacheDir, ".bun", "install", "cache")))
+				Expect(installEnv).To(ContainElement("npm_config_nodedir=test_node_home"))
+			})
+		})
+
+		Context("the app has no bun lockfile", func() {
+			It("runs bun install and warns", func() {
+				Expect(b.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(installArgs).To(Equal([]string{"bun", "install"}))
+				Expect(buffer.String()).To(ContainSubstring("No bun lockfile found"))
+			})
+		})
+	})
+
+	Describe("Build with a flaky registry", func() {
+		It("retries bun install after a network error", func() {
+			sleeps := 0
+			b.Retry = retry.Policy{Retries: 2, Delay: time.Second, Sleep: func(time.Duration) { sleeps++ }}
+
+			installs := 0
+			mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+				installs++
+				if installs == 1 {
+					fmt.Fprintln(cmd.Stdout, "error: ECONNRESET downloading package manifest left-pad")
+					return errors.New("exit status 1")
+				}
+				return nil
+			}).Times(2)
+
+			Expect(b.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(sleeps).To(Equal(1))
+			Expect(buffer.String()).To(ContainSubstring("bun install failed with a network error, retrying in 1s (attempt 2 of 3)"))
+		})
+	})
+
+	Describe("Prune", func() {
+		It("reinstalls production dependencies only", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "bun.lockb"), []byte{}, 0644)).To(Succeed())
+
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) error {
+				Expect(cmd.Args).To(Equal([]string{"bun", "install", "--production", "--ignore-scripts", "--frozen-lockfile"}))
+				return nil
+			})
+
+			Expect(b.Prune(buildDir, cacheDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies"))
+		})
+	})
+})
@@ -0,0 +1,198 @@
+package changes
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack/checksum"
+)
+
+const (
+	// ModeStat compares the size, mode and modification time of every file.
+	ModeStat = "stat"
+	// ModeChecksum hashes the contents of files outside node_modules, for
+	// apps that vendor more dependencies than are worth reading twice.
+	ModeChecksum = "checksum"
+	// ModeFull hashes the contents of every file, node_modules included.
+	ModeFull = "full"
+	// ModeOff does not track changes.
+	ModeOff = "off"
+
+	// Env selects the mode. Changes are only logged with BP_DEBUG, so none
+	// are tracked without it.
+	Env = "NODE_CHANGE_TRACKING"
+
+	DefaultMode = ModeStat
+)
+
+// Mode returns the mode requested through NODE_CHANGE_TRACKING. An unknown
+// mode is reported alongside the default mode.
+func Mode() (string, error) {
+	switch mode := os.Getenv(Env); mode {
+	case "":
+		return DefaultMode, nil
+	case ModeStat, ModeChecksum, ModeFull, ModeOff:
+		return mode, nil
+	default:
+		return DefaultMode, fmt.Errorf("%s must be %q, %q, %q or %q, got %q", Env, ModeStat, ModeChecksum, ModeFull, ModeOff, mode)
+	}
+}
+
+type file struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sum     string
+}
+
+func (f file) same(g file) bool {
+	return f.size == g.size && f.mode == g.mode && f.modTime.Equal(g.modTime) && f.sum == g.sum
+}
+
+type snapshot map[string]file
+
+// Do runs exec and logs, through debug, a digest of dir before and after and
+// the files that exec added, changed or removed.
+func Do(dir, mode string, debug func(format string, args ...interface{}), exec func() error) error {
+	if os.Getenv("BP_DEBUG") == "" || mode == ModeOff {
+		return exec()
+	}
+
+	if mode == ModeFull {
+		return checksum.Do(dir, debug, exec)
+	}
+
+	before, err := take(dir, mode)
+	if err != nil {
+		debug("Unable to track changes to %s: %s", dir, err.Error())
+		return exec()
+	}
+	debug("Checksum Before (%s): %s", dir, before.digest())
+
+	if err := exec(); err != nil {
+		return err
+	}
+
+	after, err := take(dir, mode)
+	if err != nil {
+		debug("Unable to track changes to %s: %s", dir, err.Error())
+		return nil
+	}
+	debug("Checksum After (%s): %s", dir, after.digest())
+
+	if changed := diff(before, after); len(changed) > 0 {
+		debug("Below files changed:")
+		for _, path := range changed {
+			debug(path)
+		}
+	}
+
+	return nil
+}
+
+func take(dir, mode string) (snapshot, error) {
+	s := snapshot{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relpath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if relpath == ".cloudfoundry" || (mode == ModeChecksum && entry.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		f := file{size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+		if mode == ModeChecksum {
+			if f.sum, err = sum(path); err != nil {
+				return err
+			}
+		}
+
+		s[relpath] = f
+		return nil
+	})
+
+	return s, err
+}
+
+func sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// digest covers what a file holds rather than when it was written, so
+// rewriting a file with the same contents keeps the digest.
+func (s snapshot) digest() string {
+	h := md5.New()
+	for _, path := range s.paths() {
+		f := s[path]
+		fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00", path, f.size, f.mode, f.sum)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (s snapshot) paths() []string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func diff(before, after snapshot) []string {
+	var changed []string
+
+	for _, path := range after.paths() {
+		old, ok := before[path]
+		if !ok || !old.same(after[path]) {
+			changed = append(changed, display(path))
+		}
+	}
+
+	for _, path := range before.paths() {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, display(path)+" (removed)")
+		}
+	}
+
+	return changed
+}
+
+func display(path string) string {
+	return strings.Join([]string{".", path}, string(filepath.Separator))
+}
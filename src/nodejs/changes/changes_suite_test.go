@@ -0,0 +1,13 @@
+package changes_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Changes Suite")
+}
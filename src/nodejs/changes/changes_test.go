@@ -0,0 +1,190 @@
+package changes_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/changes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changes", func() {
+	var (
+		err      error
+		buildDir string
+		lines    []string
+		debug    func(format string, args ...interface{})
+	)
+
+	checksums := func() []string {
+		var sums []string
+		re := regexp.MustCompile(`^Checksum (Before|After) \(.*\): ([0-9a-f]+)$`)
+		for _, line := range lines {
+			if m := re.FindStringSubmatch(line); m != nil {
+				sums = append(sums, m[2])
+			}
+		}
+		return sums
+	}
+
+	writeFile := func(name, contents string) {
+		path := filepath.Join(buildDir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		// files written during the step must not share the mtime of the originals
+		past := time.Now().Add(-time.Hour)
+		Expect(os.Chtimes(path, past, past)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		lines = nil
+		debug = func(format string, args ...interface{}) {
+			lines = append(lines, fmt.Sprintf(format, args...))
+		}
+
+		os.Setenv("BP_DEBUG", "true")
+
+		writeFile("server.js", "console.log('hi')")
+		writeFile("lib/util.js", "module.exports = {}")
+		writeFile("node_modules/leftpad/index.js", "module.exports = pad")
+		writeFile(".cloudfoundry/0/bin/node", "node")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("BP_DEBUG")
+		os.Unsetenv(changes.Env)
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	Describe("Mode", func() {
+		It("defaults to stat", func() {
+			Expect(changes.Mode()).To(Equal(changes.ModeStat))
+		})
+
+		It("reads NODE_CHANGE_TRACKING", func() {
+			os.Setenv(changes.Env, "checksum")
+			Expect(changes.Mode()).To(Equal(changes.ModeChecksum))
+		})
+
+		It("falls back to the default for an unknown mode", func() {
+			os.Setenv(changes.Env, "mtime")
+			mode, err := changes.Mode()
+			Expect(err).To(MatchError(ContainSubstring(`got "mtime"`)))
+			Expect(mode).To(Equal(changes.ModeStat))
+		})
+	})
+
+	Describe("Do", func() {
+		It("returns the error from exec", func() {
+			Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error {
+				return fmt.Errorf("build failed")
+			})).To(MatchError("build failed"))
+		})
+
+		It("tracks nothing without BP_DEBUG", func() {
+			os.Unsetenv("BP_DEBUG")
+
+			ran := false
+			Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error {
+				ran = true
+				return nil
+			})).To(Succeed())
+			Expect(ran).To(BeTrue())
+			Expect(lines).To(BeEmpty())
+		})
+
+		It("tracks nothing when turned off", func() {
+			Expect(changes.Do(buildDir, changes.ModeOff, debug, func() error { return nil })).To(Succeed())
+			Expect(lines).To(BeEmpty())
+		})
+
+		Context("stat", func() {
+			It("keeps the digest when nothing changes", func() {
+				Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error { return nil })).To(Succeed())
+
+				sums := checksums()
+				Expect(sums).To(HaveLen(2))
+				Expect(sums[0]).To(Equal(sums[1]))
+				Expect(lines).NotTo(ContainElement("Below files changed:"))
+			})
+
+			It("does not fail when the directory cannot be read after exec", func() {
+				Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error {
+					return os.RemoveAll(buildDir)
+				})).To(Succeed())
+
+				Expect(checksums()).To(HaveLen(1))
+				Expect(lines).To(ContainElement(HavePrefix("Unable to track changes to " + buildDir)))
+			})
+
+			It("keeps the digest when a file is rewritten with the same contents", func() {
+				Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error {
+					return os.WriteFile(filepath.Join(buildDir, "server.js"), []byte("console.log('hi')"), 0644)
+				})).To(Succeed())
+
+				sums := checksums()
+				Expect(sums[0]).To(Equal(sums[1]))
+				Expect(lines).To(ContainElement("./server.js"))
+			})
+
+			It("lists added, changed and removed files outside .cloudfoundry", func() {
+				Expect(changes.Do(buildDir, changes.ModeStat, debug, func() error {
+					Expect(os.WriteFile(filepath.Join(buildDir, "lib/util.js"), []byte("module.exports = {a: 1}"), 0644)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(buildDir, "node_modules/leftpad/binding.node"), []byte("elf"), 0644)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(buildDir, ".cloudfoundry/0/bin/npm"), []byte("npm"), 0644)).To(Succeed())
+					return os.Remove(filepath.Join(buildDir, "server.js"))
+				})).To(Succeed())
+
+				sums := checksums()
+				Expect(sums[0]).NotTo(Equal(sums[1]))
+
+				changed := strings.Join(lines, "\n")
+				Expect(changed).To(ContainSubstring("Below files changed:\n./lib/util.js\n./node_modules/leftpad/binding.node\n./server.js (removed)"))
+				Expect(changed).NotTo(ContainSubstring(".cloudfoundry/"))
+			})
+		})
+
+		Context("checksum", func() {
+			It("ignores node_modules", func() {
+				Expect(changes.Do(buildDir, changes.ModeChecksum, debug, func() error {
+					return os.WriteFile(filepath.Join(buildDir, "node_modules/leftpad/index.js"), []byte("module.exports = padStart"), 0644)
+				})).To(Succeed())
+
+				sums := checksums()
+				Expect(sums[0]).To(Equal(sums[1]))
+				Expect(lines).NotTo(ContainElement("Below files changed:"))
+			})
+
+			It("changes the digest when contents change at the same size", func() {
+				Expect(changes.Do(buildDir, changes.ModeChecksum, debug, func() error {
+					return os.WriteFile(filepath.Join(buildDir, "server.js"), []byte("console.log('ho')"), 0644)
+				})).To(Succeed())
+
+				sums := checksums()
+				Expect(sums[0]).NotTo(Equal(sums[1]))
+				Expect(lines).To(ContainElement("./server.js"))
+			})
+		})
+
+		Context("full", func() {
+			It("hashes the whole directory", func() {
+				Expect(changes.Do(buildDir, changes.ModeFull, debug, func() error {
+					return os.WriteFile(filepath.Join(buildDir, "node_modules/leftpad/index.js"), []byte("module.exports = padStart"), 0644)
+				})).To(Succeed())
+
+				sums := checksums()
+				Expect(sums).To(HaveLen(2))
+				Expect(sums[0]).NotTo(Equal(sums[1]))
+			})
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package deno
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/jsonc"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const Lockfile = "deno.lock"
+
+// ConfigFiles are the names deno looks for, in order of precedence.
+var ConfigFiles = []string{"deno.json", "deno.jsonc"}
+
+type Command interface {
+	Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error
+	Run(cmd *exec.Cmd) error
+}
+
+type Deno struct {
+	Command Command
+	Log     *libbuildpack.Logger
+	Retry   retry.Policy
+}
+
+// Config is the part of deno.json the buildpack reads. Tasks are either a
+// command string or an object with a command, so they are kept raw.
+type Config struct {
+	Tasks map[string]json.RawMessage `json:"tasks"`
+}
+
+// IsDenoApp reports whether an app has a deno.json, deno.jsonc or
+// deno.lock.
+func IsDenoApp(buildDir string) (bool, error) {
+	for _, name := range append([]string{Lockfile}, ConfigFiles...) {
+		exists, err := libbuildpack.FileExists(filepath.Join(buildDir, name))
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+// LoadConfig reads deno.json or deno.jsonc. An app without either has an
+// empty config.
+func LoadConfig(buildDir string) (Config, error) {
+	var c Config
+
+	for _, name := range ConfigFiles {
+		contents, err := os.ReadFile(filepath.Join(buildDir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return Config{}, err
+		}
+
+		if err := json.Unmarshal(jsonc.Strip(contents), &c); err != nil {
+			return Config{}, err
+		}
+		return c, nil
+	}
+
+	return c, nil
+}
+
+// StartCommand returns the command that starts the app, or "" when
+// deno.json has no start task.
+func (c Config) StartCommand() string {
+	if _, ok := c.Tasks["start"]; ok {
+		return "deno task start"
+	}
+	return ""
+}
+
+// CacheDir is where DENO_DIR is kept between stagings.
+func CacheDir(cacheDir string) string {
+	return filepath.Join(cacheDir, ".deno")
+}
+
+// Build installs the app's dependencies into DENO_DIR, and into
+// node_modules for npm packages. With a deno.lock the install fails rather
+// than change the lockfile.
+func (d *Deno) Build(buildDir, cacheDir string) error {
+	lockfile, err := libbuildpack.FileExists(filepath.Join(buildDir, Lockfile))
+	if err != nil {
+		return err
+	}
+
+	installArgs := []string{"install"}
+	if lockfile {
+		d.Log.Info("Installing dependencies (%s)", Lockfile)
+		installArgs = append(installArgs, "--frozen")
+	} else {
+		d.Log.Info("Installing dependencies")
+		d.Log.Warning("No %s found, dependency versions may differ from the ones tested locally. Commit %s to stage reproducibly.", Lockfile, Lockfile)
+	}
+
+	return d.Retry.Do(d.Log, "deno install", func(out io.Writer) error {
+		cmd := exec.Command("deno", installArgs...)
+		cmd.Dir = buildDir
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = append(os.Environ(), "DENO_DIR="+CacheDir(cacheDir), "DENO_NO_UPDATE_CHECK=1")
+		return d.Command.Run(cmd)
+	})
+}
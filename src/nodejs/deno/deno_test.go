@@ -0,0 +1,160 @@
+package deno_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/deno"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate mockgen -source=deno.go --destination=mocks_test.go --package=deno_test
+
+var _ = Describe("Deno", func() {
+	var (
+		err         error
+		buildDir    string
+		cacheDir    string
+		d           *deno.Deno
+		buffer      *bytes.Buffer
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDir, err = os.MkdirTemp("", "nodejs-buildpack.cache.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = new(bytes.Buffer)
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		d = &deno.Deno{
+			Log:     libbuildpack.NewLogger(ansicleaner.New(buffer)),
+			Command: mockCommand,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	Describe("IsDenoApp", func() {
+		It("is false for a node app", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte("{}"), 0644)).To(Succeed())
+			Expect(deno.IsDenoApp(buildDir)).To(BeFalse())
+		})
+
+		DescribeTable("is true when the app has deno files",
+			func(name string) {
+				Expect(os.WriteFile(filepath.Join(buildDir, name), []byte("{}"), 0644)).To(Succeed())
+				Expect(deno.IsDenoApp(buildDir)).To(BeTrue())
+			},
+			Entry("deno.json", "deno.json"),
+			Entry("deno.jsonc", "deno.jsonc"),
+			Entry("deno.lock", "deno.lock"),
+		)
+	})
+
+	Describe("LoadConfig", func() {
+		It("returns an empty config when there is no deno.json", func() {
+			config, err := deno.LoadConfig(buildDir)
+			Expect(err).To(BeNil())
+			Expect(config.StartCommand()).To(Equal(""))
+		})
+
+		It("reads tasks from deno.jsonc", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.jsonc"), []byte(`{
+  // tasks run with deno task
+  "tasks": {
+    "start": {"command": "deno run -A main.ts", "description": "serve"},
+  },
+}`), 0644)).To(Succeed())
+
+			config, err := deno.LoadConfig(buildDir)
+			Expect(err).To(BeNil())
+			Expect(config.StartCommand()).To(Equal("deno task start"))
+		})
+
+		It("prefers deno.json over deno.jsonc", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte(`{"tasks": {"dev": "deno run --watch main.ts"}}`), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.jsonc"), []byte(`{"tasks": {"start": "deno run main.ts"}}`), 0644)).To(Succeed())
+
+			config, err := deno.LoadConfig(buildDir)
+			Expect(err).To(BeNil())
+			Expect(config.StartCommand()).To(Equal(""))
+		})
+
+		It("returns an error for malformed files", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte("{not json"), 0644)).To(Succeed())
+
+			_, err := deno.LoadConfig(buildDir)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Build", func() {
+		var installCmd *exec.Cmd
+
+		BeforeEach(func() {
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) error {
+				installCmd = cmd
+				return nil
+			})
+		})
+
+		It("installs against the lockfile with DENO_DIR in the cache dir", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.lock"), []byte("{}"), 0644)).To(Succeed())
+
+			Expect(d.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(installCmd.Args).To(Equal([]string{"deno", "install", "--frozen"}))
+			Expect(installCmd.Dir).To(Equal(buildDir))
+			Expect(installCmd.Env).To(ContainElement("DENO_DIR=" + filepath.Join(cacheDir, ".deno")))
+			Expect(buffer.String()).To(ContainSubstring("Installing dependencies (deno.lock)"))
+		})
+
+		It("warns when there is no lockfile", func() {
+			Expect(d.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(installCmd.Args).To(Equal([]string{"deno", "install"}))
+			Expect(buffer.String()).To(ContainSubstring("No deno.lock found"))
+		})
+	})
+
+	Describe("Build with a flaky registry", func() {
+		It("retries deno install after a network error", func() {
+			sleeps := 0
+			d.Retry = retry.Policy{Retries: 1, Delay: time.Second, Sleep: func(time.Duration) { sleeps++ }}
+
+			installs := 0
+			mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+				installs++
+				if installs == 1 {
+					fmt.Fprintln(cmd.Stdout, "error: error sending request for url (https://jsr.io/@std/http/meta.json): connection error: ECONNRESET")
+					return errors.New("exit status 1")
+				}
+				return nil
+			}).Times(2)
+
+			Expect(d.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(sleeps).To(Equal(1))
+		})
+	})
+})
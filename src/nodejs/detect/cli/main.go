@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/detect"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// detect prints the buildpack name and version on stdout, which the
+// platform records as the detected buildpack, and the signal that matched on
+// stderr.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: detect <build-dir>")
+		os.Exit(1)
+	}
+
+	result, err := detect.Detect(os.Args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to detect a node.js app: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if !result.Detected() {
+		fmt.Fprintf(os.Stderr, "node.js: %s\n", result)
+		os.Exit(1)
+	}
+
+	buildpackDir, err := libbuildpack.GetBuildpackDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to determine buildpack directory: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	version, err := detect.Version(buildpackDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read buildpack version: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "node.js: detected %s\n", result)
+	fmt.Printf("node.js %s\n", version)
+}
@@ -0,0 +1,97 @@
+package detect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/bun"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/deno"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Signal is a file whose presence means the app can be staged by this
+// buildpack.
+type Signal struct {
+	Name  string
+	Files []string
+}
+
+// Signals are checked in order, so the strongest evidence of a node app is
+// reported when several match.
+var Signals = []Signal{
+	{Name: "package.json", Files: []string{"package.json"}},
+	{Name: "Deno project", Files: append([]string{deno.Lockfile}, deno.ConfigFiles...)},
+	{Name: "Bun lockfile", Files: bun.Lockfiles},
+	{Name: "lockfile", Files: []string{"package-lock.json", "npm-shrinkwrap.json", "yarn.lock"}},
+	{Name: "monorepo root", Files: []string{"lerna.json", "nx.json", "turbo.json", "rush.json", "pnpm-workspace.yaml"}},
+	{Name: "server.js", Files: []string{"server.js"}},
+}
+
+// Result is the signal that matched, and the file that matched it.
+type Result struct {
+	Signal string
+	File   string
+}
+
+func (r Result) Detected() bool {
+	return r.Signal != ""
+}
+
+func (r Result) String() string {
+	if !r.Detected() {
+		return "no node.js app found"
+	}
+
+	if r.Signal == r.File {
+		return r.Signal
+	}
+	return fmt.Sprintf("%s (%s)", r.Signal, r.File)
+}
+
+// Detect returns the first of Signals found in buildDir. A package.json
+// that declares workspaces is reported as a monorepo root.
+func Detect(buildDir string) (Result, error) {
+	for _, signal := range Signals {
+		for _, file := range signal.Files {
+			exists, err := libbuildpack.FileExists(filepath.Join(buildDir, file))
+			if err != nil {
+				return Result{}, err
+			}
+			if !exists {
+				continue
+			}
+
+			if file == package_json.File {
+				return detectPackageJSON(buildDir)
+			}
+			return Result{Signal: signal.Name, File: file}, nil
+		}
+	}
+
+	return Result{}, nil
+}
+
+// Version returns the buildpack version that detect reports.
+func Version(buildpackDir string) (string, error) {
+	contents, err := os.ReadFile(filepath.Join(buildpackDir, "VERSION"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func detectPackageJSON(buildDir string) (Result, error) {
+	result := Result{Signal: "package.json", File: "package.json"}
+
+	// an invalid package.json is still a node app; supply reports the error
+	p, err := package_json.Load(filepath.Join(buildDir, package_json.File))
+	if err == nil && p.Workspaces.Defined() {
+		result.Signal = "monorepo root"
+	}
+
+	return result, nil
+}
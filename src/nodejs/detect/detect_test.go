@@ -0,0 +1,73 @@
+package detect_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/detect"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Detect", func() {
+	var buildDir string
+
+	BeforeEach(func() {
+		var err error
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	write := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(buildDir, name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(buildDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	It("does not detect an app without node files", func() {
+		write("app.py", "")
+		write("web/package.json", "{}")
+
+		result, err := detect.Detect(buildDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Detected()).To(BeFalse())
+		Expect(result.String()).To(Equal("no node.js app found"))
+	})
+
+	DescribeTable("reports the signal that matched",
+		func(files map[string]string, expected string) {
+			for name, contents := range files {
+				write(name, contents)
+			}
+
+			result, err := detect.Detect(buildDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Detected()).To(BeTrue())
+			Expect(result.String()).To(Equal(expected))
+		},
+		Entry("package.json", map[string]string{"package.json": `{"name": "app"}`}, "package.json"),
+		Entry("package.json with workspaces", map[string]string{"package.json": `{"workspaces": ["packages/*"]}`}, "monorepo root (package.json)"),
+		Entry("package.json with yarn workspaces", map[string]string{"package.json": `{"workspaces": {"packages": ["packages/*"]}}`}, "monorepo root (package.json)"),
+		Entry("unparseable package.json", map[string]string{"package.json": `{`}, "package.json"),
+		Entry("deno.json", map[string]string{"deno.json": "{}"}, "Deno project (deno.json)"),
+		Entry("deno.lock", map[string]string{"deno.lock": "{}"}, "Deno project (deno.lock)"),
+		Entry("bun lockfile", map[string]string{"bun.lockb": ""}, "Bun lockfile (bun.lockb)"),
+		Entry("npm lockfile", map[string]string{"package-lock.json": "{}"}, "lockfile (package-lock.json)"),
+		Entry("yarn lockfile", map[string]string{"yarn.lock": ""}, "lockfile (yarn.lock)"),
+		Entry("monorepo tooling", map[string]string{"turbo.json": "{}"}, "monorepo root (turbo.json)"),
+		Entry("server.js", map[string]string{"server.js": ""}, "server.js"),
+		Entry("package.json wins over server.js", map[string]string{"server.js": "", "package.json": "{}"}, "package.json"),
+		Entry("a lockfile wins over server.js", map[string]string{"server.js": "", "yarn.lock": ""}, "lockfile (yarn.lock)"),
+	)
+
+	Describe("Version", func() {
+		It("reads the VERSION file", func() {
+			write("VERSION", "1.9.4\n")
+			Expect(detect.Version(buildDir)).To(Equal("1.9.4"))
+		})
+	})
+})
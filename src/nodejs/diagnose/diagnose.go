@@ -0,0 +1,117 @@
+package diagnose
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule recognises a failure signature in npm, yarn or node-gyp output and
+// explains how to fix it.
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Explanation string
+	Fix         string
+}
+
+// Finding is a rule together with the first log line that matched it.
+type Finding struct {
+	Rule *Rule
+	Line string
+}
+
+var Rules = []Rule{
+	{
+		Name:        "Package not found (E404)",
+		Pattern:     regexp.MustCompile(`\bE404\b|404 Not Found|Request failed "404`),
+		Explanation: "A package could not be found in the registry. It may be misspelled, unpublished, private, or hosted on a registry this app is not configured to use.",
+		Fix:         "Check the package name, and configure the registry and auth token for scoped or private packages in .npmrc or .yarnrc.",
+	},
+	{
+		Name:        "No matching version (ETARGET)",
+		Pattern:     regexp.MustCompile(`\bETARGET\b|No matching version found for|Couldn't find any versions for`),
+		Explanation: "The registry has no version of a package that satisfies the requested range.",
+		Fix:         "Relax the version range in package.json, or regenerate the lockfile with an installable version.",
+	},
+	{
+		Name:        "Integrity check failed (EINTEGRITY)",
+		Pattern:     regexp.MustCompile(`\bEINTEGRITY\b|[Ii]ntegrity check failed|integrity checksum failed`),
+		Explanation: "A downloaded package does not match the checksum recorded in the lockfile.",
+		Fix:         "Regenerate the lockfile locally, and make sure it was created against the same registry the app stages with.",
+	},
+	{
+		Name:        "Registry unreachable (EAI_AGAIN)",
+		Pattern:     regexp.MustCompile(`\b(EAI_AGAIN|ENOTFOUND|ECONNREFUSED|ECONNRESET|ETIMEDOUT)\b|getaddrinfo`),
+		Explanation: "The package registry could not be reached from the staging container.",
+		Fix:         "Check DNS and proxy settings (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) and the registry URL, or vendor node_modules to stage without network access.",
+	},
+	{
+		Name:        "Out of disk space (ENOSPC)",
+		Pattern:     regexp.MustCompile(`\bENOSPC\b|[Nn]o space left on device`),
+		Explanation: "Staging ran out of disk space while installing dependencies.",
+		Fix:         "Increase the app's disk quota with cf push -k, or reduce the size of node_modules.",
+	},
+	{
+		Name:        "Native module build failed (node-gyp)",
+		Pattern:     regexp.MustCompile(`gyp ERR!`),
+		Explanation: "A dependency with a native addon failed to compile. The addon may not support this node version, or may need system libraries that the stack does not provide.",
+		Fix:         "Upgrade the dependency to a version that supports this node version or ships prebuilt binaries, or pin node to a version the addon supports.",
+	},
+	{
+		Name:        "Peer dependency conflict (ERESOLVE)",
+		Pattern:     regexp.MustCompile(`\bERESOLVE\b|[Cc]onflicting peer dependency|[Cc]ould not resolve dependency`),
+		Explanation: "npm 7 and later refuse to install a dependency tree with conflicting peer dependencies.",
+		Fix:         "Align the conflicting versions in package.json, or set NPM_CONFIG_LEGACY_PEER_DEPS=true to restore the npm 6 behaviour.",
+	},
+	{
+		Name:        "Out of memory",
+		Pattern:     regexp.MustCompile(`JavaScript heap out of memory|Allocation failed - |Reached heap limit`),
+		Explanation: "node ran out of heap memory while building.",
+		Fix:         "Increase the app's memory limit for staging, or raise the heap size with NODE_OPTIONS=--max-old-space-size=<megabytes>.",
+	},
+}
+
+// Scan returns a finding for every rule that matches a line of log, in the
+// order of rules.
+func Scan(log io.Reader, rules []Rule) ([]Finding, error) {
+	matches := make([]string, len(rules))
+	matched := make([]bool, len(rules))
+
+	scanner := bufio.NewScanner(log)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for i, rule := range rules {
+			if !matched[i] && rule.Pattern.MatchString(line) {
+				matched[i] = true
+				matches[i] = strings.TrimSpace(line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for i := range rules {
+		if matched[i] {
+			findings = append(findings, Finding{Rule: &rules[i], Line: matches[i]})
+		}
+	}
+
+	return findings, nil
+}
+
+// ScanFile is Scan over the contents of a file.
+func ScanFile(path string, rules []Rule) ([]Finding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Scan(f, rules)
+}
@@ -0,0 +1,84 @@
+package diagnose_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/diagnose"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diagnose", func() {
+	DescribeTable("recognises failure signatures",
+		func(line, rule string) {
+			findings, err := diagnose.Scan(strings.NewReader("added 12 packages\n"+line+"\n"), diagnose.Rules)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Rule.Name).To(Equal(rule))
+			Expect(findings[0].Line).To(Equal(strings.TrimSpace(line)))
+		},
+		Entry("npm E404", "npm ERR! code E404", "Package not found (E404)"),
+		Entry("npm 10 E404", "npm error code E404", "Package not found (E404)"),
+		Entry("yarn 404", `error An unexpected error occurred: "https://registry.yarnpkg.com/nope: Request failed \"404 Not Found\"".`, "Package not found (E404)"),
+		Entry("npm ETARGET", "npm ERR! code ETARGET", "No matching version (ETARGET)"),
+		Entry("npm no matching version", "npm ERR! notarget No matching version found for express@99.0.0.", "No matching version (ETARGET)"),
+		Entry("yarn no matching version", `error Couldn't find any versions for "express" that matches "99.0.0"`, "No matching version (ETARGET)"),
+		Entry("npm EINTEGRITY", "npm ERR! code EINTEGRITY", "Integrity check failed (EINTEGRITY)"),
+		Entry("yarn integrity", `error Integrity check failed for "left-pad" (computed integrity doesn't match our records, got "sha512-abc")`, "Integrity check failed (EINTEGRITY)"),
+		Entry("npm EAI_AGAIN", "npm ERR! request to https://registry.npmjs.org/express failed, reason: getaddrinfo EAI_AGAIN registry.npmjs.org", "Registry unreachable (EAI_AGAIN)"),
+		Entry("npm ENOTFOUND", "npm ERR! code ENOTFOUND", "Registry unreachable (EAI_AGAIN)"),
+		Entry("npm ENOSPC", "npm ERR! code ENOSPC", "Out of disk space (ENOSPC)"),
+		Entry("no space left", "error An unexpected error occurred: \"ENOSPC: no space left on device, write\".", "Out of disk space (ENOSPC)"),
+		Entry("node-gyp", "gyp ERR! build error", "Native module build failed (node-gyp)"),
+		Entry("npm ERESOLVE", "npm ERR! code ERESOLVE", "Peer dependency conflict (ERESOLVE)"),
+		Entry("conflicting peer", "npm ERR! Conflicting peer dependency: react@17.0.2", "Peer dependency conflict (ERESOLVE)"),
+		Entry("heap out of memory", "FATAL ERROR: Reached heap limit Allocation failed - JavaScript heap out of memory", "Out of memory"),
+	)
+
+	It("reports nothing for a clean log", func() {
+		findings, err := diagnose.Scan(strings.NewReader("added 120 packages in 3s\nnpm WARN deprecated uuid@3.4.0\n"), diagnose.Rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(BeEmpty())
+	})
+
+	It("reports each rule once, in rule order, with the first matching line", func() {
+		log := strings.Join([]string{
+			"gyp ERR! stack Error: `make` failed with exit code: 2",
+			"npm ERR! code E404",
+			"gyp ERR! not ok",
+		}, "\n")
+
+		findings, err := diagnose.Scan(strings.NewReader(log), diagnose.Rules)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].Rule.Name).To(Equal("Package not found (E404)"))
+		Expect(findings[1].Rule.Name).To(Equal("Native module build failed (node-gyp)"))
+		Expect(findings[1].Line).To(Equal("gyp ERR! stack Error: `make` failed with exit code: 2"))
+	})
+
+	It("gives every rule an explanation and a fix", func() {
+		for _, rule := range diagnose.Rules {
+			Expect(rule.Explanation).NotTo(BeEmpty(), rule.Name)
+			Expect(rule.Fix).NotTo(BeEmpty(), rule.Name)
+		}
+	})
+
+	Describe("ScanFile", func() {
+		It("scans the log file", func() {
+			dir, err := os.MkdirTemp("", "nodejs-buildpack.diagnose.")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "log")
+			Expect(os.WriteFile(path, []byte("npm ERR! code ETARGET\n"), 0644)).To(Succeed())
+
+			findings, err := diagnose.ScanFile(path, diagnose.Rules)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Rule.Name).To(Equal("No matching version (ETARGET)"))
+		})
+	})
+})
@@ -0,0 +1,375 @@
+package download
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const (
+	// ExtraCACertsEnv names a PEM bundle trusted in addition to the system
+	// roots, as it is by Node.js. SSL_CERT_FILE and SSL_CERT_DIR replace the
+	// system roots.
+	ExtraCACertsEnv = "NODE_EXTRA_CA_CERTS"
+
+	DefaultTimeout        = 5 * time.Minute
+	DefaultConnectTimeout = 30 * time.Second
+
+	cacheSubdir  = "downloads"
+	artifactFile = "artifact"
+	metaFile     = "meta.json"
+)
+
+var checksumPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Artifact is a file to download.
+type Artifact struct {
+	URL string
+	// SHA256 is the expected hex digest of the file, optionally prefixed
+	// with "sha256:". The download is not verified when it is empty.
+	SHA256 string
+}
+
+// Downloader fetches artifacts for hooks. Requests go through HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY, and are retried on network errors and server
+// errors.
+type Downloader struct {
+	Log    *libbuildpack.Logger
+	Client *http.Client
+	Retry  retry.Policy
+	// CacheDir keeps downloads between stages. Nothing is cached when it is
+	// empty.
+	CacheDir string
+}
+
+// ChecksumError is returned when a download does not match its SHA256.
+type ChecksumError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sha256 of %s is %s, expected %s", e.URL, e.Actual, e.Expected)
+}
+
+// StatusError is returned when the server does not respond with the file.
+type StatusError struct {
+	URL  string
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("downloading %s failed with HTTP status %d", e.URL, e.Code)
+}
+
+// New returns a downloader that caches in the cache directory of the stage.
+func New(log *libbuildpack.Logger, cacheDir string) (*Downloader, error) {
+	transport, err := NewTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Downloader{
+		Log:      log,
+		Client:   NewClient(transport),
+		Retry:    retry.Default(log),
+		CacheDir: cacheDir,
+	}, nil
+}
+
+// NewTransport returns a transport that uses the proxy from the environment,
+// gives up on unresponsive servers and trusts the certificates in
+// NODE_EXTRA_CA_CERTS.
+func NewTransport() (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   DefaultConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   DefaultConnectTimeout,
+		ResponseHeaderTimeout: DefaultConnectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	if path := os.Getenv(ExtraCACertsEnv); path != "" {
+		pool, err := certPool(path)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return transport, nil
+}
+
+// NewClient returns a client that gives up on a download after
+// DefaultTimeout.
+func NewClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   DefaultTimeout,
+	}
+}
+
+func certPool(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ExtraCACertsEnv, err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates found in %s", ExtraCACertsEnv, path)
+	}
+
+	return pool, nil
+}
+
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+type response struct {
+	notModified bool
+	meta        cacheMeta
+}
+
+// Fetch downloads the artifact to dest. A cached copy is used without a
+// request when it matches the artifact's SHA256, and is otherwise used when
+// the server reports that it has not changed.
+func (d *Downloader) Fetch(a Artifact, dest string) error {
+	expected, err := normalizeChecksum(a.SHA256)
+	if err != nil {
+		return err
+	}
+	display := redact(a.URL)
+
+	cacheDir := d.cacheDir(a.URL)
+	cached, hasCache := readMeta(cacheDir)
+	if hasCache && expected != "" {
+		if cached.SHA256 == expected {
+			d.Log.Info("Using cached %s", display)
+			return libbuildpack.CopyFile(filepath.Join(cacheDir, artifactFile), dest)
+		}
+		hasCache = false
+	}
+
+	tmpDir := filepath.Dir(dest)
+	if cacheDir != "" {
+		tmpDir = cacheDir
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var conditional *cacheMeta
+	if hasCache {
+		conditional = &cached
+	}
+
+	d.Log.Info("Downloading %s", display)
+	var resp response
+	err = d.Retry.Run(d.Log, "Downloading "+display, func() (bool, error) {
+		var err error
+		resp, err = d.get(a.URL, conditional, tmp)
+		return isTransient(err), err
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.notModified {
+		d.Log.Info("Using cached %s, it has not changed", display)
+		return libbuildpack.CopyFile(filepath.Join(cacheDir, artifactFile), dest)
+	}
+
+	if expected != "" && resp.meta.SHA256 != expected {
+		return &ChecksumError{URL: display, Expected: expected, Actual: resp.meta.SHA256}
+	}
+	if expected == "" {
+		d.Log.Info("Downloaded %s without verifying it, its sha256 is %s", display, resp.meta.SHA256)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if cacheDir == "" {
+		return os.Rename(tmp.Name(), dest)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(cacheDir, artifactFile)); err != nil {
+		return err
+	}
+	if err := writeMeta(cacheDir, resp.meta); err != nil {
+		return err
+	}
+	return libbuildpack.CopyFile(filepath.Join(cacheDir, artifactFile), dest)
+}
+
+func (d *Downloader) get(rawURL string, cached *cacheMeta, file *os.File) (response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return response{}, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redact(urlErr.URL)
+		}
+		return response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return response{notModified: true}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return response{}, &StatusError{URL: redact(rawURL), Code: resp.StatusCode}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return response{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return response{}, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), resp.Body); err != nil {
+		return response{}, err
+	}
+
+	return response{meta: cacheMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+	}}, nil
+}
+
+// isTransient reports whether a failed request is worth retrying. Servers
+// that are overloaded or failing are retried, as are connections that fail
+// or time out, but not certificates that are not trusted.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code >= 500 || status.Code == http.StatusTooManyRequests
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return false
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		os.IsTimeout(err) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+func (d *Downloader) cacheDir(rawURL string) string {
+	if d.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(d.CacheDir, cacheSubdir, hex.EncodeToString(sum[:]))
+}
+
+func readMeta(cacheDir string) (cacheMeta, bool) {
+	if cacheDir == "" {
+		return cacheMeta{}, false
+	}
+	if exists, err := libbuildpack.FileExists(filepath.Join(cacheDir, artifactFile)); err != nil || !exists {
+		return cacheMeta{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, metaFile))
+	if err != nil {
+		return cacheMeta{}, false
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return cacheMeta{}, false
+	}
+	return meta, true
+}
+
+func writeMeta(cacheDir string, meta cacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, metaFile), data, 0644)
+}
+
+func normalizeChecksum(checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	checksum = strings.TrimPrefix(checksum, "sha256:")
+	if checksum != "" && !checksumPattern.MatchString(checksum) {
+		return "", fmt.Errorf("%q is not a sha256 checksum", checksum)
+	}
+	return checksum, nil
+}
+
+// redact removes credentials and query parameters, which often hold tokens,
+// from URLs that are logged.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
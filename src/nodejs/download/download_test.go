@@ -0,0 +1,231 @@
+package download_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/download"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Downloader", func() {
+	const content = "agent tarball"
+
+	var (
+		buffer     *bytes.Buffer
+		logger     *libbuildpack.Logger
+		tmpDir     string
+		dest       string
+		sleeps     []time.Duration
+		requests   []*http.Request
+		statuses   []int
+		server     *httptest.Server
+		downloader *download.Downloader
+		checksum   string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "download")
+		Expect(err).NotTo(HaveOccurred())
+		dest = filepath.Join(tmpDir, "app", "agent.tgz")
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+		sleeps = nil
+		requests = nil
+		statuses = nil
+
+		sum := sha256.Sum256([]byte(content))
+		checksum = hex.EncodeToString(sum[:])
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			if len(statuses) > 0 {
+				status := statuses[0]
+				statuses = statuses[1:]
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+					return
+				}
+			}
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(content))
+		}))
+
+		downloader = &download.Downloader{
+			Log:    logger,
+			Client: download.NewClient(http.DefaultTransport),
+			Retry: retry.Policy{
+				Retries: 2,
+				Delay:   time.Second,
+				Sleep:   func(d time.Duration) { sleeps = append(sleeps, d) },
+			},
+			CacheDir: filepath.Join(tmpDir, "cache"),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	readDest := func() string {
+		data, err := os.ReadFile(dest)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("downloads the artifact to dest", func() {
+		Expect(downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz"}, dest)).To(Succeed())
+		Expect(readDest()).To(Equal(content))
+		Expect(buffer.String()).To(ContainSubstring("its sha256 is " + checksum))
+	})
+
+	It("downloads without a cache directory", func() {
+		downloader.CacheDir = ""
+		Expect(downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz"}, dest)).To(Succeed())
+		Expect(readDest()).To(Equal(content))
+	})
+
+	It("accepts an artifact that matches its checksum", func() {
+		Expect(downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz", SHA256: "sha256:" + checksum}, dest)).To(Succeed())
+		Expect(readDest()).To(Equal(content))
+	})
+
+	It("rejects an artifact that does not match its checksum", func() {
+		other := "0000000000000000000000000000000000000000000000000000000000000000"
+		err := downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz", SHA256: other}, dest)
+
+		var checksumErr *download.ChecksumError
+		Expect(errors.As(err, &checksumErr)).To(BeTrue())
+		Expect(checksumErr.Actual).To(Equal(checksum))
+		Expect(checksumErr.Expected).To(Equal(other))
+		Expect(dest).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects a checksum that is not a sha256", func() {
+		err := downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz", SHA256: "abc"}, dest)
+		Expect(err).To(MatchError(`"abc" is not a sha256 checksum`))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("retries server errors", func() {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		Expect(downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz"}, dest)).To(Succeed())
+		Expect(requests).To(HaveLen(3))
+		Expect(sleeps).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+		Expect(readDest()).To(Equal(content))
+	})
+
+	It("does not retry client errors", func() {
+		statuses = []int{http.StatusNotFound}
+		err := downloader.Fetch(download.Artifact{URL: server.URL + "/agent.tgz?token=secret"}, dest)
+
+		var statusErr *download.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(statusErr.Code).To(Equal(http.StatusNotFound))
+		Expect(err.Error()).NotTo(ContainSubstring("secret"))
+		Expect(requests).To(HaveLen(1))
+	})
+
+	It("retries connections that fail", func() {
+		url := server.URL + "/agent.tgz"
+		server.Close()
+
+		err := downloader.Fetch(download.Artifact{URL: url}, dest)
+		Expect(err).To(HaveOccurred())
+		Expect(sleeps).To(HaveLen(2))
+	})
+
+	Context("when the artifact is cached", func() {
+		It("uses the cached copy without a request when it matches the checksum", func() {
+			artifact := download.Artifact{URL: server.URL + "/agent.tgz", SHA256: checksum}
+			Expect(downloader.Fetch(artifact, dest)).To(Succeed())
+			Expect(os.Remove(dest)).To(Succeed())
+
+			Expect(downloader.Fetch(artifact, dest)).To(Succeed())
+			Expect(requests).To(HaveLen(1))
+			Expect(readDest()).To(Equal(content))
+			Expect(buffer.String()).To(ContainSubstring("Using cached " + server.URL + "/agent.tgz"))
+		})
+
+		It("uses the cached copy when the server reports it unchanged", func() {
+			artifact := download.Artifact{URL: server.URL + "/agent.tgz"}
+			Expect(downloader.Fetch(artifact, dest)).To(Succeed())
+			Expect(os.Remove(dest)).To(Succeed())
+
+			Expect(downloader.Fetch(artifact, dest)).To(Succeed())
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Header.Get("If-None-Match")).To(Equal(`"v1"`))
+			Expect(readDest()).To(Equal(content))
+			Expect(buffer.String()).To(ContainSubstring("it has not changed"))
+		})
+	})
+
+	Describe("NewTransport", func() {
+		var tlsServer *httptest.Server
+
+		BeforeEach(func() {
+			tlsServer = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(content))
+			}))
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+			Expect(os.Unsetenv(download.ExtraCACertsEnv)).To(Succeed())
+		})
+
+		It("does not trust unknown certificates or retry them", func() {
+			transport, err := download.NewTransport()
+			Expect(err).NotTo(HaveOccurred())
+			downloader.Client = download.NewClient(transport)
+
+			err = downloader.Fetch(download.Artifact{URL: tlsServer.URL + "/agent.tgz"}, dest)
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+			Expect(sleeps).To(BeEmpty())
+		})
+
+		It("trusts the certificates in NODE_EXTRA_CA_CERTS", func() {
+			bundle := filepath.Join(tmpDir, "ca.pem")
+			cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+			Expect(os.WriteFile(bundle, cert, 0644)).To(Succeed())
+			Expect(os.Setenv(download.ExtraCACertsEnv, bundle)).To(Succeed())
+
+			transport, err := download.NewTransport()
+			Expect(err).NotTo(HaveOccurred())
+			downloader.Client = download.NewClient(transport)
+
+			Expect(downloader.Fetch(download.Artifact{URL: tlsServer.URL + "/agent.tgz"}, dest)).To(Succeed())
+			Expect(readDest()).To(Equal(content))
+		})
+
+		It("fails when NODE_EXTRA_CA_CERTS has no certificates", func() {
+			bundle := filepath.Join(tmpDir, "ca.pem")
+			Expect(os.WriteFile(bundle, []byte("not a certificate"), 0644)).To(Succeed())
+			Expect(os.Setenv(download.ExtraCACertsEnv, bundle)).To(Succeed())
+
+			_, err := download.NewTransport()
+			Expect(err).To(MatchError(ContainSubstring("no certificates found in " + bundle)))
+		})
+	})
+})
@@ -7,16 +7,30 @@ import (
 
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/finalize"
 	_ "github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
+// Exit codes for failures outside of finalize.Run. Failures inside it exit
+// with exitFinalizeFailed, or with the code of their staging.Kind.
+const (
+	exitLogfile           = 8
+	exitBuildpackDir      = 9
+	exitManifest          = 10
+	exitEnvironment       = 11
+	exitFinalizeFailed    = 12
+	exitAfterCompile      = 13
+	exitLaunchEnvironment = 14
+	exitOverride          = 17
+)
+
 func main() {
 	logfile, err := os.CreateTemp("", "cloudfoundry.nodejs-buildpack.finalize")
 	if err != nil {
 		logger := libbuildpack.NewLogger(os.Stdout)
 		logger.Error("Unable to create log file: %s", err.Error())
-		os.Exit(8)
+		os.Exit(exitLogfile)
 	}
 	defer logfile.Close()
 
@@ -26,25 +40,25 @@ func main() {
 	buildpackDir, err := libbuildpack.GetBuildpackDir()
 	if err != nil {
 		logger.Error("Unable to determine buildpack directory: %s", err.Error())
-		os.Exit(9)
+		os.Exit(exitBuildpackDir)
 	}
 
 	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
 	if err != nil {
 		logger.Error("Unable to load buildpack manifest: %s", err.Error())
-		os.Exit(10)
+		os.Exit(exitManifest)
 	}
 
 	stager := libbuildpack.NewStager(os.Args[1:], logger, manifest)
 
 	if err = manifest.ApplyOverride(stager.DepsDir()); err != nil {
 		logger.Error("Unable to apply override.yml files: %s", err)
-		os.Exit(17)
+		os.Exit(exitOverride)
 	}
 
 	if err := stager.SetStagingEnvironment(); err != nil {
 		logger.Error("Unable to setup environment variables: %s", err.Error())
-		os.Exit(11)
+		os.Exit(exitEnvironment)
 	}
 
 	f := finalize.Finalizer{
@@ -55,17 +69,17 @@ func main() {
 	}
 
 	if err := finalize.Run(&f); err != nil {
-		os.Exit(12)
+		os.Exit(staging.ExitCode(err, exitFinalizeFailed))
 	}
 
 	if err := libbuildpack.RunAfterCompile(stager); err != nil {
 		logger.Error("After Compile: %s", err.Error())
-		os.Exit(13)
+		os.Exit(exitAfterCompile)
 	}
 
 	if err := stager.SetLaunchEnvironment(); err != nil {
 		logger.Error("Unable to setup launch environment: %s", err.Error())
-		os.Exit(14)
+		os.Exit(exitLaunchEnvironment)
 	}
 
 	stager.StagingComplete()
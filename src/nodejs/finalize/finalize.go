@@ -1,12 +1,27 @@
 package finalize
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/bun"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/deno"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/framework"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staticsite"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/timing"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/typescript"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
+const ReleaseYml = "tmp/nodejs-buildpack-release-step.yml"
+
 type Manifest interface {
 	RootDir() string
 }
@@ -18,24 +33,77 @@ type Stager interface {
 }
 
 type Finalizer struct {
-	Stager      Stager
-	Log         *libbuildpack.Logger
-	Logfile     *os.File
-	Manifest    Manifest
-	StartScript string
+	Stager       Stager
+	Log          *libbuildpack.Logger
+	Logfile      *os.File
+	Manifest     Manifest
+	StartScript  string
+	Main         string
+	IsTypeScript bool
+	UseBun       bool
+	UseDeno      bool
+	Framework    *framework.Framework
+	StartCommand string
+	Timer        *timing.Timer
 }
 
 func Run(f *Finalizer) error {
-	if err := f.ReadPackageJSON(); err != nil {
+	if f.Timer == nil {
+		f.Timer = timing.New("finalize", f.Log)
+	}
+
+	err := run(f)
+	staging.LogHint(f.Log, err)
+	f.Timer.PrintSummary()
+
+	if reportErr := f.WriteReport(); reportErr != nil {
+		f.Log.Warning("Unable to write staging report: %s", reportErr.Error())
+	}
+
+	return err
+}
+
+func run(f *Finalizer) error {
+	if err := f.Timer.Time("Read package.json", f.ReadPackageJSON); err != nil {
 		f.Log.Error("Failed parsing package.json: %s", err.Error())
+		return staging.Wrap(staging.Configuration, err)
+	}
+
+	if err := f.Timer.Time("Static site start command", f.SetStaticSiteStartCommand); err != nil {
+		f.Log.Error("Unable to configure static site: %s", err.Error())
+		return staging.Wrap(staging.Configuration, err)
+	}
+
+	if err := f.Timer.Time("Framework start command", f.SetFrameworkStartCommand); err != nil {
+		f.Log.Error("Unable to determine %s start command: %s", f.Framework.Name, err.Error())
 		return err
 	}
 
-	if err := f.CopyProfileScripts(); err != nil {
-		f.Log.Error("Unable to copy profile.d scripts: %s", err.Error())
+	if err := f.Timer.Time("TypeScript start command", f.SetTypeScriptStartCommand); err != nil {
+		f.Log.Error("Unable to determine TypeScript start command: %s", err.Error())
 		return err
 	}
 
+	if err := f.Timer.Time("Bun start command", f.SetBunStartCommand); err != nil {
+		f.Log.Error("Unable to determine Bun start command: %s", err.Error())
+		return err
+	}
+
+	if err := f.Timer.Time("Deno start command", f.SetDenoStartCommand); err != nil {
+		f.Log.Error("Unable to determine Deno start command: %s", err.Error())
+		return staging.Wrap(staging.Configuration, err)
+	}
+
+	if err := f.Timer.Time("Write release information", f.WriteReleaseYml); err != nil {
+		f.Log.Error("Unable to write release information: %s", err.Error())
+		return staging.Wrap(staging.Unknown, err)
+	}
+
+	if err := f.Timer.Time("Copy profile.d scripts", f.CopyProfileScripts); err != nil {
+		f.Log.Error("Unable to copy profile.d scripts: %s", err.Error())
+		return staging.Wrap(staging.Unknown, err)
+	}
+
 	if err := f.WarnNoStart(); err != nil {
 		f.Log.Error(err.Error())
 		return err
@@ -50,26 +118,245 @@ func Run(f *Finalizer) error {
 }
 
 func (f *Finalizer) ReadPackageJSON() error {
-	var p struct {
-		Scripts struct {
-			StartScript string `json:"start"`
-		} `json:"scripts"`
+	var err error
+	if f.UseDeno, err = deno.IsDenoApp(f.Stager.BuildDir()); err != nil {
+		return err
 	}
 
-	if err := libbuildpack.NewJSON().Load(filepath.Join(f.Stager.BuildDir(), "package.json"), &p); err != nil {
-		if os.IsNotExist(err) {
+	p, err := package_json.Load(filepath.Join(f.Stager.BuildDir(), package_json.File))
+	if os.IsNotExist(err) {
+		if !f.UseDeno {
 			f.Log.Warning("No package.json found")
-			return nil
 		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	f.StartScript = p.Scripts["start"]
+	f.Main = p.Main
+	f.Framework = framework.Detect(p.Dependencies, p.DevDependencies)
+
+	if f.IsTypeScript, err = typescript.IsTypeScriptApp(f.Stager.BuildDir(), p.DevDependencies); err != nil {
+		return err
+	}
+
+	if f.UseBun, err = bun.IsBunApp(f.Stager.BuildDir(), p.Engines.Bun, p.PackageManager); err != nil {
+		return err
+	}
+	f.UseDeno = f.UseDeno && !f.UseBun
+
+	return nil
+}
+
+func (f *Finalizer) SetStaticSiteStartCommand() error {
+	mode, err := staticsite.Mode()
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case staticsite.ModeStaticfile:
+		f.Log.Warning("%s=%s expects the staticfile buildpack to run after this buildpack", staticsite.ModeEnv, mode)
+		return nil
+	case staticsite.ModeServe:
+	default:
+		return nil
+	}
+
+	outputDir, err := staticsite.OutputDir(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+
+	// the directory may come from NODE_STATIC_DIR, so it is quoted for the shell
+	root := profiled.Literal(outputDir)
+	if err := root.Err(); err != nil {
+		return err
+	}
+
+	serverDir := filepath.Join(f.Stager.DepDir(), "static")
+	if err := os.MkdirAll(serverDir, 0755); err != nil {
+		return err
+	}
+
+	if err := libbuildpack.CopyFile(filepath.Join(f.Manifest.RootDir(), staticsite.ServerScript), filepath.Join(serverDir, "server.js")); err != nil {
+		return err
+	}
+
+	f.Log.Info("Serving static site from %s", outputDir)
+	f.StartCommand = fmt.Sprintf("node %s %s", filepath.Join("$DEPS_DIR", f.Stager.DepsIdx(), "static", "server.js"), root)
+
+	return nil
+}
+
+func (f *Finalizer) SetFrameworkStartCommand() error {
+	if f.Framework == nil || f.StartCommand != "" {
+		return nil
+	}
+
+	standalone, err := framework.IsNextStandalone(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+
+	// next start refuses to serve standalone output, so it is replaced too
+	replaceStart := f.Framework.Name == "Next.js" && standalone && strings.HasPrefix(f.StartScript, "next start")
+	if f.StartScript != "" && !replaceStart {
+		return nil
+	}
+
+	command, err := f.Framework.Start(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
 
+	if command == "" {
+		f.Log.Warning("Could not find the %s build output, add a start script to package.json", f.Framework.Name)
+		return nil
+	}
+
+	f.Log.Info("Starting %s app: %s", f.Framework.Name, command)
+	f.StartCommand = command
+
+	return nil
+}
+
+func (f *Finalizer) SetTypeScriptStartCommand() error {
+	if !f.IsTypeScript || f.StartCommand != "" {
+		return nil
+	}
+
+	if f.StartScript != "" && !strings.Contains(f.StartScript, "ts-node") {
+		return nil
+	}
+
+	config, err := typescript.LoadConfig(f.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+
+	entryPoint, err := config.EntryPoint(f.Stager.BuildDir(), f.Main)
+	if err != nil {
+		return err
+	}
+
+	if entryPoint == "" {
+		f.Log.Warning("Could not find the compiled entry point in %s, set \"main\" in package.json to the emitted file", typescript.ConfigFile)
+		return nil
+	}
+
+	f.Log.Info("Starting compiled TypeScript output: %s", entryPoint)
+	f.StartCommand = fmt.Sprintf("node --enable-source-maps %s", entryPoint)
+
+	return nil
+}
+
+// SetBunStartCommand starts Bun apps with bun rather than npm when nothing
+// more specific has set the start command.
+func (f *Finalizer) SetBunStartCommand() error {
+	if !f.UseBun || f.StartCommand != "" {
+		return nil
+	}
+
+	serverJsExists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), "server.js"))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case f.StartScript != "":
+		f.StartCommand = "bun run start"
+	case f.Main != "":
+		f.StartCommand = fmt.Sprintf("bun %s", f.Main)
+	case serverJsExists:
+		f.StartCommand = "bun server.js"
+	default:
+		return nil
+	}
+
+	f.Log.Info("Starting Bun app: %s", f.StartCommand)
+
+	return nil
+}
+
+// SetDenoStartCommand starts Deno apps with the start task from deno.json,
+// or from package.json, which deno task also runs.
+func (f *Finalizer) SetDenoStartCommand() error {
+	if !f.UseDeno || f.StartCommand != "" {
+		return nil
+	}
+
+	config, err := deno.LoadConfig(f.Stager.BuildDir())
+	if err != nil {
 		return err
 	}
 
-	f.StartScript = p.Scripts.StartScript
+	command := config.StartCommand()
+	if command == "" && f.StartScript != "" {
+		command = "deno task start"
+	}
+
+	if command == "" {
+		f.Log.Warning("Add a start task to deno.json to tell the buildpack how to start this Deno app")
+		return nil
+	}
+
+	f.Log.Info("Starting Deno app: %s", command)
+	f.StartCommand = command
 
 	return nil
 }
 
+func (f *Finalizer) WriteReleaseYml() error {
+	if f.StartCommand == "" {
+		return nil
+	}
+
+	command := f.StartCommand
+	if os.Getenv("OPTIMIZE_MEMORY") == "true" {
+		command = `NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--max_old_space_size=$(( $MEMORY_AVAILABLE * 75 / 100 ))" ` + command
+	}
+
+	release := map[string]map[string]string{
+		"default_process_types": {"web": command},
+	}
+
+	return libbuildpack.NewYAML().Write(filepath.Join(f.Stager.BuildDir(), ReleaseYml), release)
+}
+
+// WriteReport adds the start command and any warnings to the staging
+// report that supply wrote to the dep dir.
+func (f *Finalizer) WriteReport() error {
+	r, err := report.Load(f.Stager.DepDir())
+	if err != nil {
+		return err
+	}
+
+	r.StartCommand = f.StartCommand
+	if r.StartCommand == "" && f.StartScript != "" {
+		r.StartCommand = "npm start"
+	}
+
+	if err := f.Logfile.Sync(); err != nil {
+		return err
+	}
+
+	if err := r.AddWarnings(f.Logfile.Name()); err != nil {
+		return err
+	}
+
+	if f.Timer != nil {
+		r.Phases = append(r.Phases, f.Timer.Phases...)
+	}
+
+	if err := r.Write(f.Stager.DepDir()); err != nil {
+		return err
+	}
+
+	return r.PrintMarker(f.Log, "finalize")
+}
+
 func (f *Finalizer) CopyProfileScripts() error {
 	profiledDir := filepath.Join(f.Stager.DepDir(), "profile.d")
 	if err := os.MkdirAll(profiledDir, 0755); err != nil {
@@ -105,7 +392,7 @@ func (f *Finalizer) WarnNoStart() error {
 		return err
 	}
 
-	if !procfileExists && !serverJsExists && f.StartScript == "" {
+	if !procfileExists && !serverJsExists && f.StartScript == "" && f.StartCommand == "" {
 		warning := "This app may not specify any way to start a node process\n"
 		warning += "See: https://docs.cloudfoundry.org/buildpacks/node/node-tips.html#start"
 		f.Log.Warning(warning)
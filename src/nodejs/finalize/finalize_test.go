@@ -3,9 +3,15 @@ package finalize_test
 import (
 	"bytes"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/finalize"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/framework"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/timing"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/ansicleaner"
@@ -66,6 +72,80 @@ var _ = Describe("Finalize", func() {
 		Expect(err).To(BeNil())
 	})
 
+	Describe("Run", func() {
+		It("classifies an unparseable package.json as a configuration failure", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte("{"), 0644)).To(Succeed())
+
+			err = finalize.Run(finalizer)
+			Expect(err).To(HaveOccurred())
+			Expect(staging.KindOf(err)).To(Equal(staging.Configuration))
+			Expect(staging.ExitCode(err, 12)).To(Equal(staging.ExitConfiguration))
+			Expect(buffer.String()).To(ContainSubstring("Staging failed (configuration error, exit code 20)"))
+			Expect(buffer.String()).To(ContainSubstring("PRO TIP: Check package.json"))
+		})
+	})
+
+	Describe("WriteReport", func() {
+		var logfile *os.File
+
+		BeforeEach(func() {
+			logfile, err = os.CreateTemp("", "nodejs-buildpack.log")
+			Expect(err).To(BeNil())
+			finalizer.Logfile = logfile
+
+			supplied := report.Report{PackageManager: "npm", Warnings: []string{"Gulp may not be tracked in package.json"}}
+			Expect(supplied.Write(filepath.Join(depsDir, depsIdx))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(logfile.Close()).To(Succeed())
+			Expect(os.Remove(logfile.Name())).To(Succeed())
+		})
+
+		It("adds the start command and finalize warnings to the supply report", func() {
+			finalizer.StartCommand = "node --enable-source-maps dist/index.js"
+			libbuildpack.NewLogger(logfile).Warning("This app may not specify any way to start a node process")
+
+			Expect(finalizer.WriteReport()).To(Succeed())
+
+			r, err := report.Load(filepath.Join(depsDir, depsIdx))
+			Expect(err).To(BeNil())
+			Expect(r.PackageManager).To(Equal("npm"))
+			Expect(r.StartCommand).To(Equal("node --enable-source-maps dist/index.js"))
+			Expect(r.Warnings).To(Equal([]string{
+				"Gulp may not be tracked in package.json",
+				"This app may not specify any way to start a node process",
+			}))
+		})
+
+		It("reports npm start when package.json has a start script", func() {
+			finalizer.StartScript = "node server.js"
+
+			Expect(finalizer.WriteReport()).To(Succeed())
+
+			r, err := report.Load(filepath.Join(depsDir, depsIdx))
+			Expect(err).To(BeNil())
+			Expect(r.StartCommand).To(Equal("npm start"))
+		})
+
+		It("appends the finalize step timings to those from supply", func() {
+			supplied := report.Report{Phases: []report.Phase{{Stage: "supply", Name: "Install node", DurationSeconds: 2}}}
+			Expect(supplied.Write(filepath.Join(depsDir, depsIdx))).To(Succeed())
+
+			finalizer.Timer = &timing.Timer{Stage: "finalize"}
+			Expect(finalizer.Timer.Time("Read package.json", func() error { return nil })).To(Succeed())
+
+			Expect(finalizer.WriteReport()).To(Succeed())
+
+			r, err := report.Load(filepath.Join(depsDir, depsIdx))
+			Expect(err).To(BeNil())
+			Expect(r.Phases).To(HaveLen(2))
+			Expect(r.Phases[0].Name).To(Equal("Install node"))
+			Expect(r.Phases[1].Stage).To(Equal("finalize"))
+			Expect(r.Phases[1].Name).To(Equal("Read package.json"))
+		})
+	})
+
 	Describe("ReadPackageJSON", func() {
 		Context("package.json has start script", func() {
 			BeforeEach(func() {
@@ -86,6 +166,328 @@ var _ = Describe("Finalize", func() {
 				Expect(finalizer.StartScript).To(Equal("start-my-app"))
 			})
 		})
+
+		Context("package.json describes a TypeScript app", func() {
+			BeforeEach(func() {
+				packageJSON := `
+{
+  "main": "src/index.ts",
+  "devDependencies": {
+		"typescript": "^5.4.0"
+	}
+}
+`
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(packageJSON), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte("{}"), 0644)).To(Succeed())
+			})
+
+			It("sets Main and IsTypeScript", func() {
+				Expect(finalizer.ReadPackageJSON()).To(Succeed())
+				Expect(finalizer.Main).To(Equal("src/index.ts"))
+				Expect(finalizer.IsTypeScript).To(BeTrue())
+			})
+		})
+
+		Context("the app has a bun lockfile", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"main": "index.ts"}`), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildDir, "bun.lock"), []byte("{}"), 0644)).To(Succeed())
+			})
+
+			It("sets UseBun", func() {
+				Expect(finalizer.ReadPackageJSON()).To(Succeed())
+				Expect(finalizer.UseBun).To(BeTrue())
+			})
+		})
+
+		Context("the app is a Deno app without package.json", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte("{}"), 0644)).To(Succeed())
+			})
+
+			It("sets UseDeno without warning about package.json", func() {
+				Expect(finalizer.ReadPackageJSON()).To(Succeed())
+				Expect(finalizer.UseDeno).To(BeTrue())
+				Expect(buffer.String()).NotTo(ContainSubstring("No package.json found"))
+			})
+		})
+	})
+
+	Describe("SetStaticSiteStartCommand", func() {
+		var (
+			oldStaticMode string
+			buildpackDir  string
+		)
+
+		BeforeEach(func() {
+			oldStaticMode = os.Getenv("NODE_STATIC_MODE")
+			Expect(os.Unsetenv("NODE_STATIC_MODE")).To(Succeed())
+
+			buildpackDir, err = os.MkdirTemp("", "nodejs-buildpack.buildpack.")
+			Expect(err).To(BeNil())
+			Expect(os.MkdirAll(filepath.Join(buildpackDir, "static"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildpackDir, "static", "server.js"), []byte("server"), 0644)).To(Succeed())
+
+			Expect(os.MkdirAll(filepath.Join(buildDir, "dist"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildDir, "dist", "index.html"), []byte(""), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", oldStaticMode)).To(Succeed())
+			Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+		})
+
+		It("does nothing when no static mode is set", func() {
+			Expect(finalizer.SetStaticSiteStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+		})
+
+		It("serves the output with the bundled static server", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "serve")).To(Succeed())
+			mockManifest.EXPECT().RootDir().Return(buildpackDir)
+
+			Expect(finalizer.SetStaticSiteStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node $DEPS_DIR/9/static/server.js 'dist'"))
+			Expect(os.ReadFile(filepath.Join(depsDir, depsIdx, "static", "server.js"))).To(Equal([]byte("server")))
+		})
+
+		It("quotes an output directory from NODE_STATIC_DIR", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "serve")).To(Succeed())
+			Expect(os.Setenv("NODE_STATIC_DIR", "my site;$(id)")).To(Succeed())
+			defer os.Unsetenv("NODE_STATIC_DIR")
+			Expect(os.MkdirAll(filepath.Join(buildDir, "my site;$(id)"), 0755)).To(Succeed())
+			mockManifest.EXPECT().RootDir().Return(buildpackDir)
+
+			Expect(finalizer.SetStaticSiteStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node $DEPS_DIR/9/static/server.js 'my site;$(id)'"))
+		})
+
+		It("overrides the start script and the framework", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "serve")).To(Succeed())
+			mockManifest.EXPECT().RootDir().Return(buildpackDir)
+			finalizer.StartScript = "react-scripts start"
+			finalizer.Framework = framework.Detect(map[string]string{"next": "14.2.3"}, nil)
+
+			Expect(finalizer.SetStaticSiteStartCommand()).To(Succeed())
+			Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node $DEPS_DIR/9/static/server.js 'dist'"))
+		})
+
+		It("leaves serving to the staticfile buildpack", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "staticfile")).To(Succeed())
+			Expect(finalizer.SetStaticSiteStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+			Expect(buffer.String()).To(ContainSubstring("expects the staticfile buildpack to run after this buildpack"))
+		})
+	})
+
+	Describe("SetFrameworkStartCommand", func() {
+		BeforeEach(func() {
+			finalizer.Framework = framework.Detect(map[string]string{"next": "14.2.3"}, nil)
+			Expect(os.MkdirAll(filepath.Join(buildDir, ".next"), 0755)).To(Succeed())
+		})
+
+		It("starts the framework when there is no start script", func() {
+			Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("next start --hostname 0.0.0.0 --port $PORT"))
+			Expect(buffer.String()).To(ContainSubstring("Starting Next.js app"))
+		})
+
+		It("keeps the start script", func() {
+			finalizer.StartScript = "next start"
+			Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+		})
+
+		Context("standalone output exists", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(buildDir, ".next", "standalone"), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildDir, ".next", "standalone", "server.js"), []byte(""), 0644)).To(Succeed())
+			})
+
+			It("replaces a next start script with the standalone server", func() {
+				finalizer.StartScript = "next start"
+				Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+				Expect(finalizer.StartCommand).To(Equal("HOSTNAME=0.0.0.0 node .next/standalone/server.js"))
+			})
+		})
+
+		It("warns when the build output is missing", func() {
+			finalizer.Framework = framework.Detect(map[string]string{"nuxt": "^3.11.0"}, nil)
+			Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+			Expect(buffer.String()).To(ContainSubstring("Could not find the Nuxt build output"))
+		})
+
+		It("takes precedence over the TypeScript start command", func() {
+			finalizer.IsTypeScript = true
+			Expect(finalizer.SetFrameworkStartCommand()).To(Succeed())
+			Expect(finalizer.SetTypeScriptStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("next start --hostname 0.0.0.0 --port $PORT"))
+		})
+	})
+
+	Describe("SetTypeScriptStartCommand", func() {
+		BeforeEach(func() {
+			finalizer.IsTypeScript = true
+			Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte(`{
+	// compiled output
+	"compilerOptions": {"rootDir": "src", "outDir": "dist",},
+}`), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(buildDir, "dist"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildDir, "dist", "app.js"), []byte(""), 0644)).To(Succeed())
+			finalizer.Main = "src/app.ts"
+		})
+
+		It("starts the emitted entry point with source maps enabled", func() {
+			Expect(finalizer.SetTypeScriptStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node --enable-source-maps dist/app.js"))
+		})
+
+		It("replaces a ts-node start script", func() {
+			finalizer.StartScript = "ts-node src/app.ts"
+			Expect(finalizer.SetTypeScriptStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node --enable-source-maps dist/app.js"))
+		})
+
+		It("keeps any other start script", func() {
+			finalizer.StartScript = "node dist/app.js --cluster"
+			Expect(finalizer.SetTypeScriptStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+		})
+
+		It("warns when no compiled entry point exists", func() {
+			Expect(os.RemoveAll(filepath.Join(buildDir, "dist"))).To(Succeed())
+			Expect(finalizer.SetTypeScriptStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+			Expect(buffer.String()).To(ContainSubstring("Could not find the compiled entry point"))
+		})
+	})
+
+	Describe("SetBunStartCommand", func() {
+		BeforeEach(func() {
+			finalizer.UseBun = true
+		})
+
+		It("runs the start script with bun", func() {
+			finalizer.StartScript = "bun src/index.ts"
+			Expect(finalizer.SetBunStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("bun run start"))
+			Expect(buffer.String()).To(ContainSubstring("Starting Bun app: bun run start"))
+		})
+
+		It("runs main with bun when there is no start script", func() {
+			finalizer.Main = "src/index.ts"
+			Expect(finalizer.SetBunStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("bun src/index.ts"))
+		})
+
+		It("runs server.js with bun as a last resort", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "server.js"), []byte(""), 0644)).To(Succeed())
+			Expect(finalizer.SetBunStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("bun server.js"))
+		})
+
+		It("keeps a start command that is already set", func() {
+			finalizer.StartScript = "next start"
+			finalizer.StartCommand = "node .next/standalone/server.js"
+			Expect(finalizer.SetBunStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("node .next/standalone/server.js"))
+		})
+
+		It("does nothing for apps that do not use bun", func() {
+			finalizer.UseBun = false
+			finalizer.StartScript = "node server.js"
+			Expect(finalizer.SetBunStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+		})
+	})
+
+	Describe("SetDenoStartCommand", func() {
+		BeforeEach(func() {
+			finalizer.UseDeno = true
+		})
+
+		It("runs the start task from deno.json", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte(`{"tasks": {"start": "deno run --allow-net main.ts"}}`), 0644)).To(Succeed())
+			Expect(finalizer.SetDenoStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("deno task start"))
+			Expect(buffer.String()).To(ContainSubstring("Starting Deno app: deno task start"))
+		})
+
+		It("runs the start script from package.json", func() {
+			finalizer.StartScript = "deno run main.ts"
+			Expect(finalizer.SetDenoStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal("deno task start"))
+		})
+
+		It("warns when there is no start task", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte(`{"tasks": {"dev": "deno run --watch main.ts"}}`), 0644)).To(Succeed())
+			Expect(finalizer.SetDenoStartCommand()).To(Succeed())
+			Expect(finalizer.StartCommand).To(Equal(""))
+			Expect(buffer.String()).To(ContainSubstring("Add a start task to deno.json"))
+		})
+
+		It("returns an error for a malformed deno.json", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte("{"), 0644)).To(Succeed())
+			Expect(finalizer.SetDenoStartCommand()).NotTo(Succeed())
+		})
+	})
+
+	Describe("WriteReleaseYml", func() {
+		var oldOptimizeMemory string
+
+		BeforeEach(func() {
+			oldOptimizeMemory = os.Getenv("OPTIMIZE_MEMORY")
+			Expect(os.Unsetenv("OPTIMIZE_MEMORY")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("OPTIMIZE_MEMORY", oldOptimizeMemory)).To(Succeed())
+		})
+
+		It("does not write a release file without a start command", func() {
+			Expect(finalizer.WriteReleaseYml()).To(Succeed())
+			Expect(filepath.Join(buildDir, finalize.ReleaseYml)).NotTo(BeAnExistingFile())
+		})
+
+		It("writes the start command as the web process", func() {
+			finalizer.StartCommand = "node --enable-source-maps dist/app.js"
+			Expect(finalizer.WriteReleaseYml()).To(Succeed())
+
+			var release map[string]map[string]string
+			Expect(libbuildpack.NewYAML().Load(filepath.Join(buildDir, finalize.ReleaseYml), &release)).To(Succeed())
+			Expect(release["default_process_types"]["web"]).To(Equal("node --enable-source-maps dist/app.js"))
+		})
+
+		It("limits the heap when OPTIMIZE_MEMORY is set", func() {
+			Expect(os.Setenv("OPTIMIZE_MEMORY", "true")).To(Succeed())
+			finalizer.StartCommand = "node dist/app.js"
+			Expect(finalizer.WriteReleaseYml()).To(Succeed())
+
+			var release map[string]map[string]string
+			Expect(libbuildpack.NewYAML().Load(filepath.Join(buildDir, finalize.ReleaseYml), &release)).To(Succeed())
+			Expect(release["default_process_types"]["web"]).To(Equal(`NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--max_old_space_size=$(( $MEMORY_AVAILABLE * 75 / 100 ))" node dist/app.js`))
+		})
+
+		It("keeps the preloads that agent hooks add to NODE_OPTIONS", func() {
+			script := &profiled.Script{}
+			script.Append("NODE_OPTIONS", profiled.Concat(profiled.Literal("--require "), profiled.EnvPath("DEPS_DIR", depsIdx, "opentelemetry", "register.js")))
+			Expect(profiled.Write(filepath.Join(depsDir, depsIdx), "opentelemetry.sh", script)).To(Succeed())
+
+			Expect(os.Setenv("OPTIMIZE_MEMORY", "true")).To(Succeed())
+			finalizer.StartCommand = "printenv NODE_OPTIONS"
+			Expect(finalizer.WriteReleaseYml()).To(Succeed())
+
+			var release map[string]map[string]string
+			Expect(libbuildpack.NewYAML().Load(filepath.Join(buildDir, finalize.ReleaseYml), &release)).To(Succeed())
+
+			launch := exec.Command("bash", "-c", ". "+filepath.Join(depsDir, depsIdx, "profile.d", "opentelemetry.sh")+" && "+release["default_process_types"]["web"])
+			launch.Env = append(os.Environ(), "DEPS_DIR=/home/vcap/deps", "MEMORY_AVAILABLE=1024")
+			output, err := launch.CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(output))
+			Expect(string(output)).To(Equal("--require /home/vcap/deps/" + depsIdx + "/opentelemetry/register.js --max_old_space_size=768\n"))
+		})
 	})
 
 	Describe("CopyProfileScripts", func() {
@@ -135,6 +537,17 @@ var _ = Describe("Finalize", func() {
 			})
 		})
 
+		Context("a start command was determined", func() {
+			BeforeEach(func() {
+				finalizer.StartCommand = "node dist/index.js"
+			})
+
+			It("Doesn't log a warning", func() {
+				Expect(finalizer.WarnNoStart()).To(Succeed())
+				Expect(buffer.String()).To(Equal(""))
+			})
+		})
+
 		Context("server.js exists", func() {
 			BeforeEach(func() {
 				Expect(os.WriteFile(filepath.Join(buildDir, "server.js"), []byte("xxx"), 0644)).To(Succeed())
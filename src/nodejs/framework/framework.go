@@ -0,0 +1,149 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Framework struct {
+	Name string
+	// Packages lists the dependencies that identify the framework.
+	Packages []string
+	// Build is the command run when package.json has no build script.
+	Build []string
+	// CacheDirs are build caches, relative to the build dir, that are kept in
+	// the cache dir between stages instead of being shipped in the droplet.
+	CacheDirs []string
+	// AfterBuild prepares the build output for launch.
+	AfterBuild func(buildDir string) error
+	// Start returns the start command for the build output, or an empty
+	// string when the output cannot be found.
+	Start func(buildDir string) (string, error)
+}
+
+var Frameworks = []Framework{
+	{
+		Name:       "Next.js",
+		Packages:   []string{"next"},
+		Build:      []string{"next", "build"},
+		CacheDirs:  []string{".next/cache"},
+		AfterBuild: prepareNextStandalone,
+		Start: func(buildDir string) (string, error) {
+			if standalone, err := IsNextStandalone(buildDir); err != nil {
+				return "", err
+			} else if standalone {
+				return "HOSTNAME=0.0.0.0 node .next/standalone/server.js", nil
+			}
+
+			return startFirstExisting(buildDir,
+				launch{".next", "next start --hostname 0.0.0.0 --port $PORT"},
+			)
+		},
+	},
+	{
+		Name:     "Nuxt",
+		Packages: []string{"nuxt", "nuxt3"},
+		Build:    []string{"nuxt", "build"},
+		Start: func(buildDir string) (string, error) {
+			return startFirstExisting(buildDir,
+				launch{".output/server/index.mjs", "HOST=0.0.0.0 node .output/server/index.mjs"},
+			)
+		},
+	},
+	{
+		Name:      "Remix",
+		Packages:  []string{"@remix-run/node", "@remix-run/serve", "@remix-run/dev"},
+		Build:     []string{"remix", "build"},
+		CacheDirs: []string{".cache"},
+		Start: func(buildDir string) (string, error) {
+			return startFirstExisting(buildDir,
+				launch{"build/server/index.js", "HOST=0.0.0.0 remix-serve build/server/index.js"},
+				launch{"build/index.js", "HOST=0.0.0.0 remix-serve build/index.js"},
+			)
+		},
+	},
+	{
+		Name:     "NestJS",
+		Packages: []string{"@nestjs/core"},
+		Build:    []string{"nest", "build"},
+		Start: func(buildDir string) (string, error) {
+			return startFirstExisting(buildDir,
+				launch{"dist/main.js", "node --enable-source-maps dist/main.js"},
+				launch{"dist/src/main.js", "node --enable-source-maps dist/src/main.js"},
+			)
+		},
+	},
+}
+
+// Detect returns the first known framework the app depends on, or nil.
+func Detect(dependencies, devDependencies map[string]string) *Framework {
+	for i, framework := range Frameworks {
+		for _, pkg := range framework.Packages {
+			_, inDependencies := dependencies[pkg]
+			_, inDevDependencies := devDependencies[pkg]
+			if inDependencies || inDevDependencies {
+				return &Frameworks[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsNextStandalone reports whether next build emitted standalone output,
+// which happens when next.config sets output: 'standalone'.
+func IsNextStandalone(buildDir string) (bool, error) {
+	return libbuildpack.FileExists(filepath.Join(buildDir, ".next", "standalone", "server.js"))
+}
+
+// prepareNextStandalone copies the assets that next build leaves out of the
+// standalone directory, as described in the Next.js deployment docs.
+func prepareNextStandalone(buildDir string) error {
+	if standalone, err := IsNextStandalone(buildDir); err != nil || !standalone {
+		return err
+	}
+
+	standaloneDir := filepath.Join(buildDir, ".next", "standalone")
+	assets := map[string]string{
+		filepath.Join(buildDir, ".next", "static"): filepath.Join(standaloneDir, ".next", "static"),
+		filepath.Join(buildDir, "public"):          filepath.Join(standaloneDir, "public"),
+	}
+
+	for src, dest := range assets {
+		if exists, err := libbuildpack.FileExists(src); err != nil {
+			return err
+		} else if !exists {
+			continue
+		}
+
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+
+		if err := libbuildpack.CopyDirectory(src, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// launch pairs a build output with the command that starts it.
+type launch struct {
+	output  string
+	command string
+}
+
+func startFirstExisting(buildDir string, launches ...launch) (string, error) {
+	for _, l := range launches {
+		if exists, err := libbuildpack.FileExists(filepath.Join(buildDir, filepath.FromSlash(l.output))); err != nil {
+			return "", err
+		} else if exists {
+			return l.command, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,111 @@
+package framework_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/framework"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Framework", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeFile := func(name string) {
+		Expect(os.MkdirAll(filepath.Join(buildDir, filepath.Dir(name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(buildDir, name), []byte(name), 0644)).To(Succeed())
+	}
+
+	Describe("Detect", func() {
+		It("detects frameworks from dependencies", func() {
+			Expect(framework.Detect(map[string]string{"next": "14.2.0", "react": "18.0.0"}, nil).Name).To(Equal("Next.js"))
+			Expect(framework.Detect(map[string]string{"nuxt": "^3.11.0"}, nil).Name).To(Equal("Nuxt"))
+			Expect(framework.Detect(map[string]string{"@remix-run/node": "^2.9.0"}, nil).Name).To(Equal("Remix"))
+			Expect(framework.Detect(map[string]string{"@nestjs/core": "^10.0.0"}, nil).Name).To(Equal("NestJS"))
+		})
+
+		It("detects frameworks from devDependencies", func() {
+			Expect(framework.Detect(nil, map[string]string{"@remix-run/dev": "^2.9.0"}).Name).To(Equal("Remix"))
+		})
+
+		It("returns nil for apps without a known framework", func() {
+			Expect(framework.Detect(map[string]string{"express": "^4.19.0"}, map[string]string{"jest": "^29.0.0"})).To(BeNil())
+		})
+	})
+
+	Describe("Next.js", func() {
+		var next *framework.Framework
+
+		BeforeEach(func() {
+			next = framework.Detect(map[string]string{"next": "14.2.0"}, nil)
+		})
+
+		It("caches .next/cache", func() {
+			Expect(next.CacheDirs).To(Equal([]string{".next/cache"}))
+		})
+
+		It("starts next on all interfaces", func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, ".next"), 0755)).To(Succeed())
+			Expect(next.Start(buildDir)).To(Equal("next start --hostname 0.0.0.0 --port $PORT"))
+		})
+
+		Context("with standalone output", func() {
+			BeforeEach(func() {
+				writeFile(".next/standalone/server.js")
+				writeFile(".next/static/chunks/main.js")
+				writeFile("public/favicon.ico")
+			})
+
+			It("copies static assets into the standalone directory", func() {
+				Expect(next.AfterBuild(buildDir)).To(Succeed())
+				Expect(filepath.Join(buildDir, ".next", "standalone", ".next", "static", "chunks", "main.js")).To(BeARegularFile())
+				Expect(filepath.Join(buildDir, ".next", "standalone", "public", "favicon.ico")).To(BeARegularFile())
+			})
+
+			It("starts the standalone server bound to all interfaces", func() {
+				Expect(next.Start(buildDir)).To(Equal("HOSTNAME=0.0.0.0 node .next/standalone/server.js"))
+			})
+		})
+
+		It("does nothing after build without standalone output", func() {
+			Expect(next.AfterBuild(buildDir)).To(Succeed())
+			Expect(filepath.Join(buildDir, ".next", "standalone")).NotTo(BeADirectory())
+		})
+	})
+
+	Describe("Start", func() {
+		It("starts the Nuxt server output", func() {
+			writeFile(".output/server/index.mjs")
+			Expect(framework.Detect(map[string]string{"nuxt": "^3.11.0"}, nil).Start(buildDir)).To(Equal("HOST=0.0.0.0 node .output/server/index.mjs"))
+		})
+
+		It("prefers the Remix v2 server build", func() {
+			writeFile("build/server/index.js")
+			writeFile("build/index.js")
+			Expect(framework.Detect(map[string]string{"@remix-run/serve": "^2.9.0"}, nil).Start(buildDir)).To(Equal("HOST=0.0.0.0 remix-serve build/server/index.js"))
+		})
+
+		It("starts the compiled NestJS app", func() {
+			writeFile("dist/main.js")
+			Expect(framework.Detect(map[string]string{"@nestjs/core": "^10.0.0"}, nil).Start(buildDir)).To(Equal("node --enable-source-maps dist/main.js"))
+		})
+
+		It("returns an empty command when nothing was built", func() {
+			Expect(framework.Detect(map[string]string{"@nestjs/core": "^10.0.0"}, nil).Start(buildDir)).To(Equal(""))
+		})
+	})
+})
@@ -0,0 +1,167 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// nodeAgent is an npm package that is installed into the dep dir and
+// loaded with NODE_OPTIONS --require, so the app's code is left alone.
+type nodeAgent struct {
+	// Package is the npm package, and Require the module of it to preload.
+	Package string
+	Require string
+	// Dir names the agent's directory under the dep dir, the buildpack and
+	// the cache.
+	Dir string
+	// Tarball is looked for in <buildpack>/<Dir>. Without it, the latest
+	// version of Package is fetched from the npm registry and cached in
+	// <cache>/<Dir>/<version>, so a new release replaces the cached one.
+	Tarball string
+}
+
+// the module is required through a file next to node_modules, so that it
+// resolves against the package's exports
+const agentRegister = "register.js"
+
+func (a nodeAgent) install(log *libbuildpack.Logger, command Command, buildpackDir string, stager *libbuildpack.Stager) error {
+	tarball, err := a.findTarball(log, command, buildpackDir, stager)
+	if err != nil {
+		log.Error("Unable to find %s: %s", a.Package, err.Error())
+		return err
+	}
+
+	installDir := filepath.Join(stager.DepDir(), a.Dir)
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		return err
+	}
+
+	log.Info("Installing %s", a.Package)
+	if err := command.Execute(installDir, log.Output(), log.Output(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, tarball); err != nil {
+		log.Error("Unable to install %s: %s", a.Package, err.Error())
+		return err
+	}
+
+	register := fmt.Sprintf("require('%s');\n", a.Require)
+	return os.WriteFile(filepath.Join(installDir, agentRegister), []byte(register), 0644)
+}
+
+func (a nodeAgent) findTarball(log *libbuildpack.Logger, command Command, buildpackDir string, stager *libbuildpack.Stager) (string, error) {
+	if buildpackDir != "" {
+		bundled := filepath.Join(buildpackDir, a.Dir, a.Tarball)
+		if exists, err := libbuildpack.FileExists(bundled); err != nil {
+			return "", err
+		} else if exists {
+			log.Debug("Using %s", bundled)
+			return bundled, nil
+		}
+	}
+
+	cacheDir := filepath.Join(stager.CacheDir(), a.Dir)
+	version, err := a.latestVersion(command)
+	if err != nil {
+		cached, found := a.newestCached(cacheDir)
+		if !found {
+			return "", err
+		}
+		log.Warning("Unable to look up the latest version of %s, using the cached one: %s", a.Package, err.Error())
+		return cached, nil
+	}
+
+	versionDir := filepath.Join(cacheDir, version)
+	tarball := filepath.Join(versionDir, a.Tarball)
+	if exists, err := libbuildpack.FileExists(tarball); err != nil {
+		return "", err
+	} else if exists {
+		log.Info("Using cached %s %s", a.Package, version)
+		return tarball, nil
+	}
+
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return "", err
+	}
+
+	log.Info("Downloading %s %s", a.Package, version)
+	var out bytes.Buffer
+	if err := command.Execute(versionDir, &out, log.Output(), "npm", "pack", a.Package+"@"+version, "--pack-destination", versionDir); err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	packed := filepath.Join(versionDir, strings.TrimSpace(lines[len(lines)-1]))
+	if err := os.Rename(packed, tarball); err != nil {
+		return "", err
+	}
+
+	return tarball, nil
+}
+
+// latestVersion asks the npm registry for the version of the package that
+// npm would install.
+func (a nodeAgent) latestVersion(command Command) (string, error) {
+	var out bytes.Buffer
+	if err := command.Execute("", &out, io.Discard, "npm", "view", a.Package, "version"); err != nil {
+		return "", err
+	}
+
+	version := strings.TrimSpace(out.String())
+	if version == "" || strings.ContainsAny(version, "/\\ \n") {
+		return "", fmt.Errorf("npm returned no version of %s", a.Package)
+	}
+	return version, nil
+}
+
+// newestCached returns the tarball of the version that was cached last.
+func (a nodeAgent) newestCached(cacheDir string) (string, bool) {
+	tarballs, err := filepath.Glob(filepath.Join(cacheDir, "*", a.Tarball))
+	if err != nil || len(tarballs) == 0 {
+		return "", false
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, tarball := range tarballs {
+		info, err := os.Stat(tarball)
+		if err != nil {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = tarball, info.ModTime()
+		}
+	}
+	return newest, newest != ""
+}
+
+// nodeOptions appends the --require of the agent to NODE_OPTIONS.
+func (a nodeAgent) nodeOptions(stager *libbuildpack.Stager, script *profiled.Script) {
+	register := profiled.EnvPath("DEPS_DIR", stager.DepsIdx(), a.Dir, agentRegister)
+	script.Append("NODE_OPTIONS", profiled.Concat(profiled.Literal("--require "), register))
+}
+
+// credential is a credential of b, or the zero Word when b does not have it.
+// Credentials of a binding from SERVICE_BINDING_ROOT are read from its files
+// at launch, so that rotated secrets are picked up and none are copied into
+// the droplet.
+func credential(b binding.Binding, key string) profiled.Word {
+	if !b.Credentials.Has(key) {
+		return profiled.Word{}
+	}
+
+	if b.Path == "" {
+		return profiled.Literal(b.Credentials.String(key))
+	}
+	return profiled.FileContents(binding.RootEnv, b.Name, key)
+}
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"os"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type AppDynamicsHook struct {
+	libbuildpack.DefaultHook
+	Log *libbuildpack.Logger
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+
+	libbuildpack.AddHook(AppDynamicsHook{
+		Log: logger,
+	})
+}
+
+func (h AppDynamicsHook) AfterCompile(stager *libbuildpack.Stager) error {
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("AppDynamics could not read service bindings: %s", err)
+	}
+
+	b, found := bindings.First(binding.Matching("app-?dynamics"))
+	if !found {
+		h.Log.Debug("AppDynamics service not bound")
+		return nil
+	}
+	if !b.Credentials.Has("host-name") {
+		h.Log.Warning("AppDynamics service %s has no host-name, the agent needs APPDYNAMICS_CONTROLLER_HOST_NAME to report", b.Name)
+	}
+
+	script := h.profileScript(b)
+	if script.Empty() && script.Err() == nil {
+		h.Log.Warning("AppDynamics service %s has no credentials to configure the agent with", b.Name)
+		return nil
+	}
+
+	h.Log.Info("AppDynamics service %s found. Configuring environment.", b.Name)
+
+	return profiled.Write(stager.DepDir(), "appdynamics.sh", script)
+}
+
+// profileScript exports the controller settings of the binding. An agent
+// set up by another buildpack, which sets APPD_AGENT, is left alone.
+func (h AppDynamicsHook) profileScript(b binding.Binding) *profiled.Script {
+	env := &profiled.Script{}
+
+	for _, c := range [][2]string{
+		{"APPDYNAMICS_CONTROLLER_HOST_NAME", "host-name"},
+		{"APPDYNAMICS_CONTROLLER_PORT", "port"},
+		{"APPDYNAMICS_AGENT_ACCOUNT_NAME", "account-name"},
+		{"APPDYNAMICS_CONTROLLER_SSL_ENABLED", "ssl-enabled"},
+		{"APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY", "account-access-key"},
+	} {
+		if value := credential(b, c[1]); !value.IsZero() {
+			env.Export(c[0], value)
+		}
+	}
+
+	if name := vcapApplication().Name; name != "" {
+		env.Default("APPDYNAMICS_AGENT_APPLICATION_NAME", profiled.Literal(name))
+		env.Default("APPDYNAMICS_AGENT_TIER_NAME", profiled.Literal(name))
+		env.Default("APPDYNAMICS_AGENT_NODE_NAME", profiled.Concat(profiled.Literal(name+":"), profiled.Env("CF_INSTANCE_INDEX")))
+	}
+
+	script := &profiled.Script{}
+	script.If(`[ -z "${APPD_AGENT:-}" ]`, env, nil)
+	return script
+}
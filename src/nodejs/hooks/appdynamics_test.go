@@ -0,0 +1,130 @@
+package hooks_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppDynamicsHook", func() {
+	var (
+		err     error
+		depsDir string
+		depsIdx string
+		buffer  *bytes.Buffer
+		logger  *libbuildpack.Logger
+		stager  *libbuildpack.Stager
+		appd    hooks.AppDynamicsHook
+	)
+
+	profileScript := filepath.Join("profile.d", "appdynamics.sh")
+
+	BeforeEach(func() {
+		depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsIdx = "02"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		appd = hooks.AppDynamicsHook{
+			Log: logger,
+		}
+
+		os.Setenv("VCAP_APPLICATION", `{"application_name": "orders", "application_id": "1234"}`)
+	})
+
+	JustBeforeEach(func() {
+		stager = libbuildpack.NewStager([]string{"", "", depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	Context("without an AppDynamics service", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"p-mysql": [{"name": "db", "credentials": {"uri": "mysql://"}}]}`)
+		})
+
+		It("does not write a profile.d script", func() {
+			Expect(appd.AfterCompile(stager)).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, profileScript)).NotTo(BeAnExistingFile())
+		})
+	})
+
+	DescribeTable("writes the controller settings of the service",
+		func(services string) {
+			os.Setenv("VCAP_SERVICES", services)
+
+			Expect(appd.AfterCompile(stager)).To(Succeed())
+
+			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, profileScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(`if [ -z "${APPD_AGENT:-}" ]; then
+	export APPDYNAMICS_CONTROLLER_HOST_NAME='controller.example.com'
+	export APPDYNAMICS_CONTROLLER_PORT='443'
+	export APPDYNAMICS_AGENT_ACCOUNT_NAME='customer1'
+	export APPDYNAMICS_CONTROLLER_SSL_ENABLED='true'
+	export APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY='s3cr3t'
+	export APPDYNAMICS_AGENT_APPLICATION_NAME=${APPDYNAMICS_AGENT_APPLICATION_NAME:-'orders'}
+	export APPDYNAMICS_AGENT_TIER_NAME=${APPDYNAMICS_AGENT_TIER_NAME:-'orders'}
+	export APPDYNAMICS_AGENT_NODE_NAME=${APPDYNAMICS_AGENT_NODE_NAME:-"orders:$CF_INSTANCE_INDEX"}
+fi
+`))
+		},
+		Entry("by label", `{"appdynamics": [{"name": "apm", "credentials": {"host-name": "controller.example.com", "port": 443, "account-name": "customer1", "ssl-enabled": true, "account-access-key": "s3cr3t"}}]}`),
+		Entry("by name", `{"user-provided": [{"name": "app-dynamics", "credentials": {"host-name": "controller.example.com", "port": "443", "account-name": "customer1", "ssl-enabled": "true", "account-access-key": "s3cr3t"}}]}`),
+		Entry("by tag", `{"user-provided": [{"name": "apm", "tags": ["AppDynamics"], "credentials": {"host-name": "controller.example.com", "port": 443, "account-name": "customer1", "ssl-enabled": true, "account-access-key": "s3cr3t"}}]}`),
+	)
+
+	It("leaves out credentials the service does not have", func() {
+		os.Setenv("VCAP_APPLICATION", `{}`)
+		os.Setenv("VCAP_SERVICES", `{"appdynamics": [{"name": "apm", "credentials": {"host-name": "controller.example.com"}}]}`)
+
+		Expect(appd.AfterCompile(stager)).To(Succeed())
+
+		contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, profileScript))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(`if [ -z "${APPD_AGENT:-}" ]; then
+	export APPDYNAMICS_CONTROLLER_HOST_NAME='controller.example.com'
+fi
+`))
+	})
+
+	It("exports the credentials of a service without a host-name, with a warning", func() {
+		os.Setenv("VCAP_APPLICATION", `{}`)
+		os.Setenv("VCAP_SERVICES", `{"appdynamics": [{"name": "apm", "credentials": {"account-name": "customer1", "account-access-key": "s3cr3t"}}]}`)
+
+		Expect(appd.AfterCompile(stager)).To(Succeed())
+
+		contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, profileScript))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal(`if [ -z "${APPD_AGENT:-}" ]; then
+	export APPDYNAMICS_AGENT_ACCOUNT_NAME='customer1'
+	export APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY='s3cr3t'
+fi
+`))
+		Expect(buffer.String()).To(ContainSubstring("AppDynamics service apm has no host-name"))
+	})
+
+	It("does not write a profile.d script for a service with nothing to export", func() {
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Setenv("VCAP_SERVICES", `{"appdynamics": [{"name": "apm", "credentials": {"plan": "free"}}]}`)
+
+		Expect(appd.AfterCompile(stager)).To(Succeed())
+
+		Expect(filepath.Join(depsDir, depsIdx, profileScript)).NotTo(BeAnExistingFile())
+		Expect(buffer.String()).To(ContainSubstring("AppDynamics service apm has no credentials to configure the agent with"))
+	})
+})
@@ -0,0 +1,24 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type vcapApplicationInfo struct {
+	Name    string `json:"application_name"`
+	ID      string `json:"application_id"`
+	Version string `json:"application_version"`
+	Space   string `json:"space_name"`
+	Org     string `json:"organization_name"`
+}
+
+// vcapApplication returns the app's VCAP_APPLICATION, which is empty when it
+// cannot be parsed.
+func vcapApplication() vcapApplicationInfo {
+	var application vcapApplicationInfo
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_APPLICATION")), &application); err != nil {
+		return vcapApplicationInfo{}
+	}
+	return application
+}
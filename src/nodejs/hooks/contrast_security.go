@@ -1,16 +1,42 @@
 package hooks
 
 import (
-	"encoding/json"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
 	"github.com/cloudfoundry/libbuildpack"
 )
 
+const (
+	ContrastAgentPackage = "@contrast/agent"
+	// ContrastLegacyAgentPackage is the agent's former package name.
+	ContrastLegacyAgentPackage = "node_contrast"
+	ContrastAgentTarball       = "contrast-agent.tgz"
+	ContrastConfigFile         = "contrast_security.yaml"
+)
+
+// contrastRequire matches a --require or -r of the agent in a start command
+// or in NODE_OPTIONS.
+var contrastRequire = regexp.MustCompile(`(?:^|\s)(?:--require|-r)(?:\s+|=)['"]?(?:@contrast/agent|node_contrast)(?:['"\s]|$)`)
+
+var contrastAgent = nodeAgent{
+	Package: ContrastAgentPackage,
+	Require: ContrastAgentPackage,
+	Dir:     "contrast",
+	Tarball: ContrastAgentTarball,
+}
+
 type ContrastSecurityHook struct {
 	libbuildpack.DefaultHook
-	Log *libbuildpack.Logger
+	Log          *libbuildpack.Logger
+	Command      Command
+	BuildpackDir string
 }
 
 type ContrastSecurityCredentials struct {
@@ -21,121 +47,185 @@ type ContrastSecurityCredentials struct {
 	Username    string
 }
 
+// contrastConfig is the part of contrast_security.yaml the hook writes. The
+// API and service keys are left to the environment, where they can be read
+// from the binding at launch.
+type contrastConfig struct {
+	API struct {
+		URL            string `yaml:"url,omitempty"`
+		UserName       string `yaml:"user_name,omitempty"`
+		OrganizationID string `yaml:"organization_id,omitempty"`
+	} `yaml:"api"`
+	Application struct {
+		Name string `yaml:"name,omitempty"`
+	} `yaml:"application,omitempty"`
+	Server struct {
+		Name string `yaml:"name,omitempty"`
+	} `yaml:"server,omitempty"`
+}
+
 func init() {
 	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, _ := libbuildpack.GetBuildpackDir()
 
 	libbuildpack.AddHook(ContrastSecurityHook{
-		Log: logger,
+		Log:          logger,
+		Command:      &libbuildpack.Command{},
+		BuildpackDir: buildpackDir,
 	})
 }
 
 func (h ContrastSecurityHook) AfterCompile(stager *libbuildpack.Stager) error {
 	h.Log.Debug("Contrast Security after compile hook")
 
-	success, contrastSecurityCredentials := h.GetCredentialsFromEnvironment()
-
-	if !success {
+	b, found := h.findBinding()
+	if !found {
 		h.Log.Info("Contrast Security no credentials found. Will not write environment files.")
 		return nil
 	}
 
-	h.Log.Info("Contrast Security credentials found. Configuring environment for [%s].", contrastSecurityCredentials.ContrastUrl)
+	h.Log.Info("Contrast Security credentials found. Configuring environment for [%s].", b.Credentials.String("teamserver_url"))
 
-	var contrastSecurityScript = "export CONTRAST__API__API_KEY=" + contrastSecurityCredentials.ApiKey + "\n" +
-		"export CONTRAST__API__URL=" + contrastSecurityCredentials.ContrastUrl + "/Contrast/\n" +
-		"export CONTRAST__API__SERVICE_KEY=" + contrastSecurityCredentials.ServiceKey + "\n" +
-		"export CONTRAST__API__USER_NAME=" + contrastSecurityCredentials.Username + "\n"
+	script := &profiled.Script{}
 
-	stager.WriteProfileD("contrast_security", contrastSecurityScript)
+	appAgent, loaded, err := h.appAgent(stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	switch {
+	case loaded:
+		h.Log.Info("The app already loads the Contrast agent")
+	case appAgent != "":
+		h.Log.Info("Using %s from the app's dependencies", appAgent)
+		script.Append("NODE_OPTIONS", profiled.Literal("--require "+appAgent))
+	default:
+		// the app still runs without the agent, so a registry that cannot be
+		// reached does not fail staging
+		if err := contrastAgent.install(h.Log, h.Command, h.BuildpackDir, stager); err != nil {
+			h.Log.Warning("Contrast Security agent was not installed, the app will not be instrumented: %s", err.Error())
+		} else {
+			contrastAgent.nodeOptions(stager, script)
+		}
+	}
+
+	configDir := filepath.Join(stager.DepDir(), contrastAgent.Dir)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return err
+	}
+	if err := libbuildpack.NewYAML().Write(filepath.Join(configDir, ContrastConfigFile), h.config(b, vcapApplication())); err != nil {
+		h.Log.Error("Contrast Security could not write %s: %s", ContrastConfigFile, err.Error())
+		return err
+	}
+
+	script.Export("CONTRAST_CONFIG_PATH", profiled.EnvPath("DEPS_DIR", stager.DepsIdx(), contrastAgent.Dir, ContrastConfigFile))
+	for _, c := range [][2]string{
+		{"CONTRAST__API__API_KEY", "api_key"},
+		{"CONTRAST__API__SERVICE_KEY", "service_key"},
+	} {
+		if value := credential(b, c[1]); !value.IsZero() {
+			script.Export(c[0], value)
+		}
+	}
+
+	if err := profiled.Write(stager.DepDir(), "contrast_security", script); err != nil {
+		h.Log.Error("Contrast Security could not write environment: %s", err.Error())
+		return err
+	}
 
 	h.Log.Debug("Contrast Security successfully wrote to .profile.d")
 
 	return nil
 }
 
-func getContrastCredentialString(credentials map[string]interface{}, key string) string {
-	if value, exists := credentials[key]; exists {
-		return value.(string)
+// appAgent returns the agent package the app depends on, if any, which is
+// then loaded instead of one installed by the buildpack. loaded reports that
+// the app's start script or NODE_OPTIONS already requires the agent, so it
+// must not be required again.
+func (h ContrastSecurityHook) appAgent(buildDir string) (agent string, loaded bool, err error) {
+	if contrastRequire.MatchString(os.Getenv("NODE_OPTIONS")) {
+		return "", true, nil
 	}
-	return ""
-}
 
-func containsContrastService(key string, services interface{}, query string) bool {
-	var serviceName string
-	var serviceLabel string
-	var serviceTags []interface{}
+	pkg, err := package_json.Load(filepath.Join(buildDir, package_json.File))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
 
-	if strings.Contains(key, query) {
-		return true
+	if contrastRequire.MatchString(pkg.Scripts["start"]) {
+		return "", true, nil
 	}
-	val := services.([]interface{})
-	for serviceIndex := range val {
-		service := val[serviceIndex].(map[string]interface{})
-		if v, ok := service["name"]; ok {
-			serviceName = v.(string)
-		}
-		if v, ok := service["label"]; ok {
-			serviceLabel = v.(string)
-		}
-		if strings.Contains(serviceName, query) || strings.Contains(serviceLabel, query) {
-			return true
-		}
-		if v, ok := service["tags"]; ok {
-			serviceTags = v.([]interface{})
+
+	for _, name := range []string{ContrastAgentPackage, ContrastLegacyAgentPackage} {
+		if _, found := pkg.Dependencies[name]; found {
+			return name, false, nil
 		}
-		for _, tagValue := range serviceTags {
-			if strings.Contains(tagValue.(string), query) {
-				return true
-			}
+		if _, found := pkg.DevDependencies[name]; found {
+			return name, false, nil
 		}
 	}
-	return false
+	return "", false, nil
 }
 
-func (h ContrastSecurityHook) GetCredentialsFromEnvironment() (bool, ContrastSecurityCredentials) {
+// config names the application after the app, and the server after the app
+// and its space, so instances of one app report as one server.
+func (h ContrastSecurityHook) config(b binding.Binding, app vcapApplicationInfo) contrastConfig {
+	var config contrastConfig
 
-	type rawVcapServicesJSONValue map[string]interface{}
-
-	var vcapServices rawVcapServicesJSONValue
+	if url := b.Credentials.String("teamserver_url"); url != "" {
+		config.API.URL = strings.TrimSuffix(url, "/") + "/Contrast/"
+	}
+	config.API.UserName = b.Credentials.String("username")
+	config.API.OrganizationID = b.Credentials.String("org_uuid")
+	config.Application.Name = app.Name
+
+	if app.Space != "" && app.Name != "" {
+		config.Server.Name = app.Space + "-" + app.Name
+	} else {
+		config.Server.Name = app.Name
+	}
 
-	vcapServicesEnvironment := os.Getenv("VCAP_SERVICES")
+	return config
+}
 
-	if vcapServicesEnvironment == "" {
-		h.Log.Debug("Contrast Security could not find VCAP_SERVICES in the environment")
+// GetCredentialsFromEnvironment looks for a binding with contrast-security in
+// its label, name or tags.
+func (h ContrastSecurityHook) GetCredentialsFromEnvironment() (bool, ContrastSecurityCredentials) {
+	b, found := h.findBinding()
+	if !found {
 		return false, ContrastSecurityCredentials{}
 	}
 
-	err := json.Unmarshal([]byte(vcapServicesEnvironment), &vcapServices)
+	return true, ContrastSecurityCredentials{
+		ApiKey:      b.Credentials.String("api_key"),
+		OrgUuid:     b.Credentials.String("org_uuid"),
+		ServiceKey:  b.Credentials.String("service_key"),
+		ContrastUrl: b.Credentials.String("teamserver_url"),
+		Username:    b.Credentials.String("username"),
+	}
+}
+
+func (h ContrastSecurityHook) findBinding() (binding.Binding, bool) {
+	bindings, err := binding.Load()
 	if err != nil {
-		h.Log.Warning("Contrast Security could not parse VCAP_SERVICES")
-		return false, ContrastSecurityCredentials{}
+		h.Log.Warning("Contrast Security could not read service bindings: %s", err.Error())
 	}
 
-	for key, services := range vcapServices {
-		if containsContrastService(key, services, "contrast-security") {
-			h.Log.Debug("Contrast Security found credentials in VCAP_SERVICES")
-			val := services.([]interface{})
-			for serviceIndex := range val {
-				service := val[serviceIndex].(map[string]interface{})
-				if credentials, exists := service["credentials"].(map[string]interface{}); exists {
-					apiKey := getContrastCredentialString(credentials, "api_key")
-					orgUuid := getContrastCredentialString(credentials, "org_uuid")
-					serviceKey := getContrastCredentialString(credentials, "service_key")
-					contrastUrl := getContrastCredentialString(credentials, "teamserver_url")
-					username := getContrastCredentialString(credentials, "username")
-
-					contrastSecurityCredentials := ContrastSecurityCredentials{
-						ApiKey:      apiKey,
-						OrgUuid:     orgUuid,
-						ServiceKey:  serviceKey,
-						ContrastUrl: contrastUrl,
-						Username:    username,
-					}
-					return true, contrastSecurityCredentials
-				}
-			}
+	if len(bindings) == 0 {
+		h.Log.Debug("Contrast Security could not find service bindings in the environment")
+		return binding.Binding{}, false
+	}
+
+	for _, b := range bindings.Find(binding.Matching("contrast-security")) {
+		if len(b.Credentials) == 0 {
+			continue
 		}
+
+		h.Log.Debug("Contrast Security found credentials in %s", b)
+		return b, true
 	}
 
-	return false, ContrastSecurityCredentials{}
+	return binding.Binding{}, false
 }
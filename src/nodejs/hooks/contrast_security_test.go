@@ -4,13 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
 
 	"github.com/cloudfoundry/libbuildpack"
+	"github.com/golang/mock/gomock"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -34,21 +33,74 @@ var _ = Describe("contrastSecurityHook", func() {
 	})
 
 	Describe("AfterCompile", func() {
+		var (
+			err          error
+			buildDir     string
+			cacheDir     string
+			depsDir      string
+			depsIdx      string
+			buildpackDir string
+			mockCtrl     *gomock.Controller
+			mockCommand  *MockCommand
+		)
+
+		profileScript := func() string {
+			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "contrast_security"))
+			Expect(err).NotTo(HaveOccurred())
+			return string(contents)
+		}
+
+		config := func() string {
+			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "contrast", hooks.ContrastConfigFile))
+			Expect(err).NotTo(HaveOccurred())
+			return string(contents)
+		}
+
+		BeforeEach(func() {
+			buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+			Expect(err).NotTo(HaveOccurred())
+
+			cacheDir, err = os.MkdirTemp("", "nodejs-buildpack.cache.")
+			Expect(err).NotTo(HaveOccurred())
+
+			depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+			Expect(err).NotTo(HaveOccurred())
+
+			buildpackDir, err = os.MkdirTemp("", "nodejs-buildpack.buildpack.")
+			Expect(err).NotTo(HaveOccurred())
+
+			depsIdx = "07"
+			Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+			tarball := filepath.Join(buildpackDir, "contrast", hooks.ContrastAgentTarball)
+			Expect(os.MkdirAll(filepath.Dir(tarball), 0755)).To(Succeed())
+			Expect(os.WriteFile(tarball, []byte("tgz"), 0644)).To(Succeed())
+
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockCommand = NewMockCommand(mockCtrl)
+
+			contrast.Command = mockCommand
+			contrast.BuildpackDir = buildpackDir
+
+			os.Setenv("VCAP_APPLICATION", `{"application_name": "orders", "space_name": "prod"}`)
+		})
 
 		JustBeforeEach(func() {
-			tmpDir, _ := os.MkdirTemp("", "contrast_security_test")
-			args := []string{tmpDir, "", ".", ""}
-			stager = libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
+			stager = libbuildpack.NewStager([]string{buildDir, cacheDir, depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
 		})
 
 		AfterEach(func() {
-			Expect(os.RemoveAll(stager.BuildDir())).To(Succeed())
-			Expect(os.RemoveAll(filepath.Join(stager.DepDir(), "profile.d"))).To(Succeed())
+			mockCtrl.Finish()
+			os.Unsetenv("VCAP_APPLICATION")
+			os.Unsetenv("VCAP_SERVICES")
+			Expect(os.RemoveAll(buildDir)).To(Succeed())
+			Expect(os.RemoveAll(cacheDir)).To(Succeed())
+			Expect(os.RemoveAll(depsDir)).To(Succeed())
+			Expect(os.RemoveAll(buildpackDir)).To(Succeed())
 		})
 
 		Context("Contrast Security credentials in VCAP_SERVICES", func() {
 			BeforeEach(func() {
-				os.Setenv("VCAP_APPLICATION", `{}`)
 				os.Setenv("VCAP_SERVICES", `{
                                                 "contrast-security": [
                                                  {
@@ -65,45 +117,55 @@ var _ = Describe("contrastSecurityHook", func() {
                                                }`)
 			})
 
-			It("writes the Contrast Security credentials to a file in profile.d/", func() {
-				err := contrast.AfterCompile(stager)
-				Expect(err).To(BeNil())
-
-				profileDir := filepath.Join(stager.DepDir(), "profile.d")
-				files, err := os.ReadDir(profileDir)
-				Expect(err).To(BeNil())
-				//Expect(len(files)).To(Equal(1))
-
-				var fileExists bool
-				var fileIndex int
-				for index, file := range files {
-					if strings.Contains(file.Name(), "contrast_security") {
-						fmt.Println(file.Name())
-						fileExists = true
-						fileIndex = index
-					}
-				}
-				Expect(fileExists).To(Equal(true))
+			It("installs the agent and loads it through NODE_OPTIONS", func() {
+				installDir := filepath.Join(depsDir, depsIdx, "contrast")
+				tarball := filepath.Join(buildpackDir, "contrast", hooks.ContrastAgentTarball)
+				mockCommand.EXPECT().Execute(installDir, gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, tarball)
 
-				fileBytes, err := os.ReadFile(filepath.Join(profileDir, files[fileIndex].Name()))
+				Expect(contrast.AfterCompile(stager)).To(Succeed())
 
-				if err != nil {
-					Fail(err.Error())
-				}
+				register, err := os.ReadFile(filepath.Join(installDir, "register.js"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(register)).To(Equal("require('@contrast/agent');\n"))
 
-				fileContents := string(fileBytes)
-				var sampleExportList string = "export CONTRAST__API__API_KEY=sample_api_key\n" +
-					"export CONTRAST__API__URL=sample_teamserver_url/Contrast/\n" +
-					"export CONTRAST__API__SERVICE_KEY=sample_service_key\n" +
-					"export CONTRAST__API__USER_NAME=username@example.com\n"
-				Expect(fileContents).To(Equal(sampleExportList))
+				Expect(profileScript()).To(Equal(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/07/contrast/register.js"
+export CONTRAST_CONFIG_PATH="$DEPS_DIR/07/contrast/contrast_security.yaml"
+export CONTRAST__API__API_KEY='sample_api_key'
+export CONTRAST__API__SERVICE_KEY='sample_service_key'
+`))
 			})
 
+			It("warns and leaves the app uninstrumented when the agent cannot be downloaded", func() {
+				Expect(os.RemoveAll(filepath.Join(buildpackDir, "contrast"))).To(Succeed())
+				mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "view", "@contrast/agent", "version").Return(fmt.Errorf("exit status 1"))
+
+				Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+				Expect(buffer.String()).To(ContainSubstring("Contrast Security agent was not installed, the app will not be instrumented: exit status 1"))
+				Expect(profileScript()).NotTo(ContainSubstring("NODE_OPTIONS"))
+				Expect(config()).To(ContainSubstring("url: sample_teamserver_url/Contrast/"))
+			})
+
+			It("writes contrast_security.yaml from the binding and VCAP_APPLICATION", func() {
+				mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", gomock.Any())
+
+				Expect(contrast.AfterCompile(stager)).To(Succeed())
+				Expect(config()).To(MatchYAML(`
+api:
+  url: sample_teamserver_url/Contrast/
+  user_name: username@example.com
+  organization_id: sampe_org_uuid
+application:
+  name: orders
+server:
+  name: prod-orders
+`))
+				Expect(config()).NotTo(ContainSubstring("sample_api_key"))
+			})
 		})
 
 		Context("Contrast Security credentials in user-provided VCAP_SERVICES", func() {
 			BeforeEach(func() {
-				os.Setenv("VCAP_APPLICATION", `{}`)
 				os.Setenv("VCAP_SERVICES", `{"user-provided":[
 														{ "label": "user-provided",
 															"name": "contrast-security-service",
@@ -113,7 +175,7 @@ var _ = Describe("contrastSecurityHook", func() {
 															"credentials": {
 															"api_key": "sample_api_key",
 															"service_key": "sample_service_key",
-															"teamserver_url": "sample_teamserver_url",
+															"teamserver_url": "https://app.contrastsecurity.com/",
 															"username": "username@example.com"
 															},
 															"syslog_drain_url": "",
@@ -122,56 +184,106 @@ var _ = Describe("contrastSecurityHook", func() {
 													    ]}`)
 			})
 
-			It("writes the Contrast Security credentials to a file in profile.d/", func() {
-				err := contrast.AfterCompile(stager)
-				Expect(err).To(BeNil())
-
-				profileDir := filepath.Join(stager.DepDir(), "profile.d")
-				files, err := os.ReadDir(profileDir)
-				Expect(err).To(BeNil())
-				//Expect(len(files)).To(Equal(1))
-
-				var fileExists bool
-				var fileIndex int
-				for index, file := range files {
-					if strings.Contains(file.Name(), "contrast_security") {
-						fmt.Println(file.Name())
-						fileExists = true
-						fileIndex = index
-					}
-				}
-				Expect(fileExists).To(Equal(true))
+			Context("when the app depends on the agent", func() {
+				BeforeEach(func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"dependencies": {"@contrast/agent": "^5.0.0"}}`), 0644)).To(Succeed())
+				})
 
-				fileBytes, err := os.ReadFile(filepath.Join(profileDir, files[fileIndex].Name()))
+				It("loads the app's agent without installing one", func() {
+					Expect(contrast.AfterCompile(stager)).To(Succeed())
 
-				if err != nil {
-					Fail(err.Error())
+					Expect(profileScript()).To(HavePrefix(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require @contrast/agent"` + "\n"))
+					Expect(config()).To(ContainSubstring("url: https://app.contrastsecurity.com/Contrast/"))
+					Expect(buffer.String()).To(ContainSubstring("Using @contrast/agent from the app's dependencies"))
+				})
+			})
+
+			Context("when the app has the agent in its devDependencies", func() {
+				BeforeEach(func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"devDependencies": {"@contrast/agent": "^5.0.0"}}`), 0644)).To(Succeed())
+				})
+
+				It("loads the app's agent without installing one", func() {
+					Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+					Expect(profileScript()).To(HavePrefix(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require @contrast/agent"` + "\n"))
+				})
+			})
+
+			Context("when the app depends on the legacy agent", func() {
+				BeforeEach(func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"dependencies": {"node_contrast": "^3.0.0"}}`), 0644)).To(Succeed())
+				})
+
+				It("loads the app's agent without installing one", func() {
+					Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+					Expect(profileScript()).To(HavePrefix(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require node_contrast"` + "\n"))
+					Expect(buffer.String()).To(ContainSubstring("Using node_contrast from the app's dependencies"))
+				})
+			})
+
+			Context("when the app's start script requires the agent", func() {
+				for _, start := range []string{"node --require @contrast/agent server.js", "node -r @contrast/agent server.js"} {
+					start := start
+
+					It("does not install or require the agent for "+start, func() {
+						pkg := fmt.Sprintf(`{"scripts": {"start": %q}, "dependencies": {"@contrast/agent": "^5.0.0"}}`, start)
+						Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(pkg), 0644)).To(Succeed())
+
+						Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+						Expect(profileScript()).NotTo(ContainSubstring("NODE_OPTIONS"))
+						Expect(profileScript()).To(ContainSubstring("CONTRAST_CONFIG_PATH"))
+						Expect(buffer.String()).To(ContainSubstring("The app already loads the Contrast agent"))
+					})
 				}
+			})
+
+			Context("when NODE_OPTIONS requires the agent", func() {
+				BeforeEach(func() {
+					os.Setenv("NODE_OPTIONS", "--max-old-space-size=512 -r @contrast/agent")
+				})
 
-				fileContents := string(fileBytes)
-				var sampleExportList string = "export CONTRAST__API__API_KEY=sample_api_key\n" +
-					"export CONTRAST__API__URL=sample_teamserver_url/Contrast/\n" +
-					"export CONTRAST__API__SERVICE_KEY=sample_service_key\n" +
-					"export CONTRAST__API__USER_NAME=username@example.com\n"
-				Expect(fileContents).To(Equal(sampleExportList))
+				AfterEach(func() {
+					os.Unsetenv("NODE_OPTIONS")
+				})
+
+				It("does not install or require the agent", func() {
+					Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+					Expect(profileScript()).NotTo(ContainSubstring("NODE_OPTIONS"))
+					Expect(buffer.String()).To(ContainSubstring("The app already loads the Contrast agent"))
+				})
+			})
+
+			Context("when the start script requires a different package", func() {
+				BeforeEach(func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"scripts": {"start": "node -r @contrast/agent-extras server.js"}}`), 0644)).To(Succeed())
+				})
+
+				It("installs the agent", func() {
+					installDir := filepath.Join(depsDir, depsIdx, "contrast")
+					mockCommand.EXPECT().Execute(installDir, gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, gomock.Any())
+
+					Expect(contrast.AfterCompile(stager)).To(Succeed())
+
+					Expect(profileScript()).To(HavePrefix(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/07/contrast/register.js"`))
+				})
 			})
 		})
 
 		Context("No Contrast Security credentials in VCAP_SERVICES", func() {
 			BeforeEach(func() {
-				os.Setenv("VCAP_APPLICATION", "{}")
 				os.Setenv("VCAP_SERVICES", "{}")
 			})
 
-			It("writes the Contrast Security credentials to a file in .profile.d", func() {
-				err := contrast.AfterCompile(stager)
-				Expect(err).To(BeNil())
+			It("does not install the agent or write a profile.d script", func() {
+				Expect(contrast.AfterCompile(stager)).To(Succeed())
 
-				files, err := os.ReadDir(path.Join(stager.BuildDir()))
-				Expect(err).To(BeNil())
-				Expect(len(files)).To(Equal(0))
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(depsDir, depsIdx, "contrast")).NotTo(BeAnExistingFile())
 			})
-
 		})
 	})
 
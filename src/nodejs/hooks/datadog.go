@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const DatadogTarball = "dd-trace.tgz"
+
+var datadogAgent = nodeAgent{
+	Package: "dd-trace",
+	Require: "dd-trace/init",
+	Dir:     "datadog",
+	Tarball: DatadogTarball,
+}
+
+type DatadogHook struct {
+	libbuildpack.DefaultHook
+	Log          *libbuildpack.Logger
+	Command      Command
+	BuildpackDir string
+}
+
+type DatadogBinding struct {
+	Name          string
+	APIKey        string
+	Site          string
+	TraceAgentURL string
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, _ := libbuildpack.GetBuildpackDir()
+
+	libbuildpack.AddHook(&DatadogHook{
+		Log:          logger,
+		Command:      &libbuildpack.Command{},
+		BuildpackDir: buildpackDir,
+	})
+}
+
+func (h *DatadogHook) AfterCompile(stager *libbuildpack.Stager) error {
+	b, found := h.findBinding()
+	if !found && os.Getenv("DD_API_KEY") == "" {
+		h.Log.Debug("Datadog service not bound and DD_API_KEY not set")
+		return nil
+	}
+
+	if found {
+		h.Log.BeginStep("Configuring Datadog APM for service %s", b.Name)
+	} else {
+		h.Log.BeginStep("Configuring Datadog APM")
+	}
+
+	if err := datadogAgent.install(h.Log, h.Command, h.BuildpackDir, stager); err != nil {
+		return err
+	}
+
+	return profiled.Write(stager.DepDir(), "datadog.sh", h.profileScript(stager, b))
+}
+
+// GetBinding returns the first service with datadog in its label, name or
+// tags, or nil when none is bound.
+func (h *DatadogHook) GetBinding() *DatadogBinding {
+	b, found := h.findBinding()
+	if !found {
+		return nil
+	}
+
+	return &DatadogBinding{
+		Name:          b.Name,
+		APIKey:        b.Credentials.String("api_key"),
+		Site:          b.Credentials.String("site"),
+		TraceAgentURL: b.Credentials.String("trace_agent_url"),
+	}
+}
+
+func (h *DatadogHook) findBinding() (binding.Binding, bool) {
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("Failed to read service bindings: %s", err)
+	}
+
+	return bindings.First(binding.Matching("datadog"))
+}
+
+// profileScript sets Datadog's unified service tags from the app, its space
+// and its version, and the binding's credentials, leaving any the app sets
+// itself.
+func (h *DatadogHook) profileScript(stager *libbuildpack.Stager, b binding.Binding) *profiled.Script {
+	app := vcapApplication()
+
+	script := &profiled.Script{}
+	datadogAgent.nodeOptions(stager, script)
+	script.Default("DD_SERVICE", profiled.Literal(app.Name))
+	script.Default("DD_ENV", profiled.Literal(app.Space))
+	script.Default("DD_VERSION", profiled.Literal(app.Version))
+	script.Default("DD_TAGS", profiled.Literal(datadogTags(app)))
+	script.Default("DD_API_KEY", credential(b, "api_key"))
+	script.Default("DD_SITE", credential(b, "site"))
+	script.Default("DD_TRACE_AGENT_URL", credential(b, "trace_agent_url"))
+	return script
+}
+
+func datadogTags(app vcapApplicationInfo) string {
+	var tags []string
+	for _, tag := range [][2]string{
+		{"cf_org", app.Org},
+		{"cf_space", app.Space},
+		{"cf_app", app.Name},
+		{"cf_app_id", app.ID},
+	} {
+		if tag[1] != "" {
+			tags = append(tags, fmt.Sprintf("%s:%s", tag[0], tag[1]))
+		}
+	}
+	return strings.Join(tags, ",")
+}
@@ -0,0 +1,138 @@
+package hooks_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatadogHook", func() {
+	var (
+		err          error
+		cacheDir     string
+		depsDir      string
+		depsIdx      string
+		buildpackDir string
+		logger       *libbuildpack.Logger
+		buffer       *bytes.Buffer
+		stager       *libbuildpack.Stager
+		mockCtrl     *gomock.Controller
+		mockCommand  *MockCommand
+		datadog      *hooks.DatadogHook
+	)
+
+	profileScript := func() string {
+		contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "datadog.sh"))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		cacheDir, err = os.MkdirTemp("", "nodejs-buildpack.cache.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buildpackDir, err = os.MkdirTemp("", "nodejs-buildpack.buildpack.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsIdx = "05"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		tarball := filepath.Join(buildpackDir, "datadog", hooks.DatadogTarball)
+		Expect(os.MkdirAll(filepath.Dir(tarball), 0755)).To(Succeed())
+		Expect(os.WriteFile(tarball, []byte("tgz"), 0644)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		datadog = &hooks.DatadogHook{
+			Log:          logger,
+			Command:      mockCommand,
+			BuildpackDir: buildpackDir,
+		}
+
+		os.Setenv("VCAP_APPLICATION", `{
+  "application_name": "orders",
+  "application_id": "6f1b",
+  "application_version": "a3c5",
+  "space_name": "staging",
+  "organization_name": "shop"
+}`)
+		os.Setenv("VCAP_SERVICES", `{}`)
+	})
+
+	JustBeforeEach(func() {
+		stager = libbuildpack.NewStager([]string{"", cacheDir, depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+		os.Unsetenv("DD_API_KEY")
+
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+	})
+
+	Context("without a binding or DD_API_KEY", func() {
+		It("does nothing", func() {
+			Expect(datadog.AfterCompile(stager)).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "datadog.sh")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("with a datadog service", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "datadog-apm", "credentials": {"api_key": "abc123", "site": "datadoghq.eu"}}]}`)
+		})
+
+		It("preloads dd-trace and derives unified service tags", func() {
+			installDir := filepath.Join(depsDir, depsIdx, "datadog")
+			mockCommand.EXPECT().Execute(installDir, gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, filepath.Join(buildpackDir, "datadog", hooks.DatadogTarball))
+
+			Expect(datadog.AfterCompile(stager)).To(Succeed())
+
+			register, err := os.ReadFile(filepath.Join(installDir, "register.js"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(register)).To(Equal("require('dd-trace/init');\n"))
+
+			Expect(profileScript()).To(Equal(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/05/datadog/register.js"
+export DD_SERVICE=${DD_SERVICE:-'orders'}
+export DD_ENV=${DD_ENV:-'staging'}
+export DD_VERSION=${DD_VERSION:-'a3c5'}
+export DD_TAGS=${DD_TAGS:-'cf_org:shop,cf_space:staging,cf_app:orders,cf_app_id:6f1b'}
+export DD_API_KEY=${DD_API_KEY:-'abc123'}
+export DD_SITE=${DD_SITE:-'datadoghq.eu'}
+`))
+		})
+	})
+
+	Context("with DD_API_KEY and no service", func() {
+		BeforeEach(func() {
+			os.Setenv("DD_API_KEY", "abc123")
+		})
+
+		It("preloads dd-trace and leaves the key to the app's environment", func() {
+			mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", gomock.Any())
+
+			Expect(datadog.AfterCompile(stager)).To(Succeed())
+			Expect(profileScript()).NotTo(ContainSubstring("DD_API_KEY"))
+			Expect(profileScript()).To(ContainSubstring("export DD_SERVICE=${DD_SERVICE:-'orders'}"))
+		})
+	})
+})
@@ -1,10 +1,73 @@
 package hooks
 
 import (
-	"github.com/cloudfoundry/libbuildpack"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+
 	"github.com/Dynatrace/libbuildpack-dynatrace"
+	"github.com/cloudfoundry/libbuildpack"
 )
 
+// DynatraceHook runs the Dynatrace hook, which only reads VCAP_SERVICES, with
+// the bindings under SERVICE_BINDING_ROOT added to them.
+type DynatraceHook struct {
+	libbuildpack.Hook
+	Log *libbuildpack.Logger
+}
+
 func init() {
-	libbuildpack.AddHook(dynatrace.NewHook("nodejs", "process"))
+	logger := libbuildpack.NewLogger(os.Stdout)
+
+	libbuildpack.AddHook(DynatraceHook{
+		Hook: dynatrace.NewHook("nodejs", "process"),
+		Log:  logger,
+	})
+}
+
+func (h DynatraceHook) AfterCompile(stager *libbuildpack.Stager) error {
+	if _, set := os.LookupEnv("VCAP_SERVICES_FILE_PATH"); set || os.Getenv(binding.RootEnv) == "" {
+		return h.Hook.AfterCompile(stager)
+	}
+
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("Dynatrace could not read service bindings: %s", err)
+	}
+
+	if !hasDirectoryBinding(bindings.Find(binding.Named("dynatrace"))) {
+		return h.Hook.AfterCompile(stager)
+	}
+
+	vcapServices, err := bindings.VCAPServices()
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "dynatrace")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "vcap_services.json")
+	if err := os.WriteFile(path, vcapServices, 0600); err != nil {
+		return err
+	}
+
+	h.Log.Debug("Passing the bindings under %s to Dynatrace", binding.RootEnv)
+	os.Setenv("VCAP_SERVICES_FILE_PATH", path)
+	defer os.Unsetenv("VCAP_SERVICES_FILE_PATH")
+
+	return h.Hook.AfterCompile(stager)
+}
+
+func hasDirectoryBinding(bindings binding.Bindings) bool {
+	for _, b := range bindings {
+		if b.Path != "" {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,99 @@
+package hooks_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type dynatraceSpy struct {
+	libbuildpack.DefaultHook
+	filePath     string
+	vcapServices string
+}
+
+func (s *dynatraceSpy) AfterCompile(stager *libbuildpack.Stager) error {
+	s.filePath = os.Getenv("VCAP_SERVICES_FILE_PATH")
+	if s.filePath != "" {
+		contents, err := os.ReadFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		s.vcapServices = string(contents)
+	}
+	return nil
+}
+
+var _ = Describe("DynatraceHook", func() {
+	var (
+		err         error
+		bindingRoot string
+		spy         *dynatraceSpy
+		stager      *libbuildpack.Stager
+		dynatrace   hooks.DynatraceHook
+	)
+
+	BeforeEach(func() {
+		bindingRoot, err = os.MkdirTemp("", "nodejs-buildpack.bindings.")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger := libbuildpack.NewLogger(new(bytes.Buffer))
+		stager = libbuildpack.NewStager([]string{"", "", "", "01"}, logger, &libbuildpack.Manifest{})
+
+		spy = &dynatraceSpy{}
+		dynatrace = hooks.DynatraceHook{Hook: spy, Log: logger}
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("VCAP_SERVICES")
+		os.Unsetenv("SERVICE_BINDING_ROOT")
+		Expect(os.RemoveAll(bindingRoot)).To(Succeed())
+	})
+
+	Context("with a Dynatrace service under SERVICE_BINDING_ROOT", func() {
+		BeforeEach(func() {
+			dir := filepath.Join(bindingRoot, "dynatrace")
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "type"), []byte("user-provided"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "environmentid"), []byte("abc123"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "apitoken"), []byte("token\n"), 0644)).To(Succeed())
+
+			os.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+			os.Setenv("VCAP_SERVICES", `{"p-mysql": [{"name": "db", "credentials": {}}]}`)
+		})
+
+		It("passes every binding to Dynatrace as a VCAP_SERVICES file", func() {
+			Expect(dynatrace.AfterCompile(stager)).To(Succeed())
+
+			Expect(spy.vcapServices).To(MatchJSON(`{
+  "p-mysql": [{"name": "db", "label": "p-mysql", "provider": null, "tags": [], "credentials": {}}],
+  "user-provided": [{"name": "dynatrace", "label": "user-provided", "provider": null, "tags": [], "credentials": {"environmentid": "abc123", "apitoken": "token"}}]
+}`))
+		})
+
+		It("removes the file afterwards", func() {
+			Expect(dynatrace.AfterCompile(stager)).To(Succeed())
+
+			Expect(spy.filePath).NotTo(BeAnExistingFile())
+			Expect(os.Getenv("VCAP_SERVICES_FILE_PATH")).To(BeEmpty())
+		})
+	})
+
+	Context("without a Dynatrace service under SERVICE_BINDING_ROOT", func() {
+		BeforeEach(func() {
+			os.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+			os.Setenv("VCAP_SERVICES", `{"dynatrace": [{"name": "dynatrace", "credentials": {}}]}`)
+		})
+
+		It("leaves Dynatrace to read VCAP_SERVICES", func() {
+			Expect(dynatrace.AfterCompile(stager)).To(Succeed())
+			Expect(spy.filePath).To(BeEmpty())
+		})
+	})
+})
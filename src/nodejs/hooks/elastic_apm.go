@@ -0,0 +1,102 @@
+package hooks
+
+import (
+	"os"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const ElasticAPMTarball = "elastic-apm-node.tgz"
+
+var elasticAPMAgent = nodeAgent{
+	Package: "elastic-apm-node",
+	Require: "elastic-apm-node/start",
+	Dir:     "elastic-apm",
+	Tarball: ElasticAPMTarball,
+}
+
+type ElasticAPMHook struct {
+	libbuildpack.DefaultHook
+	Log          *libbuildpack.Logger
+	Command      Command
+	BuildpackDir string
+}
+
+type ElasticAPMCredentials struct {
+	ServiceName string
+	ServerURL   string
+	SecretToken string
+	APIKey      string
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, _ := libbuildpack.GetBuildpackDir()
+
+	libbuildpack.AddHook(&ElasticAPMHook{
+		Log:          logger,
+		Command:      &libbuildpack.Command{},
+		BuildpackDir: buildpackDir,
+	})
+}
+
+func (h *ElasticAPMHook) AfterCompile(stager *libbuildpack.Stager) error {
+	h.Log.Debug("Elastic APM after compile hook")
+
+	b, found := h.findBinding()
+	if !found {
+		h.Log.Debug("Elastic APM no credentials found. Will not install the agent.")
+		return nil
+	}
+
+	h.Log.BeginStep("Configuring Elastic APM for [%s]", b.Credentials.String("server_url"))
+
+	if err := elasticAPMAgent.install(h.Log, h.Command, h.BuildpackDir, stager); err != nil {
+		return err
+	}
+
+	return profiled.Write(stager.DepDir(), "elastic_apm.sh", h.profileScript(stager, b))
+}
+
+// GetCredentialsFromEnvironment looks for a service with elastic-apm in its
+// label, name or tags that has a server_url.
+func (h *ElasticAPMHook) GetCredentialsFromEnvironment() (bool, ElasticAPMCredentials) {
+	b, found := h.findBinding()
+	if !found {
+		return false, ElasticAPMCredentials{}
+	}
+
+	return true, ElasticAPMCredentials{
+		ServiceName: b.Name,
+		ServerURL:   b.Credentials.String("server_url"),
+		SecretToken: b.Credentials.String("secret_token"),
+		APIKey:      b.Credentials.String("api_key"),
+	}
+}
+
+func (h *ElasticAPMHook) findBinding() (binding.Binding, bool) {
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("Elastic APM could not read service bindings: %s", err)
+	}
+
+	return bindings.First(binding.Matching("elastic-?apm").WithCredentials("server_url"))
+}
+
+// profileScript names the service and its environment after the app and its
+// space, leaving any ELASTIC_APM_ variables the app sets itself.
+func (h *ElasticAPMHook) profileScript(stager *libbuildpack.Stager, b binding.Binding) *profiled.Script {
+	app := vcapApplication()
+
+	script := &profiled.Script{}
+	elasticAPMAgent.nodeOptions(stager, script)
+	script.Default("ELASTIC_APM_SERVER_URL", credential(b, "server_url"))
+	script.Default("ELASTIC_APM_SECRET_TOKEN", credential(b, "secret_token"))
+	script.Default("ELASTIC_APM_API_KEY", credential(b, "api_key"))
+	script.Default("ELASTIC_APM_SERVICE_NAME", profiled.Literal(app.Name))
+	script.Default("ELASTIC_APM_ENVIRONMENT", profiled.Literal(app.Space))
+	return script
+}
@@ -0,0 +1,175 @@
+package hooks_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/golang/mock/gomock"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("elasticAPMHook", func() {
+	var (
+		buffer      *bytes.Buffer
+		logger      *libbuildpack.Logger
+		elastic     *hooks.ElasticAPMHook
+		stager      *libbuildpack.Stager
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+	)
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		elastic = &hooks.ElasticAPMHook{
+			Log:     logger,
+			Command: mockCommand,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+	})
+
+	Describe("AfterCompile", func() {
+		JustBeforeEach(func() {
+			tmpDir, _ := os.MkdirTemp("", "elastic_apm_test")
+			args := []string{tmpDir, tmpDir, ".", "03"}
+			stager = libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
+
+			tarball := filepath.Join(stager.CacheDir(), "elastic-apm", "4.5.0", hooks.ElasticAPMTarball)
+			Expect(os.MkdirAll(filepath.Dir(tarball), 0755)).To(Succeed())
+			Expect(os.WriteFile(tarball, []byte("tgz"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(stager.BuildDir())).To(Succeed())
+			Expect(os.RemoveAll(stager.DepDir())).To(Succeed())
+		})
+
+		Context("Elastic APM credentials in VCAP_SERVICES", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_APPLICATION", `{"application_name": "orders", "space_name": "production"}`)
+				os.Setenv("VCAP_SERVICES", `{
+                                                "elastic-apm": [
+                                                 {
+                                                  "name": "apm",
+                                                  "credentials": {
+                                                   "server_url": "https://apm.example.com:8200",
+                                                   "secret_token": "sample_secret_token"
+                                                  }
+                                                 }
+                                                ]
+                                               }`)
+			})
+
+			It("installs elastic-apm-node and writes its environment to profile.d/", func() {
+				installDir := filepath.Join(stager.DepDir(), "elastic-apm")
+				mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "view", "elastic-apm-node", "version").
+					DoAndReturn(func(dir string, stdout, stderr io.Writer, program string, args ...string) error {
+						_, err := fmt.Fprintln(stdout, "4.5.0")
+						return err
+					})
+				mockCommand.EXPECT().Execute(installDir, gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, filepath.Join(stager.CacheDir(), "elastic-apm", "4.5.0", hooks.ElasticAPMTarball))
+
+				err := elastic.AfterCompile(stager)
+				Expect(err).To(BeNil())
+
+				register, err := os.ReadFile(filepath.Join(installDir, "register.js"))
+				Expect(err).To(BeNil())
+				Expect(string(register)).To(Equal("require('elastic-apm-node/start');\n"))
+
+				fileBytes, err := os.ReadFile(filepath.Join(stager.DepDir(), "profile.d", "elastic_apm.sh"))
+				Expect(err).To(BeNil())
+
+				var sampleExportList string = "export NODE_OPTIONS=\"${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/03/elastic-apm/register.js\"\n" +
+					"export ELASTIC_APM_SERVER_URL=${ELASTIC_APM_SERVER_URL:-'https://apm.example.com:8200'}\n" +
+					"export ELASTIC_APM_SECRET_TOKEN=${ELASTIC_APM_SECRET_TOKEN:-'sample_secret_token'}\n" +
+					"export ELASTIC_APM_SERVICE_NAME=${ELASTIC_APM_SERVICE_NAME:-'orders'}\n" +
+					"export ELASTIC_APM_ENVIRONMENT=${ELASTIC_APM_ENVIRONMENT:-'production'}\n"
+				Expect(string(fileBytes)).To(Equal(sampleExportList))
+			})
+		})
+
+		Context("No Elastic APM credentials in VCAP_SERVICES", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_APPLICATION", "{}")
+				os.Setenv("VCAP_SERVICES", "{}")
+			})
+
+			It("does not install the agent", func() {
+				err := elastic.AfterCompile(stager)
+				Expect(err).To(BeNil())
+
+				Expect(filepath.Join(stager.DepDir(), "profile.d", "elastic_apm.sh")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("GetCredentialsFromEnvironment", func() {
+		Context("Elastic APM defined in name for user-provided service within VCAP_SERVICES", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+                                    "user-provided":[
+                                      { "label": "user-provided",
+                                        "name": "elastic-apm-service",
+                                        "tags": [ ],
+                                        "credentials": {
+                                          "server_url": "https://apm.example.com",
+                                          "api_key": "sample_api_key"
+                                          }
+                                        }
+                                      ]
+                                    }`)
+			})
+
+			It("returns the credentials", func() {
+				success, credentials := elastic.GetCredentialsFromEnvironment()
+				Expect(success).To(BeTrue())
+				Expect(credentials).To(Equal(hooks.ElasticAPMCredentials{
+					ServiceName: "elastic-apm-service",
+					ServerURL:   "https://apm.example.com",
+					APIKey:      "sample_api_key",
+				}))
+			})
+		})
+
+		Context("Elastic APM defined in tags within VCAP_SERVICES", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "observability", "tags": ["ElasticAPM"], "credentials": {"server_url": "https://apm.example.com"}}]}`)
+			})
+
+			It("returns the credentials", func() {
+				success, credentials := elastic.GetCredentialsFromEnvironment()
+				Expect(success).To(BeTrue())
+				Expect(credentials.ServerURL).To(Equal("https://apm.example.com"))
+			})
+		})
+
+		Context("Elastic APM service without a server_url", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"elastic-apm": [{"name": "apm", "credentials": {"secret_token": "sample_secret_token"}}]}`)
+			})
+
+			It("returns no credentials", func() {
+				success, _ := elastic.GetCredentialsFromEnvironment()
+				Expect(success).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,243 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// EnvMappingsFile is read from the buildpack, then from the app. A mapping
+// in the app's file replaces the buildpack's mapping of the same name.
+const EnvMappingsFile = "env_mappings.yml"
+
+// EnvMapping exports variables from the credentials of the first binding
+// whose label, name or tags match. Env values are templates in which
+// {{credentials.<key>}} and {{app.<field>}} are replaced; a variable is only
+// exported when every value it refers to is present.
+type EnvMapping struct {
+	Name        string            `yaml:"name"`
+	Label       string            `yaml:"label"`
+	ServiceName string            `yaml:"service_name"`
+	Tags        []string          `yaml:"tags"`
+	Credentials []string          `yaml:"credentials"`
+	Env         map[string]string `yaml:"env"`
+}
+
+type EnvMappings struct {
+	Mappings []EnvMapping `yaml:"mappings"`
+}
+
+type EnvMappingsHook struct {
+	libbuildpack.DefaultHook
+	Log          *libbuildpack.Logger
+	BuildpackDir string
+}
+
+var (
+	envNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envTemplatePattern = regexp.MustCompile(`{{\s*([a-z]+)\.([^{}\s]+)\s*}}`)
+)
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, _ := libbuildpack.GetBuildpackDir()
+
+	libbuildpack.AddHook(EnvMappingsHook{
+		Log:          logger,
+		BuildpackDir: buildpackDir,
+	})
+}
+
+func (h EnvMappingsHook) AfterCompile(stager *libbuildpack.Stager) error {
+	mappings, err := h.LoadMappings(stager.BuildDir())
+	if err != nil {
+		h.Log.Error("Unable to read %s: %s", EnvMappingsFile, err.Error())
+		return err
+	}
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("Env mappings could not read service bindings: %s", err)
+	}
+
+	script := &profiled.Script{}
+	for _, m := range mappings {
+		query, err := m.query()
+		if err != nil {
+			return err
+		}
+
+		b, found := bindings.First(query)
+		if !found {
+			h.Log.Debug("No service bound for env mapping %s", m.Name)
+			continue
+		}
+
+		h.Log.Info("Exporting %s environment from service %s", m.Name, b.Name)
+		m.render(script, b, vcapApplication())
+	}
+
+	if script.Empty() && script.Err() == nil {
+		return nil
+	}
+	return profiled.Write(stager.DepDir(), "env_mappings.sh", script)
+}
+
+// LoadMappings returns the buildpack's mappings with the app's applied over
+// them. Either file may be missing.
+func (h EnvMappingsHook) LoadMappings(buildDir string) ([]EnvMapping, error) {
+	var paths []string
+	if h.BuildpackDir != "" {
+		paths = append(paths, filepath.Join(h.BuildpackDir, EnvMappingsFile))
+	}
+	paths = append(paths, filepath.Join(buildDir, EnvMappingsFile))
+
+	var mappings []EnvMapping
+	for _, path := range paths {
+		var file EnvMappings
+		if err := libbuildpack.NewYAML().Load(path, &file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, m := range file.Mappings {
+			if err := m.validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			mappings = replaceMapping(mappings, m)
+		}
+	}
+
+	return mappings, nil
+}
+
+func replaceMapping(mappings []EnvMapping, m EnvMapping) []EnvMapping {
+	for i := range mappings {
+		if mappings[i].Name == m.Name {
+			mappings[i] = m
+			return mappings
+		}
+	}
+	return append(mappings, m)
+}
+
+func (m EnvMapping) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("env mapping has no name")
+	}
+	if m.Label == "" && m.ServiceName == "" && len(m.Tags) == 0 {
+		return fmt.Errorf("env mapping %s has no label, service_name or tags to match", m.Name)
+	}
+	if _, err := m.query(); err != nil {
+		return err
+	}
+
+	for name, template := range m.Env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("env mapping %s: %q is not a valid variable name", m.Name, name)
+		}
+		for _, ref := range envTemplatePattern.FindAllStringSubmatch(template, -1) {
+			if ref[1] != "credentials" && ref[1] != "app" {
+				return fmt.Errorf("env mapping %s: %s refers to %s.%s, not to credentials or app", m.Name, name, ref[1], ref[2])
+			}
+			if ref[1] == "app" && appField(vcapApplicationInfo{}, ref[2]) == nil {
+				return fmt.Errorf("env mapping %s: %s refers to unknown field app.%s", m.Name, name, ref[2])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m EnvMapping) query() (binding.Query, error) {
+	var q binding.Query
+	var err error
+
+	if m.Label != "" {
+		if q.Label, err = regexp.Compile("(?i)" + m.Label); err != nil {
+			return binding.Query{}, fmt.Errorf("env mapping %s: invalid label: %w", m.Name, err)
+		}
+	}
+	if m.ServiceName != "" {
+		if q.Name, err = regexp.Compile("(?i)" + m.ServiceName); err != nil {
+			return binding.Query{}, fmt.Errorf("env mapping %s: invalid service_name: %w", m.Name, err)
+		}
+	}
+	if len(m.Tags) > 0 {
+		q.Tag = binding.Tagged(m.Tags...).Tag
+	}
+
+	return q.WithCredentials(m.Credentials...), nil
+}
+
+// render exports the mapping's variables, unless the app sets them itself.
+func (m EnvMapping) render(script *profiled.Script, b binding.Binding, app vcapApplicationInfo) {
+	names := make([]string, 0, len(m.Env))
+	for name := range m.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if value, ok := renderTemplate(m.Env[name], b, app); ok {
+			script.Default(name, value)
+		}
+	}
+}
+
+// renderTemplate renders template, reading credentials of bindings from
+// SERVICE_BINDING_ROOT at launch as credential does.
+func renderTemplate(template string, b binding.Binding, app vcapApplicationInfo) (profiled.Word, bool) {
+	var words []profiled.Word
+	last := 0
+
+	for _, ref := range envTemplatePattern.FindAllStringSubmatchIndex(template, -1) {
+		words = append(words, profiled.Literal(template[last:ref[0]]))
+		last = ref[1]
+
+		namespace, key := template[ref[2]:ref[3]], template[ref[4]:ref[5]]
+		if namespace == "credentials" {
+			if !b.Credentials.Has(key) {
+				return profiled.Word{}, false
+			}
+			words = append(words, credential(b, key))
+		} else if field := appField(app, key); field != nil && *field != "" {
+			words = append(words, profiled.Literal(*field))
+		} else {
+			return profiled.Word{}, false
+		}
+	}
+	words = append(words, profiled.Literal(template[last:]))
+
+	word := profiled.Concat(words...)
+	return word, !word.IsZero()
+}
+
+func appField(app vcapApplicationInfo, key string) *string {
+	switch key {
+	case "name":
+		return &app.Name
+	case "id":
+		return &app.ID
+	case "version":
+		return &app.Version
+	case "space":
+		return &app.Space
+	case "org":
+		return &app.Org
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package hooks_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EnvMappingsHook", func() {
+	var (
+		err          error
+		buildDir     string
+		depsDir      string
+		depsIdx      string
+		buildpackDir string
+		buffer       *bytes.Buffer
+		logger       *libbuildpack.Logger
+		stager       *libbuildpack.Stager
+		envMappings  hooks.EnvMappingsHook
+	)
+
+	profileScript := func() string {
+		contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "env_mappings.sh"))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buildpackDir, err = os.MkdirTemp("", "nodejs-buildpack.buildpack.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsIdx = "06"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		Expect(os.WriteFile(filepath.Join(buildpackDir, hooks.EnvMappingsFile), []byte(`---
+mappings:
+- name: acme
+  label: acme-?apm
+  tags: [acme]
+  credentials: [token]
+  env:
+    ACME_TOKEN: "{{credentials.token}}"
+    ACME_URL: "https://{{credentials.host}}/ingest"
+    ACME_APP: "{{app.name}} ({{app.space}})"
+`), 0644)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		envMappings = hooks.EnvMappingsHook{
+			Log:          logger,
+			BuildpackDir: buildpackDir,
+		}
+
+		os.Setenv("VCAP_APPLICATION", `{"application_name": "orders", "space_name": "it's prod"}`)
+	})
+
+	JustBeforeEach(func() {
+		stager = libbuildpack.NewStager([]string{buildDir, "", depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+		os.Unsetenv("SERVICE_BINDING_ROOT")
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+	})
+
+	Context("with a matching service", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"acme-apm": [{"name": "apm", "credentials": {"token": "s3cr3t", "host": "acme.example.com"}}]}`)
+		})
+
+		It("exports the mapped variables", func() {
+			Expect(envMappings.AfterCompile(stager)).To(Succeed())
+			Expect(profileScript()).To(Equal(`export ACME_APP=${ACME_APP:-'orders (it'"'"'s prod)'}
+export ACME_TOKEN=${ACME_TOKEN:-'s3cr3t'}
+export ACME_URL=${ACME_URL:-'https://acme.example.com/ingest'}
+`))
+			Expect(buffer.String()).To(ContainSubstring("Exporting acme environment from service apm"))
+		})
+	})
+
+	Context("with a service missing an optional credential", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "apm", "tags": ["ACME"], "credentials": {"token": "s3cr3t"}}]}`)
+		})
+
+		It("leaves out the variables that refer to it", func() {
+			Expect(envMappings.AfterCompile(stager)).To(Succeed())
+			Expect(profileScript()).NotTo(ContainSubstring("ACME_URL"))
+			Expect(profileScript()).To(ContainSubstring("export ACME_TOKEN=${ACME_TOKEN:-'s3cr3t'}"))
+		})
+	})
+
+	Context("with a service missing a required credential", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"acme-apm": [{"name": "apm", "credentials": {"host": "acme.example.com"}}]}`)
+		})
+
+		It("does not write a profile.d script", func() {
+			Expect(envMappings.AfterCompile(stager)).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "env_mappings.sh")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("with a service under SERVICE_BINDING_ROOT", func() {
+		var bindingRoot string
+
+		BeforeEach(func() {
+			bindingRoot, err = os.MkdirTemp("", "nodejs-buildpack.bindings.")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(bindingRoot, "apm"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "apm", "type"), []byte("acme-apm"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "apm", "token"), []byte("s3cr3t"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "apm", "host"), []byte("acme.example.com"), 0644)).To(Succeed())
+
+			os.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(bindingRoot)).To(Succeed())
+		})
+
+		It("reads the credentials at launch", func() {
+			Expect(envMappings.AfterCompile(stager)).To(Succeed())
+			Expect(profileScript()).To(ContainSubstring(`export ACME_TOKEN=${ACME_TOKEN:-"$(cat "$SERVICE_BINDING_ROOT"/'apm'/'token')"}`))
+			Expect(profileScript()).To(ContainSubstring(`export ACME_URL=${ACME_URL:-"https://$(cat "$SERVICE_BINDING_ROOT"/'apm'/'host')/ingest"}`))
+			Expect(profileScript()).NotTo(ContainSubstring("s3cr3t"))
+		})
+	})
+
+	Describe("LoadMappings", func() {
+		It("applies the app's mappings over the buildpack's", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, hooks.EnvMappingsFile), []byte(`---
+mappings:
+- name: acme
+  service_name: acme
+  env:
+    ACME_KEY: "{{credentials.key}}"
+- name: widgets
+  tags: [widgets]
+  env:
+    WIDGETS_URL: "{{credentials.url}}"
+`), 0644)).To(Succeed())
+
+			mappings, err := envMappings.LoadMappings(buildDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mappings).To(Equal([]hooks.EnvMapping{
+				{Name: "acme", ServiceName: "acme", Env: map[string]string{"ACME_KEY": "{{credentials.key}}"}},
+				{Name: "widgets", Tags: []string{"widgets"}, Env: map[string]string{"WIDGETS_URL": "{{credentials.url}}"}},
+			}))
+		})
+
+		DescribeTable("rejects invalid mappings",
+			func(mapping, message string) {
+				Expect(os.WriteFile(filepath.Join(buildDir, hooks.EnvMappingsFile), []byte("mappings:\n"+mapping), 0644)).To(Succeed())
+
+				_, err := envMappings.LoadMappings(buildDir)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("without a name", "- label: acme\n", "env mapping has no name"),
+			Entry("without anything to match", "- name: acme\n", "env mapping acme has no label, service_name or tags to match"),
+			Entry("with an invalid label", "- name: acme\n  label: '('\n", "env mapping acme: invalid label"),
+			Entry("with an invalid variable name", "- name: acme\n  label: acme\n  env:\n    ACME-KEY: x\n", `env mapping acme: "ACME-KEY" is not a valid variable name`),
+			Entry("with an unknown reference", "- name: acme\n  label: acme\n  env:\n    ACME_KEY: '{{vcap.key}}'\n", "env mapping acme: ACME_KEY refers to vcap.key, not to credentials or app"),
+			Entry("with an unknown app field", "- name: acme\n  label: acme\n  env:\n    ACME_URI: '{{app.uri}}'\n", "env mapping acme: ACME_URI refers to unknown field app.uri"),
+		)
+
+		It("loads the mappings shipped with the buildpack", func() {
+			envMappings.BuildpackDir = filepath.Join("..", "..", "..")
+
+			mappings, err := envMappings.LoadMappings(buildDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mappings).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package hooks
+
+import (
+	"os"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type NewRelicHook struct {
+	libbuildpack.DefaultHook
+	Log *libbuildpack.Logger
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+
+	libbuildpack.AddHook(NewRelicHook{
+		Log: logger,
+	})
+}
+
+func (h NewRelicHook) AfterCompile(stager *libbuildpack.Stager) error {
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("New Relic could not read service bindings: %s", err)
+	}
+
+	b, found := bindings.First(binding.Matching("new-?relic").WithCredentials("licenseKey"))
+	if !found {
+		h.Log.Debug("New Relic service not bound")
+		return nil
+	}
+
+	h.Log.Info("New Relic service %s found. Configuring environment.", b.Name)
+
+	return profiled.Write(stager.DepDir(), "newrelic.sh", h.profileScript(b))
+}
+
+// profileScript exports the license key of the binding and names the app
+// after the Cloud Foundry app, unless the app sets either itself.
+func (h NewRelicHook) profileScript(b binding.Binding) *profiled.Script {
+	script := &profiled.Script{}
+	script.Default("NEW_RELIC_LICENSE_KEY", credential(b, "licenseKey"))
+
+	if app := vcapApplication(); app.Name != "" {
+		script.Default("NEW_RELIC_APP_NAME", profiled.Literal(app.Name+"_"+app.ID))
+	}
+
+	return script
+}
@@ -0,0 +1,114 @@
+package hooks_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewRelicHook", func() {
+	var (
+		err      error
+		depsDir  string
+		depsIdx  string
+		buffer   *bytes.Buffer
+		logger   *libbuildpack.Logger
+		stager   *libbuildpack.Stager
+		newrelic hooks.NewRelicHook
+	)
+
+	profileScript := filepath.Join("profile.d", "newrelic.sh")
+
+	BeforeEach(func() {
+		depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsIdx = "02"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		newrelic = hooks.NewRelicHook{
+			Log: logger,
+		}
+
+		os.Setenv("VCAP_APPLICATION", `{"application_name": "orders", "application_id": "1234"}`)
+	})
+
+	JustBeforeEach(func() {
+		stager = libbuildpack.NewStager([]string{"", "", depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	Context("without a New Relic service", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "newrelic-staging", "credentials": {}}]}`)
+		})
+
+		It("does not write a profile.d script", func() {
+			Expect(newrelic.AfterCompile(stager)).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, profileScript)).NotTo(BeAnExistingFile())
+		})
+	})
+
+	DescribeTable("writes the license key and app name",
+		func(services string) {
+			os.Setenv("VCAP_SERVICES", services)
+
+			Expect(newrelic.AfterCompile(stager)).To(Succeed())
+
+			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, profileScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(`export NEW_RELIC_LICENSE_KEY=${NEW_RELIC_LICENSE_KEY:-'some-newrelic-key'}
+export NEW_RELIC_APP_NAME=${NEW_RELIC_APP_NAME:-'orders_1234'}
+`))
+			Expect(buffer.String()).To(ContainSubstring("New Relic service"))
+		},
+		Entry("by label", `{"newrelic": [{"name": "apm", "credentials": {"licenseKey": "some-newrelic-key"}}]}`),
+		Entry("by name", `{"user-provided": [{"name": "newrelic-service", "credentials": {"licenseKey": "some-newrelic-key"}}]}`),
+		Entry("by tag", `{"user-provided": [{"name": "apm", "tags": ["New-Relic"], "credentials": {"licenseKey": "some-newrelic-key"}}]}`),
+	)
+
+	Context("with a New Relic service under SERVICE_BINDING_ROOT", func() {
+		var bindingRoot string
+
+		BeforeEach(func() {
+			bindingRoot, err = os.MkdirTemp("", "nodejs-buildpack.bindings.")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(bindingRoot, "apm"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "apm", "type"), []byte("newrelic"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(bindingRoot, "apm", "licenseKey"), []byte("some-newrelic-key"), 0644)).To(Succeed())
+
+			os.Setenv("SERVICE_BINDING_ROOT", bindingRoot)
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("SERVICE_BINDING_ROOT")
+			Expect(os.RemoveAll(bindingRoot)).To(Succeed())
+		})
+
+		It("reads the license key from the binding at launch", func() {
+			Expect(newrelic.AfterCompile(stager)).To(Succeed())
+
+			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, profileScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(`export NEW_RELIC_LICENSE_KEY=${NEW_RELIC_LICENSE_KEY:-"$(cat "$SERVICE_BINDING_ROOT"/'apm'/'licenseKey')"}
+export NEW_RELIC_APP_NAME=${NEW_RELIC_APP_NAME:-'orders_1234'}
+`))
+			Expect(string(contents)).NotTo(ContainSubstring("some-newrelic-key"))
+		})
+	})
+})
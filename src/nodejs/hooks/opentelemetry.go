@@ -0,0 +1,137 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const (
+	// OpenTelemetryEnv, when true, instruments the app without a bound
+	// service, for apps that set OTEL_* themselves.
+	OpenTelemetryEnv     = "NODE_OPENTELEMETRY"
+	OpenTelemetryPackage = "@opentelemetry/auto-instrumentations-node"
+	OpenTelemetryTarball = "auto-instrumentations-node.tgz"
+)
+
+var openTelemetryAgent = nodeAgent{
+	Package: OpenTelemetryPackage,
+	Require: OpenTelemetryPackage + "/register",
+	Dir:     "opentelemetry",
+	Tarball: OpenTelemetryTarball,
+}
+
+var openTelemetryTags = []string{"otel", "opentelemetry"}
+
+type OpenTelemetryHook struct {
+	libbuildpack.DefaultHook
+	Log          *libbuildpack.Logger
+	Command      Command
+	BuildpackDir string
+}
+
+type OpenTelemetryBinding struct {
+	Name     string
+	Endpoint string
+	Headers  string
+	Protocol string
+}
+
+func init() {
+	logger := libbuildpack.NewLogger(os.Stdout)
+	buildpackDir, _ := libbuildpack.GetBuildpackDir()
+
+	libbuildpack.AddHook(&OpenTelemetryHook{
+		Log:          logger,
+		Command:      &libbuildpack.Command{},
+		BuildpackDir: buildpackDir,
+	})
+}
+
+func (h *OpenTelemetryHook) AfterCompile(stager *libbuildpack.Stager) error {
+	b, found := h.findBinding()
+	if !found && os.Getenv(OpenTelemetryEnv) != "true" {
+		h.Log.Debug("OpenTelemetry service not bound and %s not set", OpenTelemetryEnv)
+		return nil
+	}
+
+	if found {
+		h.Log.BeginStep("Configuring OpenTelemetry for service %s", b.Name)
+		if !b.Credentials.Has("endpoint") {
+			h.Log.Warning("OpenTelemetry service %s has no endpoint, traces are exported to the OTLP default", b.Name)
+		}
+	} else {
+		h.Log.BeginStep("Configuring OpenTelemetry")
+	}
+
+	if err := openTelemetryAgent.install(h.Log, h.Command, h.BuildpackDir, stager); err != nil {
+		return err
+	}
+
+	return profiled.Write(stager.DepDir(), "opentelemetry.sh", h.profileScript(stager, b))
+}
+
+// GetBinding returns the first service tagged otel or opentelemetry, or nil
+// when none is bound.
+func (h *OpenTelemetryHook) GetBinding() *OpenTelemetryBinding {
+	b, found := h.findBinding()
+	if !found {
+		return nil
+	}
+
+	return &OpenTelemetryBinding{
+		Name:     b.Name,
+		Endpoint: b.Credentials.String("endpoint"),
+		Headers:  otlpHeaders(b.Credentials),
+		Protocol: b.Credentials.String("protocol"),
+	}
+}
+
+func (h *OpenTelemetryHook) findBinding() (binding.Binding, bool) {
+	bindings, err := binding.Load()
+	if err != nil {
+		h.Log.Debug("Failed to read service bindings: %s", err)
+	}
+
+	return bindings.First(binding.Tagged(openTelemetryTags...))
+}
+
+// otlpHeaders accepts headers as the "key=value,key=value" string that
+// OTEL_EXPORTER_OTLP_HEADERS takes, or as an object.
+func otlpHeaders(credentials binding.Credentials) string {
+	headers, ok := credentials.Map("headers")
+	if !ok {
+		return credentials.String("headers")
+	}
+
+	pairs := make([]string, 0, len(headers))
+	for key, value := range headers {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h *OpenTelemetryHook) profileScript(stager *libbuildpack.Stager, b binding.Binding) *profiled.Script {
+	// headers given as an object are rewritten, so they cannot be read at
+	// launch
+	headers := credential(b, "headers")
+	if _, ok := b.Credentials.Map("headers"); ok {
+		headers = profiled.Literal(otlpHeaders(b.Credentials))
+	}
+
+	// variables the app sets itself take precedence over the binding
+	script := &profiled.Script{}
+	openTelemetryAgent.nodeOptions(stager, script)
+	script.Default("OTEL_SERVICE_NAME", profiled.Literal(vcapApplication().Name))
+	script.Default("OTEL_EXPORTER_OTLP_ENDPOINT", credential(b, "endpoint"))
+	script.Default("OTEL_EXPORTER_OTLP_HEADERS", headers)
+	script.Default("OTEL_EXPORTER_OTLP_PROTOCOL", credential(b, "protocol"))
+	return script
+}
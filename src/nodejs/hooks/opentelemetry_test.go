@@ -0,0 +1,220 @@
+package hooks_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenTelemetryHook", func() {
+	var (
+		err          error
+		buildDir     string
+		cacheDir     string
+		depsDir      string
+		depsIdx      string
+		buildpackDir string
+		logger       *libbuildpack.Logger
+		buffer       *bytes.Buffer
+		stager       *libbuildpack.Stager
+		mockCtrl     *gomock.Controller
+		mockCommand  *MockCommand
+		otel         *hooks.OpenTelemetryHook
+	)
+
+	profileScript := func() string {
+		contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "opentelemetry.sh"))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	writeTarball := func(dir ...string) string {
+		tarball := filepath.Join(append(dir, hooks.OpenTelemetryTarball)...)
+		Expect(os.MkdirAll(filepath.Dir(tarball), 0755)).To(Succeed())
+		Expect(os.WriteFile(tarball, []byte("tgz"), 0644)).To(Succeed())
+		return tarball
+	}
+
+	latestVersion := func(version string, err error) *gomock.Call {
+		return mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "view", "@opentelemetry/auto-instrumentations-node", "version").
+			DoAndReturn(func(dir string, stdout, stderr io.Writer, program string, args ...string) error {
+				fmt.Fprintln(stdout, version)
+				return err
+			})
+	}
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDir, err = os.MkdirTemp("", "nodejs-buildpack.cache.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buildpackDir, err = os.MkdirTemp("", "nodejs-buildpack.buildpack.")
+		Expect(err).NotTo(HaveOccurred())
+
+		depsIdx = "04"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		otel = &hooks.OpenTelemetryHook{
+			Log:          logger,
+			Command:      mockCommand,
+			BuildpackDir: buildpackDir,
+		}
+
+		os.Setenv("VCAP_APPLICATION", `{"application_name": "orders"}`)
+		os.Setenv("VCAP_SERVICES", `{}`)
+	})
+
+	JustBeforeEach(func() {
+		stager = libbuildpack.NewStager([]string{buildDir, cacheDir, depsDir, depsIdx}, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		os.Unsetenv("VCAP_APPLICATION")
+		os.Unsetenv("VCAP_SERVICES")
+		os.Unsetenv(hooks.OpenTelemetryEnv)
+
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+	})
+
+	Context("without a binding or NODE_OPENTELEMETRY", func() {
+		It("does nothing", func() {
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "opentelemetry.sh")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("with a service tagged otel", func() {
+		var tarball string
+
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{
+  "user-provided": [
+    {"name": "logs", "tags": ["syslog"], "credentials": {"endpoint": "https://logs.example.com"}},
+    {
+      "name": "collector",
+      "tags": ["OTel"],
+      "credentials": {
+        "endpoint": "https://otlp.example.com:4318",
+        "headers": {"x-tenant": "shop", "authorization": "Bearer it's-secret"},
+        "protocol": "http/protobuf"
+      }
+    }
+  ]
+}`)
+			tarball = writeTarball(cacheDir, "opentelemetry", "0.50.0")
+		})
+
+		It("installs the cached tarball and maps the binding to OTEL_ variables", func() {
+			latestVersion("0.50.0", nil)
+			installDir := filepath.Join(depsDir, depsIdx, "opentelemetry")
+			mockCommand.EXPECT().Execute(installDir, gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", installDir, tarball)
+
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+
+			register, err := os.ReadFile(filepath.Join(installDir, "register.js"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(register)).To(Equal("require('@opentelemetry/auto-instrumentations-node/register');\n"))
+
+			Expect(profileScript()).To(Equal(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/04/opentelemetry/register.js"
+export OTEL_SERVICE_NAME=${OTEL_SERVICE_NAME:-'orders'}
+export OTEL_EXPORTER_OTLP_ENDPOINT=${OTEL_EXPORTER_OTLP_ENDPOINT:-'https://otlp.example.com:4318'}
+export OTEL_EXPORTER_OTLP_HEADERS=${OTEL_EXPORTER_OTLP_HEADERS:-'authorization=Bearer it'"'"'s-secret,x-tenant=shop'}
+export OTEL_EXPORTER_OTLP_PROTOCOL=${OTEL_EXPORTER_OTLP_PROTOCOL:-'http/protobuf'}
+`))
+			Expect(buffer.String()).To(ContainSubstring("Configuring OpenTelemetry for service collector"))
+		})
+
+		It("prefers a tarball bundled with the buildpack", func() {
+			bundled := writeTarball(buildpackDir, "opentelemetry")
+			mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", gomock.Any(), bundled)
+
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+		})
+
+		It("uses the cached tarball when the registry cannot be reached", func() {
+			latestVersion("", fmt.Errorf("exit status 1"))
+			mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", gomock.Any(), tarball)
+
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Unable to look up the latest version of @opentelemetry/auto-instrumentations-node, using the cached one"))
+		})
+
+		It("returns an error when the install fails", func() {
+			latestVersion("0.50.0", nil)
+			mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", gomock.Any()).Return(fmt.Errorf("exit status 1"))
+
+			Expect(otel.AfterCompile(stager)).To(MatchError("exit status 1"))
+		})
+	})
+
+	Context("with NODE_OPENTELEMETRY and no tarball", func() {
+		BeforeEach(func() {
+			os.Setenv(hooks.OpenTelemetryEnv, "true")
+		})
+
+		It("downloads the package into the cache and leaves the exporter to the app", func() {
+			packDir := filepath.Join(cacheDir, "opentelemetry", "0.50.0")
+			cached := filepath.Join(packDir, hooks.OpenTelemetryTarball)
+
+			gomock.InOrder(
+				latestVersion("0.50.0", nil),
+				mockCommand.EXPECT().Execute(packDir, gomock.Any(), gomock.Any(), "npm", "pack", "@opentelemetry/auto-instrumentations-node@0.50.0", "--pack-destination", packDir).
+					DoAndReturn(func(dir string, stdout, stderr io.Writer, program string, args ...string) error {
+						fmt.Fprintln(stdout, "opentelemetry-auto-instrumentations-node-0.50.0.tgz")
+						return os.WriteFile(filepath.Join(dir, "opentelemetry-auto-instrumentations-node-0.50.0.tgz"), []byte("tgz"), 0644)
+					}),
+				mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", gomock.Any(), cached),
+			)
+
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+			Expect(cached).To(BeAnExistingFile())
+			Expect(profileScript()).To(Equal(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/04/opentelemetry/register.js"
+export OTEL_SERVICE_NAME=${OTEL_SERVICE_NAME:-'orders'}
+`))
+		})
+
+		It("replaces a cached tarball of an older version", func() {
+			old := writeTarball(cacheDir, "opentelemetry", "0.49.0")
+			packDir := filepath.Join(cacheDir, "opentelemetry", "0.50.0")
+
+			gomock.InOrder(
+				latestVersion("0.50.0", nil),
+				mockCommand.EXPECT().Execute(packDir, gomock.Any(), gomock.Any(), "npm", "pack", "@opentelemetry/auto-instrumentations-node@0.50.0", "--pack-destination", packDir).
+					DoAndReturn(func(dir string, stdout, stderr io.Writer, program string, args ...string) error {
+						fmt.Fprintln(stdout, "opentelemetry-auto-instrumentations-node-0.50.0.tgz")
+						return os.WriteFile(filepath.Join(dir, "opentelemetry-auto-instrumentations-node-0.50.0.tgz"), []byte("tgz"), 0644)
+					}),
+				mockCommand.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), "npm", "install", "--no-save", "--no-package-lock", "--prefix", gomock.Any(), filepath.Join(packDir, hooks.OpenTelemetryTarball)),
+			)
+
+			Expect(otel.AfterCompile(stager)).To(Succeed())
+			Expect(old).NotTo(BeAnExistingFile())
+			Expect(buffer.String()).To(ContainSubstring("Downloading @opentelemetry/auto-instrumentations-node 0.50.0"))
+		})
+	})
+})
@@ -12,6 +12,11 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/download"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -27,6 +32,20 @@ const DefaultVersion = "latest"
 const DefaultPackage = "slnodejs"
 const AgentPackageVersionFormat = "%s@%s"
 const AgentRecommendedVersionUrlFormat = "https://%s.sealights.co/api/v2/agents/slnodejs/recommended"
+const AgentTarball = "slnodejs.tgz"
+
+// CustomAgentSha256Env pins the sha256 of the customAgentUrl tarball; it takes
+// precedence over the customAgentSha256 parameter of the service.
+const CustomAgentSha256Env = "SL_CUSTOM_AGENT_SHA256"
+
+// AgentSha256Env pins the sha256 of the slnodejs tarball from the npm
+// registry; it takes precedence over the agentSha256 parameter of the service.
+const AgentSha256Env = "SL_AGENT_SHA256"
+
+// NpmRegistryEnv is the registry npm installs from, which the agent is
+// downloaded from as well.
+const NpmRegistryEnv = "NPM_CONFIG_REGISTRY"
+const DefaultNpmRegistry = "https://registry.npmjs.org"
 
 type Command interface {
 	Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error
@@ -42,8 +61,10 @@ type SealightsHook struct {
 	Log        *libbuildpack.Logger
 	Command    Command
 	HttpClient HttpClient
+	Downloader *download.Downloader
 
 	parameters  *SealightsParameters
+	binding     binding.Binding
 	initialized bool
 }
 
@@ -54,6 +75,8 @@ type SealightsParameters struct {
 	BuildSessionIdFile string
 	LabId              string
 	CustomAgentUrl     string
+	CustomAgentSha256  string
+	AgentSha256        string
 	Version            string
 	Proxy              string
 	ProxyUsername      string
@@ -235,13 +258,12 @@ func (sl *SealightsHook) ExtractNpmRunScriptName(command string) (string, error)
 	return "", fmt.Errorf("failed to extract npm script name from command: %s", command)
 }
 
-func (sl *SealightsHook) ValidateNpmRunScript(packageJson map[string]interface{}, scriptName string) error {
-	scripts, ok := packageJson["scripts"].(map[string]interface{})
-	if !ok || scripts == nil {
+func (sl *SealightsHook) ValidateNpmRunScript(packageJson package_json.PackageJSON, scriptName string) error {
+	if packageJson.Scripts == nil {
 		return fmt.Errorf("no scripts section found in package.json")
 	}
 	
-	if _, exists := scripts[scriptName]; !exists {
+	if _, exists := packageJson.Scripts[scriptName]; !exists {
 		return fmt.Errorf("script '%s' not found in package.json", scriptName)
 	}
 	
@@ -339,8 +361,7 @@ func (sl *SealightsHook) SetApplicationStartInPackageJson(stager *libbuildpack.S
 		}
 	}
 	
-	scripts := packageJson["scripts"].(map[string]interface{})
-	originalStartScript, _ := scripts[targetScript].(string)
+	originalStartScript := packageJson.Scripts[targetScript]
 	if originalStartScript == "" {
 		return fmt.Errorf("failed to read %s script from %s", targetScript, PackageJsonFile)
 	}
@@ -352,10 +373,12 @@ func (sl *SealightsHook) SetApplicationStartInPackageJson(stager *libbuildpack.S
 		return err
 	}
 	
-	sl.Log.Debug("Injecting Sealights into '%s' script: %s -> %s", targetScript, originalStartScript, newCmd)
-	scripts[targetScript] = newCmd
+	sl.Log.Debug("Injecting Sealights into '%s' script: %s -> %s", targetScript, originalStartScript, sl.binding.Redact(newCmd))
+	if err = packageJson.SetScript(targetScript, newCmd); err != nil {
+		return err
+	}
 
-	err = libbuildpack.NewJSON().Write(filepath.Join(stager.BuildDir(), PackageJsonFile), packageJson)
+	err = packageJson.Write(filepath.Join(stager.BuildDir(), PackageJsonFile))
 	if err != nil {
 		sl.Log.Error("failed to update %s, error: %s", PackageJsonFile, err.Error())
 		return err
@@ -364,14 +387,11 @@ func (sl *SealightsHook) SetApplicationStartInPackageJson(stager *libbuildpack.S
 	return nil
 }
 
-func (sl *SealightsHook) ReadPackageJson(stager *libbuildpack.Stager) (map[string]interface{}, error) {
-	p := map[string]interface{}{}
-
-	if err := libbuildpack.NewJSON().Load(filepath.Join(stager.BuildDir(), PackageJsonFile), &p); err != nil {
-		if err != nil {
-			sl.Log.Error("failed to read %s error: %s", PackageJsonFile, err.Error())
-			return nil, err
-		}
+func (sl *SealightsHook) ReadPackageJson(stager *libbuildpack.Stager) (package_json.PackageJSON, error) {
+	p, err := package_json.Load(filepath.Join(stager.BuildDir(), PackageJsonFile))
+	if err != nil {
+		sl.Log.Error("failed to read %s error: %s", PackageJsonFile, err.Error())
+		return package_json.PackageJSON{}, err
 	}
 	return p, nil
 }
@@ -435,7 +455,7 @@ func (sl *SealightsHook) updateStartCommand(originalCommand string) (string, err
 		return "", err
 	}
 	newCmd := sl.createAppStartCommandLine(o)
-	sl.Log.Debug("new start script: %s", newCmd)
+	sl.Log.Debug("new start script: %s", sl.binding.Redact(newCmd))
 	return newCmd, nil
 }
 
@@ -452,8 +472,44 @@ func (sl *SealightsHook) ReadManifestFile(stager *libbuildpack.Stager, y *libbui
 
 func (sl *SealightsHook) installAgent(stager *libbuildpack.Stager) error {
 	packageName, source := sl.getPackageName()
+	args := []string{"install", packageName}
+
+	tmpDir, err := os.MkdirTemp("", "sealights")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	// the tarball is removed after the install, so package.json and the
+	// lockfile must not refer to it
+	tarball := filepath.Join(tmpDir, AgentTarball)
+
+	if strings.HasPrefix(packageName, "http://") || strings.HasPrefix(packageName, "https://") {
+		checksum := os.Getenv(CustomAgentSha256Env)
+		if checksum == "" {
+			checksum = sl.parameters.CustomAgentSha256
+		}
+		if err := sl.downloadAgent(stager, packageName, checksum, tarball); err != nil {
+			sl.Log.Error("downloading %s failed with error: %s", AgentTarball, err.Error())
+			return err
+		}
+		args = []string{"install", "--no-save", tarball}
+	} else if version, found := strings.CutPrefix(packageName, DefaultPackage+"@"); found {
+		checksum := os.Getenv(AgentSha256Env)
+		if checksum == "" {
+			checksum = sl.parameters.AgentSha256
+		}
+		if err := sl.downloadFromRegistry(stager, version, checksum, tarball); err == nil {
+			args = []string{"install", "--no-save", tarball}
+		} else if checksum != "" {
+			sl.Log.Error("downloading %s failed with error: %s", packageName, err.Error())
+			return err
+		} else {
+			sl.Log.Warning("downloading %s failed, so npm installs it instead: %s", packageName, err.Error())
+		}
+	}
+
 	sl.Log.Info("npm install %s\nversion source: %s", packageName, source)
-	err := sl.Command.Execute(stager.BuildDir(), os.Stdout, os.Stderr, "npm", "install", packageName)
+	err = sl.Command.Execute(stager.BuildDir(), os.Stdout, os.Stderr, "npm", args...)
 	if err != nil {
 		sl.Log.Error("npm install %s failed with error: %s", packageName, err.Error())
 		return err
@@ -462,6 +518,82 @@ func (sl *SealightsHook) installAgent(stager *libbuildpack.Stager) error {
 	return nil
 }
 
+// downloadAgent fetches the agent tarball itself rather than leaving it to
+// npm, so that it is verified and cached between stages.
+func (sl *SealightsHook) downloadAgent(stager *libbuildpack.Stager, agentUrl string, checksum string, dest string) error {
+	downloader, err := sl.downloader(stager)
+	if err != nil {
+		return err
+	}
+
+	return downloader.Fetch(download.Artifact{URL: agentUrl, SHA256: checksum}, dest)
+}
+
+// downloadFromRegistry fetches the tarball of an slnodejs version, or of a
+// dist-tag such as latest, from the npm registry.
+func (sl *SealightsHook) downloadFromRegistry(stager *libbuildpack.Stager, version string, checksum string, dest string) error {
+	downloader, err := sl.downloader(stager)
+	if err != nil {
+		return err
+	}
+
+	registry := os.Getenv(NpmRegistryEnv)
+	if registry == "" {
+		registry = os.Getenv(strings.ToLower(NpmRegistryEnv))
+	}
+	if registry == "" {
+		registry = DefaultNpmRegistry
+	}
+	manifestUrl := strings.TrimSuffix(registry, "/") + "/" + DefaultPackage + "/" + url.PathEscape(version)
+
+	resp, err := downloader.Client.Get(manifestUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &download.StatusError{URL: manifestUrl, Code: resp.StatusCode}
+	}
+
+	var manifest struct {
+		Version string `json:"version"`
+		Dist    struct {
+			Tarball string `json:"tarball"`
+		} `json:"dist"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return fmt.Errorf("reading %s: %w", manifestUrl, err)
+	}
+	if manifest.Dist.Tarball == "" {
+		return fmt.Errorf("%s has no tarball", manifestUrl)
+	}
+
+	sl.Log.Info("Using %s %s from %s", DefaultPackage, manifest.Version, registry)
+	return downloader.Fetch(download.Artifact{URL: manifest.Dist.Tarball, SHA256: checksum}, dest)
+}
+
+func (sl *SealightsHook) downloader(stager *libbuildpack.Stager) (*download.Downloader, error) {
+	if sl.Downloader != nil {
+		return sl.Downloader, nil
+	}
+
+	transport, err := download.NewTransport()
+	if err != nil {
+		return nil, err
+	}
+	if sl.parameters.Proxy != "" {
+		transport.Proxy = sl.proxy()
+	}
+
+	sl.Downloader = &download.Downloader{
+		Log:      sl.Log,
+		Client:   download.NewClient(transport),
+		Retry:    retry.Default(sl.Log),
+		CacheDir: stager.CacheDir(),
+	}
+	return sl.Downloader, nil
+}
+
 func (sl *SealightsHook) createAppStartCommandLine(o *SealightsRunOptions) string {
 	var sb strings.Builder
 	sb.WriteString("./node_modules/.bin/slnodejs run  --useinitialcolor true ")
@@ -548,55 +680,43 @@ func (sl *SealightsHook) parseVcapServices() {
 		sl.initialized = true
 	}
 
-	var vcapServices map[string][]struct {
-		Name        string                 `json:"name"`
-		Credentials map[string]interface{} `json:"credentials"`
+	bindings, err := binding.Load()
+	if err != nil {
+		sl.Log.Debug("Failed to read service bindings: %s", err)
 	}
 
-	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
-		sl.Log.Debug("Failed to unmarshal VCAP_SERVICES: %s", err)
+	b, found := bindings.First(binding.Named("sealights"))
+	if !found {
 		return
 	}
 
-	for _, services := range vcapServices {
-		for _, service := range services {
-			if !strings.Contains(strings.ToLower(service.Name), "sealights") {
-				continue
-			}
-
-			queryString := func(key string) string {
-				if value, ok := service.Credentials[key].(string); ok {
-					return value
-				}
-				return ""
-			}
-
-			options := &SealightsParameters{
-				Token:              queryString("token"),
-				TokenFile:          queryString("tokenFile"),
-				BuildSessionId:     queryString("buildSessionId"),
-				BuildSessionIdFile: queryString("buildSessionIdFile"),
-				LabId:              queryString("labId"),
-				Version:            queryString("version"),
-				CustomAgentUrl:     queryString("customAgentUrl"),
-				Proxy:              queryString("proxy"),
-				ProxyUsername:      queryString("proxyUsername"),
-				ProxyPassword:      queryString("proxyPassword"),
-				ProjectRoot:        queryString("projectRoot"),
-				TestStage:          queryString("testStage"),
-				NpmRunScript:       queryString("npmRunScript"),
-			}
+	sl.binding = b
+	queryString := b.Credentials.String
 
-			// write warning in case token is not provided
-			if options.Token != "" && options.TokenFile != "" {
-				sl.Log.Warning("Sealights access token isn't provided")
-			}
+	options := &SealightsParameters{
+		Token:              queryString("token"),
+		TokenFile:          queryString("tokenFile"),
+		BuildSessionId:     queryString("buildSessionId"),
+		BuildSessionIdFile: queryString("buildSessionIdFile"),
+		LabId:              queryString("labId"),
+		Version:            queryString("version"),
+		CustomAgentUrl:     queryString("customAgentUrl"),
+		CustomAgentSha256:  queryString("customAgentSha256"),
+		AgentSha256:        queryString("agentSha256"),
+		Proxy:              queryString("proxy"),
+		ProxyUsername:      queryString("proxyUsername"),
+		ProxyPassword:      queryString("proxyPassword"),
+		ProjectRoot:        queryString("projectRoot"),
+		TestStage:          queryString("testStage"),
+		NpmRunScript:       queryString("npmRunScript"),
+	}
 
-			sl.parameters = options
-			return
-		}
+	// write warning in case token is not provided
+	if options.Token != "" && options.TokenFile != "" {
+		sl.Log.Warning("Sealights access token isn't provided")
 	}
 
+	sl.parameters = options
 }
 
 func (sl *SealightsHook) getPackageName() (string, string) {
@@ -663,15 +783,9 @@ func (sl *SealightsHook) createHttpClient() HttpClient {
 	}
 
 	if sl.parameters.Proxy != "" {
-		proxyUrl, _ := url.Parse(sl.parameters.Proxy)
-
 		sl.HttpClient = &http.Client{
 			Transport: &http.Transport{
-				Proxy: http.ProxyURL(&url.URL{
-					Scheme: proxyUrl.Scheme,
-					User:   url.UserPassword(sl.parameters.ProxyUsername, sl.parameters.ProxyPassword),
-					Host:   proxyUrl.Host,
-				}),
+				Proxy: sl.proxy(),
 			},
 		}
 		return sl.HttpClient
@@ -681,6 +795,17 @@ func (sl *SealightsHook) createHttpClient() HttpClient {
 	}
 }
 
+// proxy returns the proxy configured by the proxy parameters of the service.
+func (sl *SealightsHook) proxy() func(*http.Request) (*url.URL, error) {
+	proxyUrl, _ := url.Parse(sl.parameters.Proxy)
+
+	return http.ProxyURL(&url.URL{
+		Scheme: proxyUrl.Scheme,
+		User:   url.UserPassword(sl.parameters.ProxyUsername, sl.parameters.ProxyPassword),
+		Host:   proxyUrl.Host,
+	})
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
@@ -2,16 +2,21 @@ package hooks_test
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/download"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -60,6 +65,8 @@ var _ = Describe("Sealights hook", func() {
 		// procfile                      string
 		command                       *Command
 		httpClient                    *MockHttpClient
+		registry                      *httptest.Server
+		registryRequests              []string
 		procfileName                  = "Procfile"
 		packageJsonName               = "package.json"
 		manifestName                  = "manifest.yml"
@@ -96,9 +103,33 @@ var _ = Describe("Sealights hook", func() {
 			Error:    "",
 		}
 		sealights = hooks.NewSealightsHook(logger, command, httpClient)
+
+		registryRequests = nil
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			registryRequests = append(registryRequests, r.URL.Path)
+			if strings.HasPrefix(r.URL.Path, "/slnodejs/-/") {
+				w.Write([]byte("slnodejs tarball"))
+				return
+			}
+
+			version := strings.TrimPrefix(r.URL.Path, "/slnodejs/")
+			if version == "missingVersion" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if version == "latest" {
+				version = "6.1.0"
+			}
+			fmt.Fprintf(w, `{"version": %q, "dist": {"tarball": "%s/slnodejs/-/slnodejs-%s.tgz"}}`, version, registry.URL, version)
+		}))
+		Expect(os.Setenv(hooks.NpmRegistryEnv, registry.URL)).To(Succeed())
 	})
 
 	AfterEach(func() {
+		registry.Close()
+		Expect(os.Unsetenv(hooks.NpmRegistryEnv)).To(Succeed())
+		Expect(os.Unsetenv(hooks.AgentSha256Env)).To(Succeed())
+
 		err = os.Setenv("SL_BUILD_SESSION_ID", build)
 		Expect(err).To(BeNil())
 		err = os.Setenv("SL_PROXY", proxy)
@@ -318,7 +349,7 @@ var _ = Describe("Sealights hook", func() {
 				packageJson, err := sealights.ReadPackageJson(stager)
 				Expect(err).To(BeNil())
 
-				devScript := packageJson["scripts"].(map[string]interface{})["dev"].(string)
+				devScript := packageJson.Scripts["dev"]
 				Expect(devScript).To(ContainSubstring("slnodejs"))
 				Expect(devScript).To(ContainSubstring("index.js --build 192 --name Good"))
 			})
@@ -434,7 +465,7 @@ var _ = Describe("Sealights hook", func() {
 					Expect(err).To(BeNil())
 					packageJson, err := sealights.ReadPackageJson(stager)
 					Expect(err).To(BeNil())
-					cleanResult := strings.ReplaceAll(packageJson["scripts"].(map[string]interface{})["start"].(string), " ", "")
+					cleanResult := strings.ReplaceAll(packageJson.Scripts["start"], " ", "")
 					Expect(cleanResult).To(Equal(expectedWithFile))
 				})
 				It("hook fails with empty build session id", func() {
@@ -458,7 +489,7 @@ var _ = Describe("Sealights hook", func() {
 					err = sealights.SetApplicationStartInPackageJson(stager, "start")
 					packageJson, err := sealights.ReadPackageJson(stager)
 					Expect(err).To(BeNil())
-					cleanResult := strings.ReplaceAll(packageJson["scripts"].(map[string]interface{})["start"].(string), " ", "")
+					cleanResult := strings.ReplaceAll(packageJson.Scripts["start"], " ", "")
 					Expect(cleanResult).To(Equal(expected))
 				})
 			})
@@ -531,6 +562,12 @@ var _ = Describe("Sealights hook", func() {
 				os.Setenv("VCAP_SERVICES", fmt.Sprintf(vcapTemplate, token, version, customAgentUrl))
 			}
 
+			expectRegistryInstall := func(version string) {
+				Expect(registryRequests).To(ContainElement("/slnodejs/" + version))
+				Expect(command.args[1]).To(Equal("--no-save"))
+				Expect(command.args[2]).To(HaveSuffix(string(filepath.Separator) + hooks.AgentTarball))
+			}
+
 			BeforeEach(func() {
 				err = os.Setenv("SL_DOMAIN", "my-domain")
 				Expect(err).To(BeNil())
@@ -546,7 +583,7 @@ var _ = Describe("Sealights hook", func() {
 
 				Expect(err).To(BeNil())
 				Expect(command.called).To(Equal(true))
-				Expect(command.args[1]).To(Equal("slnodejs@" + recommendedVersion))
+				expectRegistryInstall(recommendedVersion)
 			})
 			It("shouldn't get recomended version from server if SL_DOMAIN not set", func() {
 				err = os.Setenv("SL_DOMAIN", "")
@@ -558,7 +595,7 @@ var _ = Describe("Sealights hook", func() {
 
 				Expect(err).To(BeNil())
 				Expect(command.called).To(Equal(true))
-				Expect(command.args[1]).To(Equal("slnodejs@latest"))
+				expectRegistryInstall("latest")
 			})
 			It("install default version if no other provided and get recomended version failed", func() {
 				setVcap("", "")
@@ -567,7 +604,7 @@ var _ = Describe("Sealights hook", func() {
 				err = sealights.AfterCompile(stager)
 
 				Expect(err).To(BeNil())
-				Expect(command.args[1]).To(Equal("slnodejs@latest"))
+				expectRegistryInstall("latest")
 			})
 			It("use custom url if provided", func() {
 				setVcap("", customUrl)
@@ -577,6 +614,47 @@ var _ = Describe("Sealights hook", func() {
 				Expect(err).To(BeNil())
 				Expect(command.args[1]).To(Equal(customUrl))
 			})
+			Context("when customAgentUrl is an http url", func() {
+				var (
+					server   *httptest.Server
+					requests int
+				)
+
+				BeforeEach(func() {
+					requests = 0
+					server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						requests++
+						w.Write([]byte("slnodejs tarball"))
+					}))
+				})
+
+				AfterEach(func() {
+					server.Close()
+					Expect(os.Unsetenv(hooks.CustomAgentSha256Env)).To(Succeed())
+				})
+
+				It("downloads the agent and installs the tarball", func() {
+					setVcap("", server.URL+"/slnodejs-6.1.0.tgz")
+
+					err = sealights.AfterCompile(stager)
+
+					Expect(err).To(BeNil())
+					Expect(requests).To(Equal(1))
+					Expect(command.args[1]).To(Equal("--no-save"))
+					Expect(command.args[2]).To(HaveSuffix(string(filepath.Separator) + hooks.AgentTarball))
+				})
+
+				It("does not install an agent that does not match its sha256", func() {
+					setVcap("", server.URL+"/slnodejs-6.1.0.tgz")
+					Expect(os.Setenv(hooks.CustomAgentSha256Env, "2222222222222222222222222222222222222222222222222222222222222222")).To(Succeed())
+
+					err = sealights.AfterCompile(stager)
+
+					var checksumErr *download.ChecksumError
+					Expect(errors.As(err, &checksumErr)).To(BeTrue())
+					Expect(command.called).To(BeFalse())
+				})
+			})
 			It("should not get custom version if customUrl provided", func() {
 				setVcap(customVersion, customUrl)
 
@@ -591,7 +669,7 @@ var _ = Describe("Sealights hook", func() {
 				err = sealights.AfterCompile(stager)
 
 				Expect(err).To(BeNil())
-				Expect(command.args[1]).To(Equal("slnodejs@" + customVersion))
+				expectRegistryInstall(customVersion)
 			})
 			It("should not get recomended version from server if customVersion provided", func() {
 				setVcap(customVersion, "")
@@ -601,7 +679,36 @@ var _ = Describe("Sealights hook", func() {
 				err = sealights.AfterCompile(stager)
 
 				Expect(err).To(BeNil())
-				Expect(command.args[1]).To(Equal("slnodejs@" + customVersion))
+				expectRegistryInstall(customVersion)
+			})
+			It("verifies the registry tarball against agentSha256", func() {
+				setVcap(customVersion, "")
+				sum := sha256.Sum256([]byte("slnodejs tarball"))
+				Expect(os.Setenv(hooks.AgentSha256Env, hex.EncodeToString(sum[:]))).To(Succeed())
+
+				err = sealights.AfterCompile(stager)
+
+				Expect(err).To(BeNil())
+				expectRegistryInstall(customVersion)
+			})
+			It("does not install a registry tarball that does not match agentSha256", func() {
+				setVcap(customVersion, "")
+				Expect(os.Setenv(hooks.AgentSha256Env, "2222222222222222222222222222222222222222222222222222222222222222")).To(Succeed())
+
+				err = sealights.AfterCompile(stager)
+
+				var checksumErr *download.ChecksumError
+				Expect(errors.As(err, &checksumErr)).To(BeTrue())
+				Expect(command.called).To(BeFalse())
+			})
+			It("installs with npm when the registry tarball cannot be downloaded", func() {
+				setVcap("missingVersion", "")
+
+				err = sealights.AfterCompile(stager)
+
+				Expect(err).To(BeNil())
+				Expect(command.args[1]).To(Equal("slnodejs@missingVersion"))
+				Expect(buffer.String()).To(ContainSubstring("downloading slnodejs@missingVersion failed, so npm installs it instead"))
 			})
 		})
 
@@ -644,11 +751,11 @@ var _ = Describe("Sealights hook", func() {
 		})
 
 		Context("validateNpmRunScript function", func() {
-			var packageJson map[string]interface{}
+			var packageJson package_json.PackageJSON
 
 			BeforeEach(func() {
-				packageJson = map[string]interface{}{
-					"scripts": map[string]interface{}{
+				packageJson = package_json.PackageJSON{
+					Scripts: map[string]string{
 						"start": "node server.js",
 						"test":  "mocha",
 						"dev":   "nodemon server.js",
@@ -674,8 +781,8 @@ var _ = Describe("Sealights hook", func() {
 			})
 
 			It("should fail for package.json without scripts section", func() {
-				packageJsonWithoutScripts := map[string]interface{}{
-					"name": "test-app",
+				packageJsonWithoutScripts := package_json.PackageJSON{
+					Name: "test-app",
 				}
 				err := sealights.ValidateNpmRunScript(packageJsonWithoutScripts, "start")
 				Expect(err).To(HaveOccurred())
@@ -683,8 +790,8 @@ var _ = Describe("Sealights hook", func() {
 			})
 
 			It("should fail for package.json with null scripts section", func() {
-				packageJsonWithNullScripts := map[string]interface{}{
-					"scripts": nil,
+				packageJsonWithNullScripts := package_json.PackageJSON{
+					Scripts: nil,
 				}
 				err := sealights.ValidateNpmRunScript(packageJsonWithNullScripts, "start")
 				Expect(err).To(HaveOccurred())
@@ -732,7 +839,7 @@ var _ = Describe("Sealights hook", func() {
 				packageJson, err := sealights.ReadPackageJson(stager)
 				Expect(err).To(BeNil())
 
-				customScript := packageJson["scripts"].(map[string]interface{})["custom-script"].(string)
+				customScript := packageJson.Scripts["custom-script"]
 				cleanResult := strings.ReplaceAll(customScript, " ", "")
 				Expect(cleanResult).To(Equal(expected))
 			})
@@ -747,7 +854,7 @@ var _ = Describe("Sealights hook", func() {
 				packageJson, err := sealights.ReadPackageJson(stager)
 				Expect(err).To(BeNil())
 
-				startScript := packageJson["scripts"].(map[string]interface{})["start"].(string)
+				startScript := packageJson.Scripts["start"]
 				Expect(startScript).To(ContainSubstring("slnodejs"))
 			})
 		})
@@ -1,18 +1,17 @@
 package hooks
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
-	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/download"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
@@ -23,19 +22,24 @@ const (
 	agentDownloadPath = "/rest/api/latest/installers/agents/binaries/NODEJS"
 	seekerTarGZ       = "seeker-agent.tgz"
 	seekerZIP         = "seeker-node-agent.zip"
+	// SeekerAgentSHA256Env pins the sha256 of the agent zip; it takes
+	// precedence over the agent_sha256 credential of the service.
+	SeekerAgentSHA256Env = "SEEKER_AGENT_SHA256"
 )
 
 var pattern = regexp.MustCompile(`require\(['"].*@synopsys-sig/seeker['"]\)`)
 
 type SeekerAfterCompileHook struct {
 	libbuildpack.DefaultHook
-	Log     *libbuildpack.Logger
-	Command *libbuildpack.Command
+	Log        *libbuildpack.Logger
+	Command    *libbuildpack.Command
+	Downloader *download.Downloader
 }
 
 type SeekerCredentials struct {
 	ServiceName     string
 	SeekerServerURL string
+	AgentSHA256     string
 }
 
 func init() {
@@ -74,6 +78,11 @@ func (h *SeekerAfterCompileHook) AfterCompile(compiler *libbuildpack.Stager) err
 	if err = h.PrependRequire(compiler); err != nil {
 		return err
 	}
+	if h.Downloader == nil {
+		if h.Downloader, err = download.New(h.Log, compiler.CacheDir()); err != nil {
+			return err
+		}
+	}
 	seekerTempFolder, err := os.MkdirTemp(os.TempDir(), "seeker_tmp")
 	if err != nil {
 		h.Log.Error("Failed to create temp dir")
@@ -131,7 +140,13 @@ func (h *SeekerAfterCompileHook) downloadAgent(serviceCredentials SeekerCredenti
 	seekerLibraryPath := filepath.Join(seekerTempFolder, seekerTarGZ)
 	agentZipAbsolutePath := path.Join(seekerTempFolder, seekerZIP)
 	h.Log.Info("Downloading '%s' to '%s'", agentDownloadAbsoluteURL, agentZipAbsolutePath)
-	if err = h.downloadFile(agentDownloadAbsoluteURL, agentZipAbsolutePath); err != nil {
+	checksum := os.Getenv(SeekerAgentSHA256Env)
+	if checksum == "" {
+		checksum = serviceCredentials.AgentSHA256
+	}
+	artifact := download.Artifact{URL: agentDownloadAbsoluteURL, SHA256: checksum}
+	if err = h.Downloader.Fetch(artifact, agentZipAbsolutePath); err != nil {
+		h.Log.Error("Failed to download agent from: %s", agentDownloadAbsoluteURL)
 		return "", err
 	}
 	err = libbuildpack.ExtractZip(agentZipAbsolutePath, seekerTempFolder)
@@ -180,97 +195,40 @@ func (h *SeekerAfterCompileHook) listContents(dir string) error {
 func (h *SeekerAfterCompileHook) createSeekerEnvironmentScript(serviceCredentials SeekerCredentials, stager *libbuildpack.Stager) error {
 	seekerEnvironmentScript := "seeker-env.sh"
 
-	const seekerServerTemplate = "export SEEKER_SERVER_URL=%s\n"
-	scriptContent := fmt.Sprintf(seekerServerTemplate, serviceCredentials.SeekerServerURL)
-	stager.Logger().Info(seekerEnvironmentScript + " content: " + scriptContent)
-	return stager.WriteProfileD(seekerEnvironmentScript, scriptContent)
+	script := &profiled.Script{}
+	script.Export("SEEKER_SERVER_URL", profiled.Literal(serviceCredentials.SeekerServerURL))
+	stager.Logger().Info(seekerEnvironmentScript + " content: " + script.String())
+	return profiled.Write(stager.DepDir(), seekerEnvironmentScript, script)
 }
 
 func (h *SeekerAfterCompileHook) getCredentials() *SeekerCredentials {
-	var vcapServices map[string][]struct {
-		Name        string                 `json:"name"`
-		Credentials map[string]interface{} `json:"credentials"`
-	}
-
-	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
-		h.Log.Debug("Failed to unmarshal VCAP_SERVICES: %s", err)
-		return nil
-	}
-
-	var found []*SeekerCredentials
-
-	for _, services := range vcapServices {
-		for _, service := range services {
-			if !strings.Contains(strings.ToLower(service.Name), "seeker") {
-				continue
-			}
-
-			queryString := func(key string) string {
-				if value, ok := service.Credentials[key].(string); ok {
-					return value
-				}
-				return ""
-			}
-
-			c := &SeekerCredentials{
-				ServiceName:     service.Name,
-				SeekerServerURL: queryString("seeker_server_url"),
-			}
-
-			if c.SeekerServerURL == "" {
-				h.Log.Warning("Empty value for Seeker Server URL in server: %s", c.ServiceName)
-				continue
-			}
-			found = append(found, c)
-		}
-	}
-
-	if len(found) == 1 {
-		h.Log.Debug("Found one matching seeker service: %s", found[0].ServiceName)
-		return found[0]
-	}
-
-	if len(found) > 1 {
-		h.Log.Warning("More than one matching seeker service was found!")
-	}
-
-	return nil
-}
-
-func (h *SeekerAfterCompileHook) downloadFile(url, destFile string) error {
-	resp, err := http.Get(url)
+	bindings, err := binding.Load()
 	if err != nil {
-		h.Log.Error("Failed to download agent from: %s", url)
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return errors.New("Download failed with HTTP status: " + strconv.Itoa(resp.StatusCode))
+		h.Log.Debug("Failed to read service bindings: %s", err)
 	}
-	return h.writeToFile(resp.Body, destFile, 0666)
-}
 
-func (h *SeekerAfterCompileHook) writeToFile(source io.Reader, destFile string, mode os.FileMode) error {
-	err := os.MkdirAll(filepath.Dir(destFile), 0755)
-	if err != nil {
-		h.Log.Error("Failed to create agent download directory %s", filepath.Dir(destFile))
-		return err
+	query := binding.Named("seeker")
+	for _, b := range bindings.Find(query) {
+		if !b.Credentials.Has("seeker_server_url") {
+			h.Log.Warning("Empty value for Seeker Server URL in server: %s", b.Name)
+		}
 	}
 
-	fh, err := os.OpenFile(destFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	b, err := bindings.One(query.WithCredentials("seeker_server_url"))
 	if err != nil {
-		h.Log.Error("Failed to open file for writing (%s)", destFile)
-		return err
+		var ambiguous *binding.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			h.Log.Warning("More than one matching seeker service was found!")
+		}
+		return nil
 	}
-	defer fh.Close()
 
-	_, err = io.Copy(fh, source)
-	if err != nil {
-		h.Log.Error("Failed to copy agent content to file (%s)", destFile)
-		return err
+	h.Log.Debug("Found one matching seeker service: %s", b.Name)
+	return &SeekerCredentials{
+		ServiceName:     b.Name,
+		SeekerServerURL: b.Credentials.String("seeker_server_url"),
+		AgentSHA256:     b.Credentials.String("agent_sha256"),
 	}
-	return nil
 }
 
 func (h *SeekerAfterCompileHook) cleanupUnusedFiles(directory string) {
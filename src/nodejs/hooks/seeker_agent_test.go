@@ -2,10 +2,14 @@ package hooks_test
 
 import (
 	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 
 	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/download"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -129,6 +133,33 @@ var _ = Describe("seekerHook", func() {
 				err = seeker.AfterCompile(stager)
 				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
 			})
+
+			Context("when the agent does not match SEEKER_AGENT_SHA256", func() {
+				var server *httptest.Server
+
+				BeforeEach(func() {
+					server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.Write([]byte("not the agent"))
+					}))
+					os.Setenv("SEEKER_AGENT_DOWNLOAD_URL", server.URL+"/seeker-node-agent.zip")
+					os.Setenv(hooks.SeekerAgentSHA256Env, "1111111111111111111111111111111111111111111111111111111111111111")
+				})
+
+				AfterEach(func() {
+					server.Close()
+					os.Unsetenv("SEEKER_AGENT_DOWNLOAD_URL")
+					os.Unsetenv(hooks.SeekerAgentSHA256Env)
+				})
+
+				It("fails before installing the agent", func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "server.js"), []byte("some mock javascript code"), 0755)).To(Succeed())
+
+					err = seeker.AfterCompile(stager)
+					var checksumErr *download.ChecksumError
+					Expect(errors.As(err, &checksumErr)).To(BeTrue())
+					Expect(buffer.String()).To(ContainSubstring("Failed to download agent from: " + server.URL))
+				})
+			})
 		})
 	})
 })
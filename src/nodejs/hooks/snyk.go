@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/binding"
+
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -243,46 +245,22 @@ func (h SnykHook) runProtect() error {
 	return err
 }
 
-func getCredentialString(credentials map[string]interface{}, key string) string {
-	value, isString := credentials[key].(string)
-
-	if isString {
-		return value
-	}
-	return ""
-}
-
 func (h SnykHook) getCredentialsFromService() (bool, SnykCredentials) {
-	type Service struct {
-		Name        string                 `json:"name"`
-		Credentials map[string]interface{} `json:"credentials"`
-	}
-	var vcapServices map[string][]Service
-	err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices)
+	bindings, err := binding.Load()
 	if err != nil {
-		h.Log.Warning("Failed to parse VCAP_SERVICES")
-		return false, SnykCredentials{}
+		h.Log.Warning("Failed to parse service bindings: %s", err.Error())
 	}
 
-	for _, services := range vcapServices {
-		for _, service := range services {
-			if strings.Contains(service.Name, "snyk") {
-				apiToken := getCredentialString(service.Credentials, "apiToken")
-				if apiToken != "" {
-					apiUrl := getCredentialString(service.Credentials, "apiUrl")
-					orgName := getCredentialString(service.Credentials, "orgName")
-					snykCredantials := SnykCredentials{
-						ApiToken: apiToken,
-						ApiUrl:   apiUrl,
-						OrgName:  orgName,
-					}
-					return true, snykCredantials
-				}
-			}
-		}
+	b, found := bindings.First(binding.Named("snyk").WithCredentials("apiToken"))
+	if !found {
+		return false, SnykCredentials{}
 	}
 
-	return false, SnykCredentials{}
+	return true, SnykCredentials{
+		ApiToken: b.Credentials.String("apiToken"),
+		ApiUrl:   b.Credentials.String("apiUrl"),
+		OrgName:  b.Credentials.String("orgName"),
+	}
 }
 
 func (h SnykHook) appName() string {
@@ -0,0 +1,54 @@
+package jsonc
+
+import "strings"
+
+// Strip removes comments and trailing commas so that JSONC files such as
+// tsconfig.json and deno.jsonc can be handed to encoding/json.
+func Strip(contents []byte) []byte {
+	var out []byte
+
+	inString := false
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(contents) {
+				i++
+				out = append(out, contents[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(contents) && contents[i+1] == '/':
+			for i < len(contents) && contents[i] != '\n' {
+				i++
+			}
+			if i < len(contents) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(contents) && contents[i+1] == '*':
+			i += 2
+			for i+1 < len(contents) && !(contents[i] == '*' && contents[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == '}' || c == ']':
+			trimmed := strings.TrimRight(string(out), " \t\r\n")
+			if strings.HasSuffix(trimmed, ",") {
+				out = []byte(strings.TrimSuffix(trimmed, ","))
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,13 @@
+package jsonc_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestJsonc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jsonc Suite")
+}
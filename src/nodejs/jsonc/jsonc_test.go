@@ -0,0 +1,25 @@
+package jsonc_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/jsonc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strip", func() {
+	DescribeTable("produces valid JSON",
+		func(input, expected string) {
+			stripped := jsonc.Strip([]byte(input))
+			Expect(json.Valid(stripped)).To(BeTrue(), string(stripped))
+			Expect(stripped).To(MatchJSON(expected))
+		},
+		Entry("line comments", "{\n  // comment\n  \"a\": 1 // trailing\n}", `{"a": 1}`),
+		Entry("block comments", `{/* one */"a": /* two */ 1}`, `{"a": 1}`),
+		Entry("trailing commas", `{"a": [1, 2,], "b": {"c": 3,},}`, `{"a": [1, 2], "b": {"c": 3}}`),
+		Entry("comment markers in strings", `{"url": "https://example.com/*", "glob": "src/**/*.ts"}`, `{"url": "https://example.com/*", "glob": "src/**/*.ts"}`),
+		Entry("escaped quotes in strings", `{"a": "say \"hi\" // not a comment"}`, `{"a": "say \"hi\" // not a comment"}`),
+	)
+})
@@ -1,11 +1,15 @@
 package npm
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -16,6 +20,7 @@ type Command interface {
 type NPM struct {
 	Command Command
 	Log     *libbuildpack.Logger
+	Retry   retry.Policy
 }
 
 func (n *NPM) Build(buildDir, cacheDir string) error {
@@ -29,7 +34,7 @@ func (n *NPM) Build(buildDir, cacheDir string) error {
 
 	n.Log.Info("Installing node modules (%s)", source)
 	npmArgs := []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}
-	return n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", npmArgs...)
+	return n.install(buildDir, npmArgs)
 }
 
 func (n *NPM) Rebuild(buildDir string) error {
@@ -48,9 +53,31 @@ func (n *NPM) Rebuild(buildDir string) error {
 
 	n.Log.Info("Installing any new modules (%s)", source)
 	npmArgs := []string{"install", "--no-audit", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}
+	return n.install(buildDir, npmArgs)
+}
+
+func (n *NPM) Prune(buildDir string) error {
+	n.Log.Info("Pruning devDependencies")
+
+	// --production is deprecated in favour of --omit=dev, which npm 7 added
+	omit := "--production"
+	buffer := new(bytes.Buffer)
+	if err := n.Command.Execute(buildDir, buffer, io.Discard, "npm", "--version"); err == nil {
+		if major, err := strconv.Atoi(strings.Split(strings.TrimSpace(buffer.String()), ".")[0]); err == nil && major >= 7 {
+			omit = "--omit=dev"
+		}
+	}
+
+	npmArgs := []string{"prune", omit, "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}
 	return n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", npmArgs...)
 }
 
+func (n *NPM) install(buildDir string, npmArgs []string) error {
+	return n.Retry.Do(n.Log, "npm install", func(out io.Writer) error {
+		return n.Command.Execute(buildDir, out, out, "npm", npmArgs...)
+	})
+}
+
 func (n *NPM) doBuild(buildDir string) (bool, string, error) {
 	pkgExists, err := libbuildpack.FileExists(filepath.Join(buildDir, "package.json"))
 	if err != nil {
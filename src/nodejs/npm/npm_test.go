@@ -2,10 +2,15 @@ package npm_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	n "github.com/cloudfoundry/nodejs-buildpack/src/nodejs/npm"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/ansicleaner"
@@ -97,6 +102,40 @@ var _ = Describe("NPM", func() {
 				Expect(buffer.String()).To(ContainSubstring("Skipping (no package.json)"))
 			})
 		})
+
+		Context("the registry connection is reset", func() {
+			var sleeps int
+
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte("xxx"), 0644)).To(Succeed())
+				sleeps = 0
+				npm.Retry = retry.Policy{Retries: 2, Delay: time.Second, Sleep: func(time.Duration) { sleeps++ }}
+			})
+
+			It("retries the install with the same cache", func() {
+				npmArgs := []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}
+				gomock.InOrder(
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", npmArgs).DoAndReturn(func(_ string, stdout, _ io.Writer, _ string, _ ...string) error {
+						fmt.Fprintln(stdout, "npm ERR! code ECONNRESET")
+						return errors.New("exit status 1")
+					}),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", npmArgs).Return(nil),
+				)
+
+				Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(sleeps).To(Equal(1))
+				Expect(buffer.String()).To(ContainSubstring("npm install failed with a network error, retrying in 1s (attempt 2 of 3)"))
+			})
+
+			It("fails once the retries are used up", func() {
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", gomock.Any()).DoAndReturn(func(_ string, stdout, _ io.Writer, _ string, _ ...string) error {
+					fmt.Fprintln(stdout, "npm ERR! code ECONNRESET")
+					return errors.New("exit status 1")
+				}).Times(3)
+
+				Expect(npm.Build(buildDir, cacheDir)).To(MatchError("exit status 1"))
+			})
+		})
 	})
 
 	Describe("Rebuild", func() {
@@ -148,4 +187,30 @@ var _ = Describe("NPM", func() {
 			})
 		})
 	})
+
+	Describe("Prune", func() {
+		npmVersion := func(version string) *gomock.Call {
+			return mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "--version").DoAndReturn(func(_ string, stdout, _ io.Writer, _ string, _ ...string) error {
+				_, err := io.WriteString(stdout, version+"\n")
+				return err
+			})
+		}
+
+		It("removes devDependencies from node_modules", func() {
+			gomock.InOrder(
+				npmVersion("10.9.2"),
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"prune", "--omit=dev", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}).Return(nil),
+			)
+			Expect(npm.Prune(buildDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies"))
+		})
+
+		It("uses --production with npm older than 7", func() {
+			gomock.InOrder(
+				npmVersion("6.14.18"),
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"prune", "--production", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}).Return(nil),
+			)
+			Expect(npm.Prune(buildDir)).To(Succeed())
+		})
+	})
 })
@@ -1,30 +1,106 @@
 package package_json
 
 import (
+	"encoding/json"
 	"errors"
-	"github.com/cloudfoundry/libbuildpack"
+	"fmt"
 	"os"
+	"reflect"
+
+	"github.com/cloudfoundry/libbuildpack"
 )
 
+const File = "package.json"
+
+// PackageJSON is the part of package.json that the buildpack and its hooks
+// read. Fields it does not model are kept so that Write does not drop them.
 type PackageJSON struct {
-	Engines Engines `json:"engines"`
+	Name            string            `json:"name"`
+	Main            string            `json:"main"`
+	Type            string            `json:"type"`
+	PackageManager  string            `json:"packageManager"`
+	Engines         Engines           `json:"engines"`
+	Scripts         map[string]string `json:"scripts"`
+	Workspaces      Workspaces        `json:"workspaces"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+	Volta           Volta             `json:"volta"`
+
+	raw map[string]json.RawMessage
 }
 
 type Engines struct {
 	Node string `json:"node"`
 	Yarn string `json:"yarn"`
 	NPM  string `json:"npm"`
+	Bun  string `json:"bun"`
 	Iojs string `json:"iojs"`
 }
 
+// Volta holds the tool versions pinned by https://volta.sh.
+type Volta struct {
+	Node string `json:"node"`
+	NPM  string `json:"npm"`
+	Yarn string `json:"yarn"`
+}
+
+// Workspaces is either the array form ["packages/*"] or the yarn object form
+// {"packages": ["packages/*"], "nohoist": ["**/react-native"]}.
+type Workspaces struct {
+	Packages []string `json:"packages"`
+	Nohoist  []string `json:"nohoist"`
+}
+
+func (w *Workspaces) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &w.Packages); err == nil {
+		return nil
+	}
+
+	type workspaces Workspaces
+	if err := json.Unmarshal(data, (*workspaces)(w)); err != nil {
+		return &json.UnmarshalTypeError{Value: jsonKind(data), Type: reflect.TypeOf([]string{}), Field: "workspaces"}
+	}
+
+	return nil
+}
+
+// Defined reports whether the package declares any workspaces.
+func (w Workspaces) Defined() bool {
+	return len(w.Packages) > 0 || len(w.Nohoist) > 0
+}
+
+func (p *PackageJSON) UnmarshalJSON(data []byte) error {
+	type packageJSON PackageJSON
+	if err := json.Unmarshal(data, (*packageJSON)(p)); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &p.raw)
+}
+
 type logger interface {
 	Info(format string, args ...interface{})
 }
 
-func LoadPackageJSON(path string, logger logger) (PackageJSON, error) {
+// Load reads and validates package.json. Errors for a missing file satisfy
+// os.IsNotExist, and validation errors name the offending field.
+func Load(path string) (PackageJSON, error) {
 	var p PackageJSON
 
-	err := libbuildpack.NewJSON().Load(path, &p)
+	if err := libbuildpack.NewJSON().Load(path, &p); err != nil {
+		if os.IsNotExist(err) {
+			return PackageJSON{}, err
+		}
+		return PackageJSON{}, validationError(err)
+	}
+
+	return p, nil
+}
+
+// LoadPackageJSON loads package.json for supply and logs the requested
+// engines. A missing package.json is treated as an empty one.
+func LoadPackageJSON(path string, logger logger) (PackageJSON, error) {
+	p, err := Load(path)
 	if err != nil && !os.IsNotExist(err) {
 		return PackageJSON{}, err
 	}
@@ -47,3 +123,92 @@ func LoadPackageJSON(path string, logger logger) (PackageJSON, error) {
 
 	return p, nil
 }
+
+// SetScript sets a script, creating the scripts section if needed.
+func (p *PackageJSON) SetScript(name, command string) error {
+	if p.Scripts == nil {
+		p.Scripts = map[string]string{}
+	}
+	p.Scripts[name] = command
+
+	scripts, err := json.Marshal(p.Scripts)
+	if err != nil {
+		return err
+	}
+
+	if p.raw == nil {
+		p.raw = map[string]json.RawMessage{}
+	}
+	p.raw["scripts"] = scripts
+
+	return nil
+}
+
+// Write saves the package.json as it was read, with any changes made through
+// SetScript.
+func (p PackageJSON) Write(path string) error {
+	if p.raw == nil {
+		return libbuildpack.NewJSON().Write(path, p)
+	}
+	return libbuildpack.NewJSON().Write(path, p.raw)
+}
+
+func validationError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("invalid %s: %q must be %s, not %s", File, typeErr.Field, describe(typeErr.Type), article(typeErr.Value))
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("invalid %s: %s at offset %d", File, syntaxErr.Error(), syntaxErr.Offset)
+	}
+
+	return fmt.Errorf("invalid %s: %w", File, err)
+}
+
+func describe(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Slice:
+		return "an array"
+	case reflect.Bool:
+		return "a boolean"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
+
+func article(kind string) string {
+	switch kind {
+	case "array", "object":
+		return "an " + kind
+	case "null":
+		return kind
+	default:
+		return "a " + kind
+	}
+}
+
+func jsonKind(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "invalid JSON"
+	}
+
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,13 @@
+package package_json_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPackageJSON(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PackageJSON Suite")
+}
@@ -0,0 +1,168 @@
+package package_json_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PackageJSON", func() {
+	var (
+		err      error
+		buildDir string
+		path     string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(buildDir, "package.json")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writePackageJSON := func(contents string) {
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Load", func() {
+		It("reads the fields the buildpack uses", func() {
+			writePackageJSON(`{
+  "name": "app",
+  "main": "index.js",
+  "type": "module",
+  "packageManager": "yarn@4.1.0",
+  "engines": {"node": "20.x", "yarn": "4.x", "npm": "10.x", "bun": "1.x"},
+  "scripts": {"start": "node index.js", "build": "tsc"},
+  "dependencies": {"express": "^4.18.0"},
+  "devDependencies": {"typescript": "^5.0.0"},
+  "volta": {"node": "20.11.0", "yarn": "4.1.0"}
+}`)
+
+			p, err := package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Name).To(Equal("app"))
+			Expect(p.Main).To(Equal("index.js"))
+			Expect(p.Type).To(Equal("module"))
+			Expect(p.PackageManager).To(Equal("yarn@4.1.0"))
+			Expect(p.Engines).To(Equal(package_json.Engines{Node: "20.x", Yarn: "4.x", NPM: "10.x", Bun: "1.x"}))
+			Expect(p.Scripts).To(Equal(map[string]string{"start": "node index.js", "build": "tsc"}))
+			Expect(p.Dependencies).To(HaveKeyWithValue("express", "^4.18.0"))
+			Expect(p.DevDependencies).To(HaveKeyWithValue("typescript", "^5.0.0"))
+			Expect(p.Volta).To(Equal(package_json.Volta{Node: "20.11.0", Yarn: "4.1.0"}))
+			Expect(p.Workspaces.Defined()).To(BeFalse())
+		})
+
+		It("reads workspaces as an array", func() {
+			writePackageJSON(`{"workspaces": ["packages/*"]}`)
+
+			p, err := package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Workspaces.Packages).To(Equal([]string{"packages/*"}))
+			Expect(p.Workspaces.Defined()).To(BeTrue())
+		})
+
+		It("reads workspaces as an object", func() {
+			writePackageJSON(`{"workspaces": {"packages": ["packages/*"], "nohoist": ["**/react-native"]}}`)
+
+			p, err := package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Workspaces.Packages).To(Equal([]string{"packages/*"}))
+			Expect(p.Workspaces.Nohoist).To(Equal([]string{"**/react-native"}))
+			Expect(p.Workspaces.Defined()).To(BeTrue())
+		})
+
+		It("returns a not exist error when there is no package.json", func() {
+			_, err := package_json.Load(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		DescribeTable("names the invalid field",
+			func(contents, message string) {
+				writePackageJSON(contents)
+
+				_, err := package_json.Load(path)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("engines.node", `{"engines": {"node": 20}}`, `invalid package.json: "engines.node" must be a string, not a number`),
+			Entry("scripts.start", `{"scripts": {"start": ["node", "index.js"]}}`, `invalid package.json: "scripts.start" must be a string, not an array`),
+			Entry("engines", `{"engines": "node 20"}`, `invalid package.json: "engines" must be an object, not a string`),
+			Entry("workspaces", `{"workspaces": "packages/*"}`, `invalid package.json: "workspaces" must be an array, not a string`),
+		)
+
+		It("reports malformed JSON", func() {
+			writePackageJSON(`{"name": "app",}`)
+
+			_, err := package_json.Load(path)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("invalid package.json: "))
+		})
+	})
+
+	Describe("LoadPackageJSON", func() {
+		var buffer *bytes.Buffer
+		var logger *libbuildpack.Logger
+
+		BeforeEach(func() {
+			buffer = new(bytes.Buffer)
+			logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+		})
+
+		It("treats a missing package.json as empty", func() {
+			p, err := package_json.LoadPackageJSON(path, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Engines.Node).To(Equal(""))
+			Expect(buffer.String()).To(ContainSubstring("engines.node (package.json): unspecified"))
+		})
+
+		It("rejects io.js", func() {
+			writePackageJSON(`{"engines": {"iojs": "3.x"}}`)
+
+			_, err := package_json.LoadPackageJSON(path, logger)
+			Expect(err).To(MatchError("io.js not supported by this buildpack"))
+		})
+	})
+
+	Describe("Write", func() {
+		It("keeps fields it does not model when a script changes", func() {
+			writePackageJSON(`{"name": "app", "private": true, "scripts": {"start": "node index.js"}, "config": {"port": 8080}}`)
+
+			p, err := package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.SetScript("start", "node -r agent index.js")).To(Succeed())
+			Expect(p.Write(path)).To(Succeed())
+
+			var written map[string]interface{}
+			Expect(libbuildpack.NewJSON().Load(path, &written)).To(Succeed())
+			Expect(written).To(HaveKeyWithValue("private", true))
+			Expect(written).To(HaveKeyWithValue("config", map[string]interface{}{"port": float64(8080)}))
+			Expect(written).To(HaveKeyWithValue("scripts", map[string]interface{}{"start": "node -r agent index.js"}))
+		})
+
+		It("adds a scripts section when there is none", func() {
+			writePackageJSON(`{"name": "app"}`)
+
+			p, err := package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.SetScript("start", "node server.js")).To(Succeed())
+			Expect(p.Write(path)).To(Succeed())
+
+			p, err = package_json.Load(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Name).To(Equal("app"))
+			Expect(p.Scripts).To(Equal(map[string]string{"start": "node server.js"}))
+		})
+	})
+})
@@ -0,0 +1,277 @@
+package profiled
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrNewline is returned for values with line breaks, which a profile.d
+// script cannot hold on one line and which could start a new command.
+var ErrNewline = errors.New("value contains a newline")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type partKind int
+
+const (
+	literalPart partKind = iota
+	envPart
+	filePart
+)
+
+type part struct {
+	kind  partKind
+	text  string
+	elems []string
+}
+
+// Word is a value in a profile.d script. It is rendered so that the shell
+// takes its literal text as is, and only expands the variables and files it
+// refers to.
+type Word struct {
+	parts []part
+	err   error
+}
+
+// Literal is the text s. Literal("") is the zero Word.
+func Literal(s string) Word {
+	if s == "" {
+		return Word{}
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		return Word{err: ErrNewline}
+	}
+	return Word{parts: []part{{kind: literalPart, text: s}}}
+}
+
+// Env expands to the variable name at launch.
+func Env(name string) Word {
+	if !namePattern.MatchString(name) {
+		return Word{err: fmt.Errorf("%q is not a valid variable name", name)}
+	}
+	return Word{parts: []part{{kind: envPart, text: name}}}
+}
+
+// EnvPath is the path elems under the directory in the variable env, such
+// as $DEPS_DIR/0/node.
+func EnvPath(env string, elems ...string) Word {
+	return Concat(Env(env), Literal("/"+path.Join(elems...)))
+}
+
+// FileContents expands to the contents of the file at elems, under the
+// directory in the variable env, when the script runs.
+func FileContents(env string, elems ...string) Word {
+	w := Env(env)
+	if w.err != nil {
+		return w
+	}
+	for _, elem := range elems {
+		if strings.ContainsAny(elem, "\r\n") {
+			return Word{err: ErrNewline}
+		}
+	}
+	return Word{parts: []part{{kind: filePart, text: env, elems: elems}}}
+}
+
+// Concat joins words into one.
+func Concat(words ...Word) Word {
+	var joined Word
+	for _, w := range words {
+		if w.err != nil {
+			return Word{err: w.err}
+		}
+		for _, p := range w.parts {
+			last := len(joined.parts) - 1
+			if p.kind == literalPart && last >= 0 && joined.parts[last].kind == literalPart {
+				joined.parts[last].text += p.text
+				continue
+			}
+			joined.parts = append(joined.parts, p)
+		}
+	}
+	return joined
+}
+
+func (w Word) IsZero() bool {
+	return len(w.parts) == 0 && w.err == nil
+}
+
+func (w Word) Err() error {
+	return w.err
+}
+
+// String renders the word: single-quoted when it is all literal text, and
+// double-quoted when it expands anything.
+func (w Word) String() string {
+	if len(w.parts) == 0 {
+		return "''"
+	}
+
+	if len(w.parts) == 1 && w.parts[0].kind == literalPart {
+		return quote(w.parts[0].text)
+	}
+
+	return `"` + w.doubleQuoted() + `"`
+}
+
+// doubleQuoted renders the word for inside double quotes.
+func (w Word) doubleQuoted() string {
+	var s strings.Builder
+	for i, p := range w.parts {
+		switch p.kind {
+		case literalPart:
+			s.WriteString(escaper.Replace(p.text))
+		case envPart:
+			// braces keep the name apart from text that follows it
+			if i+1 < len(w.parts) && w.parts[i+1].kind == literalPart && namePattern.MatchString("_"+w.parts[i+1].text[:1]) {
+				s.WriteString("${" + p.text + "}")
+			} else {
+				s.WriteString("$" + p.text)
+			}
+		case filePart:
+			path := `"$` + p.text + `"`
+			for _, elem := range p.elems {
+				path += "/" + quote(elem)
+			}
+			s.WriteString("$(cat " + path + ")")
+		}
+	}
+	return s.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// Script is a profile.d script. The first invalid name or value is kept and
+// returned by Err and Write, so a script can be built without checking each
+// line.
+type Script struct {
+	lines []string
+	err   error
+}
+
+// Export sets name to value.
+func (s *Script) Export(name string, value Word) {
+	if s.check(name, value) {
+		s.lines = append(s.lines, fmt.Sprintf("export %s=%s", name, value))
+	}
+}
+
+// Default sets name to value unless the app sets it itself. Nothing is
+// written for the zero Word.
+func (s *Script) Default(name string, value Word) {
+	if value.IsZero() {
+		return
+	}
+	if s.check(name, value) {
+		s.lines = append(s.lines, fmt.Sprintf("export %[1]s=${%[1]s:-%[2]s}", name, value))
+	}
+}
+
+// Append adds value to the space-separated list in name, as NODE_OPTIONS is.
+func (s *Script) Append(name string, value Word) {
+	if s.check(name, value) {
+		s.lines = append(s.lines, fmt.Sprintf(`export %[1]s="${%[1]s:+$%[1]s }%[2]s"`, name, value.doubleQuoted()))
+	}
+}
+
+// Line adds shell that the buildpack writes itself. It must not contain
+// values from the app, its environment or its bindings.
+func (s *Script) Line(line string) {
+	s.lines = append(s.lines, line)
+}
+
+// If runs then when condition holds, and otherwise, which may be nil, when
+// it does not. Nothing is added when both are empty, since the shell rejects
+// an if without commands.
+func (s *Script) If(condition string, then, otherwise *Script) {
+	for _, branch := range []*Script{then, otherwise} {
+		if branch != nil && branch.err != nil && s.err == nil {
+			s.err = branch.err
+		}
+	}
+
+	if then.Empty() && otherwise.Empty() {
+		return
+	}
+
+	s.lines = append(s.lines, fmt.Sprintf("if %s; then", condition))
+	if then.Empty() {
+		s.lines = append(s.lines, "\t:")
+	}
+	s.lines = append(s.lines, then.indented()...)
+	if !otherwise.Empty() {
+		s.lines = append(s.lines, "else")
+		s.lines = append(s.lines, otherwise.indented()...)
+	}
+	s.lines = append(s.lines, "fi")
+}
+
+func (s *Script) indented() []string {
+	if s == nil {
+		return nil
+	}
+	lines := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		lines[i] = "\t" + line
+	}
+	return lines
+}
+
+func (s *Script) check(name string, value Word) bool {
+	if s.err != nil {
+		return false
+	}
+	if !namePattern.MatchString(name) {
+		s.err = fmt.Errorf("%q is not a valid variable name", name)
+		return false
+	}
+	if value.err != nil {
+		s.err = fmt.Errorf("%s: %w", name, value.err)
+		return false
+	}
+	return true
+}
+
+func (s *Script) Empty() bool {
+	return s == nil || len(s.lines) == 0
+}
+
+func (s *Script) Err() error {
+	return s.err
+}
+
+func (s *Script) String() string {
+	if len(s.lines) == 0 {
+		return ""
+	}
+	return strings.Join(s.lines, "\n") + "\n"
+}
+
+// Write writes the script to <depDir>/profile.d/<name>, readable only by its
+// owner since scripts may hold credentials.
+func Write(depDir, name string, s *Script) error {
+	if s.err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, s.err)
+	}
+
+	dir := filepath.Join(depDir, "profile.d")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(s.String()), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already exists
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,13 @@
+package profiled_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestProfiled(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Profiled Suite")
+}
@@ -0,0 +1,151 @@
+package profiled_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profiled", func() {
+	Describe("Word", func() {
+		It("single-quotes literal text", func() {
+			Expect(profiled.Literal("s3cr3t").String()).To(Equal("'s3cr3t'"))
+			Expect(profiled.Literal(`it's $HOME`).String()).To(Equal(`'it'"'"'s $HOME'`))
+			Expect(profiled.Literal("").String()).To(Equal("''"))
+		})
+
+		It("double-quotes words that expand variables or files", func() {
+			Expect(profiled.EnvPath("DEPS_DIR", "0", "node").String()).To(Equal(`"$DEPS_DIR/0/node"`))
+			Expect(profiled.Concat(profiled.Env("CF_INSTANCE_INDEX"), profiled.Literal("_a")).String()).To(Equal(`"${CF_INSTANCE_INDEX}_a"`))
+			Expect(profiled.Concat(profiled.Literal(`"$a"`), profiled.FileContents("ROOT", "my binding", "key")).String()).
+				To(Equal(`"\"\$a\"$(cat "$ROOT"/'my binding'/'key')"`))
+		})
+
+		It("joins literal text", func() {
+			Expect(profiled.Concat(profiled.Literal("a"), profiled.Literal(""), profiled.Literal("b")).String()).To(Equal("'ab'"))
+			Expect(profiled.Concat().IsZero()).To(BeTrue())
+		})
+
+		It("rejects newlines and invalid names", func() {
+			Expect(profiled.Literal("a\nb").Err()).To(MatchError(profiled.ErrNewline))
+			Expect(profiled.Concat(profiled.Literal("a"), profiled.Literal("b\r")).Err()).To(MatchError(profiled.ErrNewline))
+			Expect(profiled.FileContents("ROOT", "a\nb").Err()).To(MatchError(profiled.ErrNewline))
+			Expect(profiled.Env("A-B").Err()).To(MatchError(`"A-B" is not a valid variable name`))
+		})
+	})
+
+	Describe("Script", func() {
+		It("renders exports, defaults and lists", func() {
+			script := &profiled.Script{}
+			script.Export("API_KEY", profiled.Literal("key"))
+			script.Default("APP_NAME", profiled.Literal("orders"))
+			script.Default("UNSET", profiled.Literal(""))
+			script.Append("NODE_OPTIONS", profiled.Concat(profiled.Literal("--require "), profiled.EnvPath("DEPS_DIR", "0", "agent.js")))
+
+			Expect(script.String()).To(Equal(`export API_KEY='key'
+export APP_NAME=${APP_NAME:-'orders'}
+export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/0/agent.js"
+`))
+		})
+
+		It("renders conditionals", func() {
+			then := &profiled.Script{}
+			then.Export("A", profiled.Literal("1"))
+			otherwise := &profiled.Script{}
+			otherwise.Line("true")
+
+			script := &profiled.Script{}
+			script.If(`[ -z "${B:-}" ]`, then, otherwise)
+
+			Expect(script.String()).To(Equal("if [ -z \"${B:-}\" ]; then\n\texport A='1'\nelse\n\ttrue\nfi\n"))
+		})
+
+		It("leaves out conditionals without commands", func() {
+			script := &profiled.Script{}
+			script.If(`[ -z "${B:-}" ]`, &profiled.Script{}, nil)
+
+			Expect(script.Empty()).To(BeTrue())
+			Expect(script.String()).To(BeEmpty())
+		})
+
+		It("renders a conditional with only an else branch as valid shell", func() {
+			otherwise := &profiled.Script{}
+			otherwise.Export("A", profiled.Literal("1"))
+
+			script := &profiled.Script{}
+			script.If(`[ -z "${B:-}" ]`, &profiled.Script{}, otherwise)
+
+			Expect(script.String()).To(Equal("if [ -z \"${B:-}\" ]; then\n\t:\nelse\n\texport A='1'\nfi\n"))
+			Expect(exec.Command("sh", "-n", "-c", script.String()).Run()).To(Succeed())
+		})
+
+		It("keeps the first error", func() {
+			script := &profiled.Script{}
+			script.Export("KEY", profiled.Literal("a\nrm -rf /"))
+			script.Export("not-a-name", profiled.Literal("x"))
+
+			Expect(script.Err()).To(MatchError(ContainSubstring("KEY: value contains a newline")))
+			Expect(script.String()).To(BeEmpty())
+		})
+
+		It("takes values literally when sourced", func() {
+			values := []string{`it's`, `"quoted"`, `$HOME`, "`id`", `$(id)`, `a b\c`, `;exit 1`}
+
+			script := &profiled.Script{}
+			for i, value := range values {
+				script.Export("V"+string(rune('0'+i)), profiled.Literal(value))
+			}
+			script.Line(`printf '%s|' "$V0" "$V1" "$V2" "$V3" "$V4" "$V5" "$V6"`)
+
+			out, err := exec.Command("sh", "-c", script.String()).Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("it's|\"quoted\"|$HOME|`id`|$(id)|a b\\c|;exit 1|"))
+		})
+	})
+
+	Describe("Write", func() {
+		var depDir string
+
+		BeforeEach(func() {
+			var err error
+			depDir, err = os.MkdirTemp("", "nodejs-buildpack.deps.")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(depDir)).To(Succeed())
+		})
+
+		It("writes the script readable only by its owner", func() {
+			script := &profiled.Script{}
+			script.Export("A", profiled.Literal("1"))
+
+			path := filepath.Join(depDir, "profile.d", "a.sh")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte("old"), 0755)).To(Succeed())
+
+			Expect(profiled.Write(depDir, "a.sh", script)).To(Succeed())
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			contents, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("export A='1'\n"))
+		})
+
+		It("does not write a script with an invalid value", func() {
+			script := &profiled.Script{}
+			script.Export("A", profiled.Literal("1\n2"))
+
+			Expect(profiled.Write(depDir, "a.sh", script)).To(MatchError("unable to write a.sh: A: value contains a newline"))
+			Expect(filepath.Join(depDir, "profile.d", "a.sh")).NotTo(BeAnExistingFile())
+		})
+	})
+})
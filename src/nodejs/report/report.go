@@ -0,0 +1,179 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const (
+	// File is the name of the report in the dep dir.
+	File = "nodejs-staging-report.json"
+
+	// MarkerEnv, when true, also prints the report as a single line that
+	// starts with MarkerPrefix so that it can be picked out of staging logs.
+	MarkerEnv    = "NODE_STAGING_REPORT_MARKER"
+	MarkerPrefix = "NODEJS_STAGING_REPORT"
+
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// Report describes how an app was staged.
+type Report struct {
+	Node            Tool     `json:"node"`
+	NPM             Tool     `json:"npm"`
+	Yarn            Tool     `json:"yarn"`
+	Bun             Tool     `json:"bun"`
+	Deno            Tool     `json:"deno"`
+	PackageManager  string   `json:"package_manager"`
+	InstallMode     string   `json:"install_mode"`
+	Vendored        bool     `json:"vendored"`
+	Offline         bool     `json:"offline"`
+	Scripts         []Script `json:"scripts"`
+	Warnings        []string `json:"warnings"`
+	Cache           Cache    `json:"cache"`
+	NodeModulesSize int64    `json:"node_modules_size_bytes"`
+	StartCommand    string   `json:"start_command,omitempty"`
+	Phases          []Phase  `json:"phases"`
+}
+
+// Tool is a resolved tool version and where it came from.
+type Tool struct {
+	Version string `json:"version,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+type Script struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Succeeded       bool    `json:"succeeded"`
+}
+
+// Phase is a timed step of supply or finalize.
+type Phase struct {
+	Stage           string  `json:"stage"`
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Cache records whether the package manager and framework caches from the
+// previous stage were reused.
+type Cache struct {
+	PackageManager string `json:"package_manager,omitempty"`
+	Framework      string `json:"framework,omitempty"`
+}
+
+var warningLine = regexp.MustCompile(`^\s*(?:\x1b\[[0-9;]*m)?\*\*WARNING\*\*(?:\x1b\[[0-9;]*m)?\s*(.*)$`)
+
+// Load reads the report from depDir. A missing report is not an error.
+func Load(depDir string) (Report, error) {
+	var r Report
+
+	contents, err := os.ReadFile(filepath.Join(depDir, File))
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return r, err
+	}
+
+	return r, json.Unmarshal(contents, &r)
+}
+
+// Write saves the report to depDir.
+func (r *Report) Write(depDir string) error {
+	contents, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(depDir, File), append(contents, '\n'), 0644)
+}
+
+// PrintMarker prints the report on one line when NODE_STAGING_REPORT_MARKER
+// is true.
+func (r *Report) PrintMarker(log *libbuildpack.Logger, phase string) error {
+	if os.Getenv(MarkerEnv) != "true" {
+		return nil
+	}
+
+	contents, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(log.Output(), "%s %s %s\n", MarkerPrefix, phase, contents)
+	return err
+}
+
+// AddScript records a script that was run and how long it took.
+func (r *Report) AddScript(name string, duration time.Duration, err error) {
+	r.Scripts = append(r.Scripts, Script{
+		Name:            name,
+		DurationSeconds: duration.Round(time.Millisecond).Seconds(),
+		Succeeded:       err == nil,
+	})
+}
+
+// AddWarnings records the first line of every warning in a staging log.
+func (r *Report) AddWarnings(logfile string) error {
+	f, err := os.Open(logfile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if match := warningLine.FindStringSubmatch(scanner.Text()); match != nil {
+			r.Warnings = append(r.Warnings, strings.TrimSpace(match[1]))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// CacheStatus reports a cache hit when dir exists and is not empty.
+func CacheStatus(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return CacheMiss
+	}
+	return CacheHit
+}
+
+// DirSize returns the total size of the regular files under dir, or 0 when
+// dir does not exist.
+func DirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,150 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var (
+		err    error
+		dir    string
+		buffer *bytes.Buffer
+		logger *libbuildpack.Logger
+	)
+
+	BeforeEach(func() {
+		dir, err = os.MkdirTemp("", "nodejs-buildpack.report.")
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("Write and Load", func() {
+		It("round-trips the report through the dep dir", func() {
+			r := report.Report{
+				Node:           report.Tool{Version: "22.1.0", Source: "package.json"},
+				PackageManager: "npm",
+				InstallMode:    "install",
+				Cache:          report.Cache{PackageManager: report.CacheHit},
+			}
+			Expect(r.Write(dir)).To(Succeed())
+
+			contents, err := os.ReadFile(filepath.Join(dir, report.File))
+			Expect(err).NotTo(HaveOccurred())
+
+			var raw map[string]interface{}
+			Expect(json.Unmarshal(contents, &raw)).To(Succeed())
+			Expect(raw["node"]).To(Equal(map[string]interface{}{"version": "22.1.0", "source": "package.json"}))
+			Expect(raw["install_mode"]).To(Equal("install"))
+			Expect(raw["cache"]).To(Equal(map[string]interface{}{"package_manager": "hit"}))
+
+			loaded, err := report.Load(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(r))
+		})
+
+		It("loads an empty report when none has been written", func() {
+			loaded, err := report.Load(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(report.Report{}))
+		})
+	})
+
+	Describe("AddScript", func() {
+		It("records the duration and outcome", func() {
+			var r report.Report
+			r.AddScript("build", 1500*time.Millisecond, nil)
+			r.AddScript("heroku-postbuild", time.Second, errors.New("exit status 1"))
+
+			Expect(r.Scripts).To(Equal([]report.Script{
+				{Name: "build", DurationSeconds: 1.5, Succeeded: true},
+				{Name: "heroku-postbuild", DurationSeconds: 1, Succeeded: false},
+			}))
+		})
+	})
+
+	Describe("AddWarnings", func() {
+		It("collects the first line of each warning in the log", func() {
+			path := filepath.Join(dir, "log")
+			log, err := os.Create(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer log.Close()
+
+			l := libbuildpack.NewLogger(log)
+			l.Info("Installing node modules")
+			l.Warning("Unmet dependencies don't fail npm install but may cause runtime issues\nSee: https://github.com/npm/npm/issues/7494")
+			l.Warning("Gulp may not be tracked in package.json")
+
+			var r report.Report
+			Expect(r.AddWarnings(path)).To(Succeed())
+			Expect(r.Warnings).To(Equal([]string{
+				"Unmet dependencies don't fail npm install but may cause runtime issues",
+				"Gulp may not be tracked in package.json",
+			}))
+		})
+	})
+
+	Describe("PrintMarker", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv(report.MarkerEnv)).To(Succeed())
+		})
+
+		It("prints nothing by default", func() {
+			r := report.Report{PackageManager: "yarn"}
+			Expect(r.PrintMarker(logger, "supply")).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		It("prints the report on one line when enabled", func() {
+			Expect(os.Setenv(report.MarkerEnv, "true")).To(Succeed())
+
+			r := report.Report{PackageManager: "yarn"}
+			Expect(r.PrintMarker(logger, "supply")).To(Succeed())
+			Expect(buffer.String()).To(HavePrefix("NODEJS_STAGING_REPORT supply {"))
+			Expect(buffer.String()).To(ContainSubstring(`"package_manager":"yarn"`))
+			Expect(buffer.String()).To(HaveSuffix("}\n"))
+		})
+	})
+
+	Describe("CacheStatus", func() {
+		It("is a miss for a missing or empty directory", func() {
+			Expect(report.CacheStatus(filepath.Join(dir, "missing"))).To(Equal(report.CacheMiss))
+			Expect(report.CacheStatus(dir)).To(Equal(report.CacheMiss))
+		})
+
+		It("is a hit for a populated directory", func() {
+			Expect(os.WriteFile(filepath.Join(dir, "entry"), []byte("x"), 0644)).To(Succeed())
+			Expect(report.CacheStatus(dir)).To(Equal(report.CacheHit))
+		})
+	})
+
+	Describe("DirSize", func() {
+		It("adds up the size of the files in the directory", func() {
+			Expect(os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "a", "one"), make([]byte, 10), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "a", "b", "two"), make([]byte, 32), 0644)).To(Succeed())
+
+			Expect(report.DirSize(dir)).To(Equal(int64(42)))
+		})
+
+		It("is 0 for a missing directory", func() {
+			Expect(report.DirSize(filepath.Join(dir, "node_modules"))).To(BeZero())
+		})
+	})
+})
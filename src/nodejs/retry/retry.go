@@ -0,0 +1,103 @@
+package retry
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const (
+	// RetriesEnv sets how many times a package manager command or a download
+	// that failed with a transient network error is retried. 0 disables
+	// retries.
+	RetriesEnv = "NODE_INSTALL_RETRIES"
+
+	DefaultRetries = 2
+	DefaultDelay   = 2 * time.Second
+	MaxDelay       = 30 * time.Second
+)
+
+// transientOutput matches npm and yarn output for network failures that are
+// likely to succeed when retried.
+var transientOutput = regexp.MustCompile(`\b(ECONNRESET|ETIMEDOUT|ESOCKETTIMEDOUT|EAI_AGAIN|ECONNREFUSED|EPIPE)\b|socket hang up|network timeout|There appears to be trouble with your network connection|\b50[234] (Bad Gateway|Service Unavailable|Gateway Time-?out)`)
+
+type Policy struct {
+	// Retries is the number of attempts made after the first one fails.
+	Retries int
+	// Delay is the wait before the first retry; it doubles for each retry
+	// up to MaxDelay.
+	Delay time.Duration
+	Sleep func(time.Duration)
+}
+
+// Default returns the policy configured through NODE_INSTALL_RETRIES.
+func Default(log *libbuildpack.Logger) Policy {
+	retries := DefaultRetries
+	if value, ok := os.LookupEnv(RetriesEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			retries = n
+		} else {
+			log.Warning("Ignoring %s=%s, it must be a non-negative number", RetriesEnv, value)
+		}
+	}
+
+	return Policy{
+		Retries: retries,
+		Delay:   DefaultDelay,
+		Sleep:   time.Sleep,
+	}
+}
+
+// Do runs attempt until it succeeds, fails with an error that is not
+// transient, or runs out of retries. attempt must write the command's
+// output to out, which also goes to the log. Caches are left in place
+// between attempts so that a retry does not download packages again.
+func (p Policy) Do(log *libbuildpack.Logger, description string, attempt func(out io.Writer) error) error {
+	return p.Run(log, description, func() (bool, error) {
+		output := new(bytes.Buffer)
+		err := attempt(io.MultiWriter(log.Output(), output))
+		return err != nil && IsTransient(err, output.Bytes()), err
+	})
+}
+
+// Run runs attempt until it succeeds, fails with an error it does not
+// report as transient, or runs out of retries.
+func (p Policy) Run(log *libbuildpack.Logger, description string, attempt func() (transient bool, err error)) error {
+	delay := p.Delay
+
+	for i := 0; ; i++ {
+		transient, err := attempt()
+		if err == nil || i >= p.Retries || !transient {
+			return err
+		}
+
+		log.Warning("%s failed with a network error, retrying in %s (attempt %d of %d)", description, delay, i+2, p.Retries+1)
+		if p.Sleep != nil {
+			p.Sleep(delay)
+		}
+
+		delay *= 2
+		if delay > MaxDelay {
+			delay = MaxDelay
+		}
+	}
+}
+
+// IsTransient reports whether a failed command is worth retrying: it must
+// have exited on its own rather than been killed, and its output must show a
+// network error.
+func IsTransient(err error, output []byte) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() < 0 {
+		return false
+	}
+
+	return transientOutput.Match(output)
+}
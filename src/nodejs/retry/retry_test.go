@@ -0,0 +1,181 @@
+package retry_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry", func() {
+	var (
+		buffer *bytes.Buffer
+		logger *libbuildpack.Logger
+		sleeps []time.Duration
+		policy retry.Policy
+	)
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+		sleeps = nil
+		policy = retry.Policy{
+			Retries: 3,
+			Delay:   time.Second,
+			Sleep:   func(d time.Duration) { sleeps = append(sleeps, d) },
+		}
+	})
+
+	failWith := func(output string) func(io.Writer) error {
+		return func(out io.Writer) error {
+			fmt.Fprintln(out, output)
+			return errors.New("exit status 1")
+		}
+	}
+
+	Describe("Do", func() {
+		It("runs the attempt once when it succeeds", func() {
+			attempts := 0
+			Expect(policy.Do(logger, "npm install", func(io.Writer) error {
+				attempts++
+				return nil
+			})).To(Succeed())
+			Expect(attempts).To(Equal(1))
+			Expect(sleeps).To(BeEmpty())
+		})
+
+		It("retries transient failures with exponential backoff until the attempt succeeds", func() {
+			attempts := 0
+			err := policy.Do(logger, "npm install", func(out io.Writer) error {
+				attempts++
+				if attempts < 3 {
+					return failWith("npm ERR! code ECONNRESET")(out)
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(3))
+			Expect(sleeps).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+			Expect(buffer.String()).To(ContainSubstring("npm install failed with a network error, retrying in 1s (attempt 2 of 4)"))
+			Expect(buffer.String()).To(ContainSubstring("npm install failed with a network error, retrying in 2s (attempt 3 of 4)"))
+		})
+
+		It("gives up after the configured number of retries", func() {
+			attempts := 0
+			err := policy.Do(logger, "npm install", func(out io.Writer) error {
+				attempts++
+				return failWith("npm ERR! network socket hang up")(out)
+			})
+			Expect(err).To(MatchError("exit status 1"))
+			Expect(attempts).To(Equal(4))
+			Expect(sleeps).To(HaveLen(3))
+		})
+
+		It("caps the delay", func() {
+			policy.Delay = 20 * time.Second
+			_ = policy.Do(logger, "npm install", failWith("getaddrinfo EAI_AGAIN registry.npmjs.org"))
+			Expect(sleeps).To(Equal([]time.Duration{20 * time.Second, retry.MaxDelay, retry.MaxDelay}))
+		})
+
+		It("does not retry failures that are not transient", func() {
+			attempts := 0
+			err := policy.Do(logger, "npm install", func(out io.Writer) error {
+				attempts++
+				return failWith("npm ERR! code E404")(out)
+			})
+			Expect(err).To(MatchError("exit status 1"))
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("does not retry when retries are disabled", func() {
+			policy.Retries = 0
+			attempts := 0
+			_ = policy.Do(logger, "npm install", func(out io.Writer) error {
+				attempts++
+				return failWith("npm ERR! code ECONNRESET")(out)
+			})
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("sends the output to the log", func() {
+			_ = policy.Do(logger, "npm install", func(out io.Writer) error {
+				fmt.Fprintln(out, "added 12 packages")
+				return nil
+			})
+			Expect(buffer.String()).To(ContainSubstring("added 12 packages"))
+		})
+	})
+
+	Describe("Run", func() {
+		It("retries while the attempt reports its error as transient", func() {
+			attempts := 0
+			err := policy.Run(logger, "Downloading agent", func() (bool, error) {
+				attempts++
+				return attempts < 4, errors.New("503 Service Unavailable")
+			})
+			Expect(err).To(MatchError("503 Service Unavailable"))
+			Expect(attempts).To(Equal(4))
+			Expect(sleeps).To(Equal([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second}))
+			Expect(buffer.String()).To(ContainSubstring("Downloading agent failed with a network error, retrying in 1s (attempt 2 of 4)"))
+		})
+
+		It("stops at the first error that is not transient", func() {
+			attempts := 0
+			err := policy.Run(logger, "Downloading agent", func() (bool, error) {
+				attempts++
+				return false, errors.New("404 Not Found")
+			})
+			Expect(err).To(MatchError("404 Not Found"))
+			Expect(attempts).To(Equal(1))
+			Expect(sleeps).To(BeEmpty())
+		})
+	})
+
+	Describe("IsTransient", func() {
+		It("recognises network errors in the output", func() {
+			Expect(retry.IsTransient(errors.New("exit status 1"), []byte("npm ERR! code ETIMEDOUT"))).To(BeTrue())
+			Expect(retry.IsTransient(errors.New("exit status 1"), []byte("info There appears to be trouble with your network connection. Retrying..."))).To(BeTrue())
+			Expect(retry.IsTransient(errors.New("exit status 1"), []byte("npm ERR! 503 Service Unavailable - GET https://registry.npmjs.org/express"))).To(BeTrue())
+			Expect(retry.IsTransient(errors.New("exit status 1"), []byte("npm ERR! code ERESOLVE"))).To(BeFalse())
+		})
+
+		It("does not retry a process that was killed", func() {
+			cmd := exec.Command("sh", "-c", "kill -9 $$")
+			err := cmd.Run()
+			Expect(err).To(HaveOccurred())
+			Expect(retry.IsTransient(err, []byte("npm ERR! code ECONNRESET"))).To(BeFalse())
+		})
+	})
+
+	Describe("Default", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv(retry.RetriesEnv)).To(Succeed())
+		})
+
+		It("retries twice by default", func() {
+			Expect(retry.Default(logger).Retries).To(Equal(retry.DefaultRetries))
+			Expect(retry.Default(logger).Delay).To(Equal(retry.DefaultDelay))
+		})
+
+		It("reads the number of retries from the environment", func() {
+			Expect(os.Setenv(retry.RetriesEnv, "5")).To(Succeed())
+			Expect(retry.Default(logger).Retries).To(Equal(5))
+		})
+
+		It("warns about and ignores an invalid number of retries", func() {
+			Expect(os.Setenv(retry.RetriesEnv, "lots")).To(Succeed())
+			Expect(retry.Default(logger).Retries).To(Equal(retry.DefaultRetries))
+			Expect(buffer.String()).To(ContainSubstring("Ignoring NODE_INSTALL_RETRIES=lots"))
+		})
+	})
+})
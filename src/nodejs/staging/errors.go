@@ -0,0 +1,185 @@
+package staging
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Kind classifies a staging failure. Each kind has a stable exit code so
+// that platform tooling can tell failures apart without parsing logs.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Configuration
+	VersionResolution
+	PackageManager
+	Network
+	Disk
+	UserScript
+)
+
+// Exit codes for classified failures. Unclassified failures keep the exit
+// code of the phase that failed (14 for supply, 12 for finalize).
+const (
+	ExitConfiguration     = 20
+	ExitVersionResolution = 21
+	ExitPackageManager    = 22
+	ExitNetwork           = 23
+	ExitDisk              = 24
+	ExitUserScript        = 25
+)
+
+const docsURL = "https://docs.cloudfoundry.org/buildpacks/node/"
+
+type kindInfo struct {
+	name     string
+	exitCode int
+	hint     string
+	docs     string
+}
+
+var kinds = map[Kind]kindInfo{
+	Configuration: {
+		name:     "configuration",
+		exitCode: ExitConfiguration,
+		hint:     "Check package.json, .nvmrc and the buildpack environment variables for mistakes",
+		docs:     docsURL + "index.html",
+	},
+	VersionResolution: {
+		name:     "version resolution",
+		exitCode: ExitVersionResolution,
+		hint:     "Request a version range that this buildpack provides, or remove the version constraint to use the default",
+		docs:     docsURL + "node-tips.html",
+	},
+	PackageManager: {
+		name:     "package manager",
+		exitCode: ExitPackageManager,
+		hint:     "Make sure the app installs locally with the same lockfile, and commit package-lock.json or yarn.lock",
+		docs:     docsURL + "index.html",
+	},
+	Network: {
+		name:     "network",
+		exitCode: ExitNetwork,
+		hint:     "The registry or download server could not be reached; check HTTP_PROXY/HTTPS_PROXY, or vendor node_modules for offline staging",
+		docs:     "https://docs.cloudfoundry.org/buildpacks/proxy-usage.html",
+	},
+	Disk: {
+		name:     "disk",
+		exitCode: ExitDisk,
+		hint:     "Staging ran out of disk space; increase the app's disk quota or reduce the size of its dependencies",
+		docs:     "https://docs.cloudfoundry.org/devguide/deploy-apps/large-app-deploy.html",
+	},
+	UserScript: {
+		name:     "user script",
+		exitCode: ExitUserScript,
+		hint:     "A script from package.json failed; reproduce it locally with the same node and package manager versions",
+		docs:     docsURL + "node-tips.html",
+	},
+}
+
+func (k Kind) String() string {
+	if info, ok := kinds[k]; ok {
+		return info.name
+	}
+	return "unknown"
+}
+
+// Error is a staging failure of a known kind. Hint, when set, replaces the
+// kind's default remediation advice.
+type Error struct {
+	Kind Kind
+	Hint string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap classifies err as kind. Errors caused by a full disk or an
+// unreachable host are classified as Disk or Network regardless of kind, and
+// errors that are already classified are returned unchanged.
+func Wrap(kind Kind, err error) error {
+	return WrapWithHint(kind, err, "")
+}
+
+// WrapWithHint is Wrap with remediation advice specific to the failure.
+func WrapWithHint(kind Kind, err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+
+	var stagingErr *Error
+	if errors.As(err, &stagingErr) {
+		return err
+	}
+
+	if cause := rootCause(err); cause != Unknown {
+		kind = cause
+	}
+
+	return &Error{Kind: kind, Hint: hint, Err: err}
+}
+
+// KindOf returns the kind of a staging failure, or Unknown.
+func KindOf(err error) Kind {
+	var stagingErr *Error
+	if errors.As(err, &stagingErr) {
+		return stagingErr.Kind
+	}
+	return Unknown
+}
+
+// ExitCode returns the exit code for err, or fallback when err has not been
+// classified.
+func ExitCode(err error, fallback int) int {
+	if info, ok := kinds[KindOf(err)]; ok {
+		return info.exitCode
+	}
+	return fallback
+}
+
+// LogHint prints remediation advice and a documentation link for a
+// classified failure. It does nothing for nil or unclassified errors.
+func LogHint(log *libbuildpack.Logger, err error) {
+	var stagingErr *Error
+	if !errors.As(err, &stagingErr) {
+		return
+	}
+
+	info, ok := kinds[stagingErr.Kind]
+	if !ok {
+		return
+	}
+
+	hint := info.hint
+	if stagingErr.Hint != "" {
+		hint = stagingErr.Hint
+	}
+
+	log.Error("Staging failed (%s error, exit code %d)", info.name, info.exitCode)
+	log.Protip(hint, info.docs)
+}
+
+func rootCause(err error) Kind {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return Disk
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return Network
+	}
+
+	return Unknown
+}
@@ -0,0 +1,93 @@
+package staging_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"syscall"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	Describe("Wrap", func() {
+		It("returns nil for a nil error", func() {
+			Expect(staging.Wrap(staging.PackageManager, nil)).To(BeNil())
+		})
+
+		It("classifies the error with the given kind", func() {
+			err := staging.Wrap(staging.UserScript, errors.New("exit status 1"))
+			Expect(err).To(MatchError("exit status 1"))
+			Expect(staging.KindOf(err)).To(Equal(staging.UserScript))
+		})
+
+		It("keeps the kind of an already classified error", func() {
+			inner := staging.Wrap(staging.VersionResolution, errors.New("no match"))
+			err := staging.Wrap(staging.PackageManager, fmt.Errorf("installing: %w", inner))
+			Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
+		})
+
+		It("classifies a full disk as a disk failure", func() {
+			err := staging.Wrap(staging.PackageManager, &os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC})
+			Expect(staging.KindOf(err)).To(Equal(staging.Disk))
+		})
+
+		It("classifies an unreachable host as a network failure", func() {
+			err := staging.Wrap(staging.Unknown, &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection refused")})
+			Expect(staging.KindOf(err)).To(Equal(staging.Network))
+		})
+	})
+
+	Describe("ExitCode", func() {
+		It("returns the stable exit code of the kind", func() {
+			Expect(staging.ExitCode(staging.Wrap(staging.Configuration, errors.New("x")), 14)).To(Equal(20))
+			Expect(staging.ExitCode(staging.Wrap(staging.VersionResolution, errors.New("x")), 14)).To(Equal(21))
+			Expect(staging.ExitCode(staging.Wrap(staging.PackageManager, errors.New("x")), 14)).To(Equal(22))
+			Expect(staging.ExitCode(staging.Wrap(staging.Network, errors.New("x")), 14)).To(Equal(23))
+			Expect(staging.ExitCode(staging.Wrap(staging.Disk, errors.New("x")), 14)).To(Equal(24))
+			Expect(staging.ExitCode(staging.Wrap(staging.UserScript, errors.New("x")), 14)).To(Equal(25))
+		})
+
+		It("returns the fallback for unclassified errors", func() {
+			Expect(staging.ExitCode(errors.New("x"), 14)).To(Equal(14))
+			Expect(staging.ExitCode(staging.Wrap(staging.Unknown, errors.New("x")), 12)).To(Equal(12))
+		})
+	})
+
+	Describe("LogHint", func() {
+		var (
+			buffer *bytes.Buffer
+			logger *libbuildpack.Logger
+		)
+
+		BeforeEach(func() {
+			buffer = new(bytes.Buffer)
+			logger = libbuildpack.NewLogger(buffer)
+		})
+
+		It("prints the remediation hint and docs link", func() {
+			staging.LogHint(logger, staging.Wrap(staging.VersionResolution, errors.New("x")))
+			Expect(buffer.String()).To(ContainSubstring("Staging failed (version resolution error, exit code 21)"))
+			Expect(buffer.String()).To(ContainSubstring("Request a version range that this buildpack provides"))
+			Expect(buffer.String()).To(ContainSubstring("https://docs.cloudfoundry.org/buildpacks/node/node-tips.html"))
+		})
+
+		It("prefers a hint specific to the failure", func() {
+			staging.LogHint(logger, staging.WrapWithHint(staging.UserScript, errors.New("x"), "Fix the build script"))
+			Expect(buffer.String()).To(ContainSubstring("Fix the build script"))
+			Expect(buffer.String()).NotTo(ContainSubstring("reproduce it locally"))
+		})
+
+		It("prints nothing for unclassified errors", func() {
+			staging.LogHint(logger, errors.New("x"))
+			staging.LogHint(logger, nil)
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+})
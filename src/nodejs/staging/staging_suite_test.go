@@ -0,0 +1,13 @@
+package staging_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStaging(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Staging Suite")
+}
@@ -0,0 +1,100 @@
+package staticsite
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const (
+	// ModeServe serves the build output with the bundled static server.
+	ModeServe = "serve"
+	// ModeStaticfile leaves the build output for a following staticfile
+	// buildpack.
+	ModeStaticfile = "staticfile"
+
+	ModeEnv      = "NODE_STATIC_MODE"
+	OutputDirEnv = "NODE_STATIC_DIR"
+
+	ServerScript = "static/server.js"
+	Staticfile   = "Staticfile"
+)
+
+var outputDirs = []string{"dist", "build", "out"}
+
+// Mode returns the static site mode requested through NODE_STATIC_MODE, or
+// an empty string when the app is not built as a static site.
+func Mode() (string, error) {
+	switch mode := os.Getenv(ModeEnv); mode {
+	case "", ModeServe, ModeStaticfile:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s must be %q or %q, got %q", ModeEnv, ModeServe, ModeStaticfile, mode)
+	}
+}
+
+// OutputDir returns the directory, relative to buildDir, that holds the
+// built site. NODE_STATIC_DIR takes precedence over the conventional dist/,
+// build/ and out/ directories; Angular's dist/<project>[/browser] layout is
+// also recognised.
+func OutputDir(buildDir string) (string, error) {
+	if dir := os.Getenv(OutputDirEnv); dir != "" {
+		if exists, err := libbuildpack.FileExists(filepath.Join(buildDir, dir)); err != nil {
+			return "", err
+		} else if !exists {
+			return "", fmt.Errorf("%s is set to %s, which does not exist", OutputDirEnv, dir)
+		}
+		return path.Clean(filepath.ToSlash(dir)), nil
+	}
+
+	for _, dir := range outputDirs {
+		if found, err := hasIndex(buildDir, dir); err != nil {
+			return "", err
+		} else if found {
+			return dir, nil
+		}
+	}
+
+	projects, err := os.ReadDir(filepath.Join(buildDir, "dist"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name() < projects[j].Name() })
+	for _, project := range projects {
+		if !project.IsDir() {
+			continue
+		}
+
+		for _, dir := range []string{path.Join("dist", project.Name(), "browser"), path.Join("dist", project.Name())} {
+			if found, err := hasIndex(buildDir, dir); err != nil {
+				return "", err
+			} else if found {
+				return dir, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no index.html found in dist/, build/ or out/, set %s to the build output directory", OutputDirEnv)
+}
+
+// WriteStaticfile configures the staticfile buildpack to serve outputDir
+// with pushstate routing, unless the app ships its own Staticfile. It reports
+// whether a Staticfile was written.
+func WriteStaticfile(buildDir, outputDir string) (bool, error) {
+	staticfilePath := filepath.Join(buildDir, Staticfile)
+	if exists, err := libbuildpack.FileExists(staticfilePath); err != nil || exists {
+		return false, err
+	}
+
+	contents := fmt.Sprintf("root: %s\npushstate: enabled\n", outputDir)
+	return true, os.WriteFile(staticfilePath, []byte(contents), 0644)
+}
+
+func hasIndex(buildDir, dir string) (bool, error) {
+	return libbuildpack.FileExists(filepath.Join(buildDir, filepath.FromSlash(dir), "index.html"))
+}
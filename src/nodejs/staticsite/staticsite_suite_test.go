@@ -0,0 +1,13 @@
+package staticsite_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStaticSite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "StaticSite Suite")
+}
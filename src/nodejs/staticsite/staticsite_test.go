@@ -0,0 +1,119 @@
+package staticsite_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staticsite"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StaticSite", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeIndex := func(dir string) {
+		Expect(os.MkdirAll(filepath.Join(buildDir, dir), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(buildDir, dir, "index.html"), []byte("<html></html>"), 0644)).To(Succeed())
+	}
+
+	Describe("Mode", func() {
+		var oldMode string
+
+		BeforeEach(func() {
+			oldMode = os.Getenv("NODE_STATIC_MODE")
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", oldMode)).To(Succeed())
+		})
+
+		It("accepts serve and staticfile", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "serve")).To(Succeed())
+			Expect(staticsite.Mode()).To(Equal(staticsite.ModeServe))
+
+			Expect(os.Setenv("NODE_STATIC_MODE", "staticfile")).To(Succeed())
+			Expect(staticsite.Mode()).To(Equal(staticsite.ModeStaticfile))
+		})
+
+		It("is empty when unset", func() {
+			Expect(os.Unsetenv("NODE_STATIC_MODE")).To(Succeed())
+			Expect(staticsite.Mode()).To(Equal(""))
+		})
+
+		It("rejects unknown modes", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "nginx")).To(Succeed())
+			_, err := staticsite.Mode()
+			Expect(err).To(MatchError(ContainSubstring(`NODE_STATIC_MODE must be "serve" or "staticfile", got "nginx"`)))
+		})
+	})
+
+	Describe("OutputDir", func() {
+		var oldDir string
+
+		BeforeEach(func() {
+			oldDir = os.Getenv("NODE_STATIC_DIR")
+			Expect(os.Unsetenv("NODE_STATIC_DIR")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_STATIC_DIR", oldDir)).To(Succeed())
+		})
+
+		It("finds conventional output directories", func() {
+			writeIndex("build")
+			Expect(staticsite.OutputDir(buildDir)).To(Equal("build"))
+
+			writeIndex("dist")
+			Expect(staticsite.OutputDir(buildDir)).To(Equal("dist"))
+		})
+
+		It("finds Angular project output", func() {
+			writeIndex(filepath.Join("dist", "my-app", "browser"))
+			Expect(staticsite.OutputDir(buildDir)).To(Equal("dist/my-app/browser"))
+		})
+
+		It("uses NODE_STATIC_DIR when set", func() {
+			writeIndex("public")
+			Expect(os.Setenv("NODE_STATIC_DIR", "public")).To(Succeed())
+			Expect(staticsite.OutputDir(buildDir)).To(Equal("public"))
+		})
+
+		It("fails when NODE_STATIC_DIR does not exist", func() {
+			Expect(os.Setenv("NODE_STATIC_DIR", "www")).To(Succeed())
+			_, err := staticsite.OutputDir(buildDir)
+			Expect(err).To(MatchError(ContainSubstring("NODE_STATIC_DIR is set to www, which does not exist")))
+		})
+
+		It("fails when nothing was built", func() {
+			_, err := staticsite.OutputDir(buildDir)
+			Expect(err).To(MatchError(ContainSubstring("no index.html found")))
+		})
+	})
+
+	Describe("WriteStaticfile", func() {
+		It("writes a Staticfile for the output directory", func() {
+			Expect(staticsite.WriteStaticfile(buildDir, "dist")).To(BeTrue())
+			Expect(os.ReadFile(filepath.Join(buildDir, "Staticfile"))).To(Equal([]byte("root: dist\npushstate: enabled\n")))
+		})
+
+		It("keeps an existing Staticfile", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "Staticfile"), []byte("root: public\n"), 0644)).To(Succeed())
+			Expect(staticsite.WriteStaticfile(buildDir, "dist")).To(BeFalse())
+			Expect(os.ReadFile(filepath.Join(buildDir, "Staticfile"))).To(Equal([]byte("root: public\n")))
+		})
+	})
+})
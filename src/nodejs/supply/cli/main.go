@@ -5,20 +5,40 @@ import (
 	"os"
 	"time"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/bun"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/deno"
 	_ "github.com/cloudfoundry/nodejs-buildpack/src/nodejs/hooks"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/npm"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/supply"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/yarn"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
+// Exit codes for failures outside of supply.Run. Failures inside it exit
+// with exitSupplyFailed, or with the code of their staging.Kind.
+const (
+	exitLogfile          = 8
+	exitBuildpackDir     = 9
+	exitManifest         = 10
+	exitInvalidBuildpack = 11
+	exitBeforeCompile    = 12
+	exitEnvironment      = 13
+	exitSupplyFailed     = 14
+	exitConfigYml        = 15
+	exitOverride         = 17
+	exitAppCache         = 18
+	exitAppCacheCleanup  = 19
+)
+
 func main() {
 	logfile, err := os.CreateTemp("", "cloudfoundry.nodejs-buildpack.supply")
 	if err != nil {
 		logger := libbuildpack.NewLogger(os.Stdout)
 		logger.Error("Unable to create log file: %s", err.Error())
-		os.Exit(8)
+		os.Exit(exitLogfile)
 	}
 	defer logfile.Close()
 
@@ -28,70 +48,84 @@ func main() {
 	buildpackDir, err := libbuildpack.GetBuildpackDir()
 	if err != nil {
 		logger.Error("Unable to determine buildpack directory: %s", err.Error())
-		os.Exit(9)
+		os.Exit(exitBuildpackDir)
 	}
 
 	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
 	if err != nil {
 		logger.Error("Unable to load buildpack manifest: %s", err.Error())
-		os.Exit(10)
+		os.Exit(exitManifest)
 	}
 	installer := libbuildpack.NewInstaller(manifest)
 
 	stager := libbuildpack.NewStager(os.Args[1:], logger, manifest)
 	if err := stager.CheckBuildpackValid(); err != nil {
-		os.Exit(11)
+		os.Exit(exitInvalidBuildpack)
 	}
 
 	if err = installer.SetAppCacheDir(stager.CacheDir()); err != nil {
 		logger.Error("Unable to setup appcache: %s", err)
-		os.Exit(18)
+		os.Exit(exitAppCache)
 	}
 	if err = manifest.ApplyOverride(stager.DepsDir()); err != nil {
 		logger.Error("Unable to apply override.yml files: %s", err)
-		os.Exit(17)
+		os.Exit(exitOverride)
 	}
 
 	err = libbuildpack.RunBeforeCompile(stager)
 	if err != nil {
 		logger.Error("Before Compile: %s", err.Error())
-		os.Exit(12)
+		os.Exit(exitBeforeCompile)
 	}
 
 	err = stager.SetStagingEnvironment()
 	if err != nil {
 		logger.Error("Unable to setup environment variables: %s", err.Error())
-		os.Exit(13)
+		os.Exit(exitEnvironment)
 	}
 
+	retryPolicy := retry.Default(logger)
 	s := supply.Supplier{
 		Logfile: logfile,
 		Stager:  stager,
 		Yarn: &yarn.Yarn{
 			Command: &libbuildpack.Command{},
 			Log:     logger,
+			Retry:   retryPolicy,
 		},
 		NPM: &npm.NPM{
 			Command: &libbuildpack.Command{},
 			Log:     logger,
+			Retry:   retryPolicy,
+		},
+		Bun: &bun.Bun{
+			Command: &libbuildpack.Command{},
+			Log:     logger,
+			Retry:   retryPolicy,
+		},
+		Deno: &deno.Deno{
+			Command: &libbuildpack.Command{},
+			Log:     logger,
+			Retry:   retryPolicy,
 		},
 		Manifest:  manifest,
 		Installer: installer,
 		Log:       logger,
 		Command:   &libbuildpack.Command{},
+		Retry:     retryPolicy,
 	}
 
 	err = supply.Run(&s)
 	if err != nil {
-		os.Exit(14)
+		os.Exit(staging.ExitCode(err, exitSupplyFailed))
 	}
 
 	if err := stager.WriteConfigYml(nil); err != nil {
 		logger.Error("Error writing config.yml: %s", err.Error())
-		os.Exit(15)
+		os.Exit(exitConfigYml)
 	}
 	if err = installer.CleanupAppCache(); err != nil {
 		logger.Error("Unable to clean up app cache: %s", err)
-		os.Exit(19)
+		os.Exit(exitAppCacheCleanup)
 	}
 }
@@ -106,6 +106,20 @@ func (mr *MockManifestMockRecorder) DefaultVersion(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DefaultVersion", reflect.TypeOf((*MockManifest)(nil).DefaultVersion), arg0)
 }
 
+// IsCached mocks base method.
+func (m *MockManifest) IsCached() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsCached")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsCached indicates an expected call of IsCached.
+func (mr *MockManifestMockRecorder) IsCached() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsCached", reflect.TypeOf((*MockManifest)(nil).IsCached))
+}
+
 // MockInstaller is a mock of Installer interface.
 type MockInstaller struct {
 	ctrl     *gomock.Controller
@@ -143,18 +157,18 @@ func (mr *MockInstallerMockRecorder) InstallDependency(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependency", reflect.TypeOf((*MockInstaller)(nil).InstallDependency), arg0, arg1)
 }
 
-// InstallOnlyVersion mocks base method.
-func (m *MockInstaller) InstallOnlyVersion(arg0, arg1 string) error {
+// InstallDependencyWithStrip mocks base method.
+func (m *MockInstaller) InstallDependencyWithStrip(arg0 libbuildpack.Dependency, arg1 string, arg2 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InstallOnlyVersion", arg0, arg1)
+	ret := m.ctrl.Call(m, "InstallDependencyWithStrip", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// InstallOnlyVersion indicates an expected call of InstallOnlyVersion.
-func (mr *MockInstallerMockRecorder) InstallOnlyVersion(arg0, arg1 interface{}) *gomock.Call {
+// InstallDependencyWithStrip indicates an expected call of InstallDependencyWithStrip.
+func (mr *MockInstallerMockRecorder) InstallDependencyWithStrip(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallOnlyVersion", reflect.TypeOf((*MockInstaller)(nil).InstallOnlyVersion), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallDependencyWithStrip", reflect.TypeOf((*MockInstaller)(nil).InstallDependencyWithStrip), arg0, arg1, arg2)
 }
 
 // MockNPM is a mock of NPM interface.
@@ -194,6 +208,20 @@ func (mr *MockNPMMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockNPM)(nil).Build), arg0, arg1)
 }
 
+// Prune mocks base method.
+func (m *MockNPM) Prune(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockNPMMockRecorder) Prune(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockNPM)(nil).Prune), arg0)
+}
+
 // Rebuild mocks base method.
 func (m *MockNPM) Rebuild(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -245,6 +273,108 @@ func (mr *MockYarnMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockYarn)(nil).Build), arg0, arg1)
 }
 
+// Prune mocks base method.
+func (m *MockYarn) Prune(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockYarnMockRecorder) Prune(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockYarn)(nil).Prune), arg0, arg1)
+}
+
+// MockBun is a mock of Bun interface.
+type MockBun struct {
+	ctrl     *gomock.Controller
+	recorder *MockBunMockRecorder
+}
+
+// MockBunMockRecorder is the mock recorder for MockBun.
+type MockBunMockRecorder struct {
+	mock *MockBun
+}
+
+// NewMockBun creates a new mock instance.
+func NewMockBun(ctrl *gomock.Controller) *MockBun {
+	mock := &MockBun{ctrl: ctrl}
+	mock.recorder = &MockBunMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBun) EXPECT() *MockBunMockRecorder {
+	return m.recorder
+}
+
+// Build mocks base method.
+func (m *MockBun) Build(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Build", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Build indicates an expected call of Build.
+func (mr *MockBunMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockBun)(nil).Build), arg0, arg1)
+}
+
+// Prune mocks base method.
+func (m *MockBun) Prune(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prune", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune.
+func (mr *MockBunMockRecorder) Prune(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockBun)(nil).Prune), arg0, arg1)
+}
+
+// MockDeno is a mock of Deno interface.
+type MockDeno struct {
+	ctrl     *gomock.Controller
+	recorder *MockDenoMockRecorder
+}
+
+// MockDenoMockRecorder is the mock recorder for MockDeno.
+type MockDenoMockRecorder struct {
+	mock *MockDeno
+}
+
+// NewMockDeno creates a new mock instance.
+func NewMockDeno(ctrl *gomock.Controller) *MockDeno {
+	mock := &MockDeno{ctrl: ctrl}
+	mock.recorder = &MockDenoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeno) EXPECT() *MockDenoMockRecorder {
+	return m.recorder
+}
+
+// Build mocks base method.
+func (m *MockDeno) Build(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Build", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Build indicates an expected call of Build.
+func (mr *MockDenoMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockDeno)(nil).Build), arg0, arg1)
+}
+
 // MockStager is a mock of Stager interface.
 type MockStager struct {
 	ctrl     *gomock.Controller
@@ -365,17 +495,3 @@ func (mr *MockStagerMockRecorder) WriteEnvFile(arg0, arg1 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteEnvFile", reflect.TypeOf((*MockStager)(nil).WriteEnvFile), arg0, arg1)
 }
-
-// WriteProfileD mocks base method.
-func (m *MockStager) WriteProfileD(arg0, arg1 string) error {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WriteProfileD", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
-}
-
-// WriteProfileD indicates an expected call of WriteProfileD.
-func (mr *MockStagerMockRecorder) WriteProfileD(arg0, arg1 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteProfileD", reflect.TypeOf((*MockStager)(nil).WriteProfileD), arg0, arg1)
-}
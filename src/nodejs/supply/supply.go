@@ -11,18 +11,32 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/bun"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/changes"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/deno"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/diagnose"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/framework"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/package_json"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/profiled"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staticsite"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/timing"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/typescript"
 
 	"github.com/cloudfoundry/libbuildpack"
-	"github.com/cloudfoundry/libbuildpack/checksum"
 )
 
 const (
 	UnmetDependency     = "unmet dependency"
 	UnmetPeerDependency = "unmet peer dependency"
+
+	NPMRegistryFallbackEnv = "NODE_NPM_REGISTRY_FALLBACK"
 )
 
 type Command interface {
@@ -32,20 +46,32 @@ type Command interface {
 type Manifest interface {
 	AllDependencyVersions(string) []string
 	DefaultVersion(string) (libbuildpack.Dependency, error)
+	IsCached() bool
 }
 
 type Installer interface {
 	InstallDependency(libbuildpack.Dependency, string) error
-	InstallOnlyVersion(string, string) error
+	InstallDependencyWithStrip(libbuildpack.Dependency, string, int) error
 }
 
 type NPM interface {
 	Build(string, string) error
 	Rebuild(string) error
+	Prune(string) error
 }
 
 type Yarn interface {
 	Build(string, string) error
+	Prune(string, string) error
+}
+
+type Bun interface {
+	Build(string, string) error
+	Prune(string, string) error
+}
+
+type Deno interface {
+	Build(string, string) error
 }
 
 type Stager interface {
@@ -55,7 +81,6 @@ type Stager interface {
 	DepsIdx() string
 	LinkDirectoryInDepDir(string, string) error
 	WriteEnvFile(string, string) error
-	WriteProfileD(string, string) error
 	SetStagingEnvironment() error
 }
 
@@ -70,16 +95,29 @@ type Supplier struct {
 	PackageJSONNodeVersion string
 	NvmrcNodeVersion       string
 	YarnVersion            string
+	PackageManager         string
+	BunVersion             string
 	NPMVersion             string
 	PreBuild               string
 	StartScript            string
+	BuildScript            string
 	HasDevDependencies     bool
+	IsTypeScript           bool
+	Framework              *framework.Framework
+	StaticMode             string
 	PostBuild              string
 	UseYarn                bool
+	UseBun                 bool
+	UseDeno                bool
 	UsesYarnWorkspaces     bool
 	IsVendored             bool
 	Yarn                   Yarn
+	Bun                    Bun
+	Deno                   Deno
 	NPM                    NPM
+	Retry                  retry.Policy
+	Report                 report.Report
+	Timer                  *timing.Timer
 }
 
 var LTS = map[string]int{
@@ -88,60 +126,88 @@ var LTS = map[string]int{
 }
 
 func Run(s *Supplier) error {
-	return checksum.Do(s.Stager.BuildDir(), s.Log.Debug, func() error {
+	if s.Timer == nil {
+		s.Timer = timing.New("supply", s.Log)
+	}
+
+	changeTracking, err := changes.Mode()
+	if err != nil {
+		s.Log.Warning("%s, using %s", err.Error(), changeTracking)
+	}
+
+	err = changes.Do(s.Stager.BuildDir(), changeTracking, s.Log.Debug, func() error {
 		s.Log.BeginStep("Bootstrapping python")
-		if err := s.BootstrapPython(); err != nil {
+		if err := s.Timer.Time("Bootstrap python", s.BootstrapPython); err != nil {
 			s.Log.Error("Unable to bootstrap python: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Unknown, err)
 		}
 
 		s.Log.BeginStep("Installing binaries")
 
-		if err := s.LoadPackageJSON(); err != nil {
+		if err := s.Timer.Time("Load package.json", s.LoadPackageJSON); err != nil {
 			s.Log.Error("Unable to load package.json: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Configuration, err)
 		}
 
 		if err := s.LoadNvmrc(); err != nil {
 			s.Log.Error("Unable to load .nvmrc: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Configuration, err)
 		}
 
 		s.WarnNodeEngine()
 
-		if err := s.ChooseNodeVersion(); err != nil {
+		if err := s.Timer.Time("Choose node version", s.ChooseNodeVersion); err != nil {
 			s.Log.Error("Unable to install node: %s", err.Error())
-			return err
+			return staging.Wrap(staging.VersionResolution, err)
 		}
 
-		if err := s.InstallNode(); err != nil {
+		if err := s.Timer.Time("Install node", s.InstallNode); err != nil {
 			s.Log.Error("Unable to install node: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Unknown, err)
 		}
 
-		if err := s.InstallNPM(); err != nil {
+		if err := s.Timer.Time("Install npm", s.InstallNPM); err != nil {
 			s.Log.Error("Unable to install npm: %s", err.Error())
-			return err
+			return staging.Wrap(staging.PackageManager, err)
 		}
 
-		if err := s.InstallYarn(); err != nil {
+		if err := s.Timer.Time("Install yarn", s.InstallYarn); err != nil {
 			s.Log.Error("Unable to install yarn: %s", err.Error())
-			return err
+			return staging.Wrap(staging.PackageManager, err)
+		}
+
+		if s.UseBun {
+			if err := s.Timer.Time("Install bun", s.InstallBun); err != nil {
+				s.Log.Error("Unable to install bun: %s", err.Error())
+				return staging.Wrap(staging.PackageManager, err)
+			}
+		}
+
+		if s.UseDeno {
+			if err := s.Timer.Time("Install deno", s.InstallDeno); err != nil {
+				s.Log.Error("Unable to install deno: %s", err.Error())
+				return staging.Wrap(staging.PackageManager, err)
+			}
 		}
 
 		if err := s.CreateDefaultEnv(); err != nil {
 			s.Log.Error("Unable to setup default environment: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Unknown, err)
 		}
 
 		if err := s.Stager.SetStagingEnvironment(); err != nil {
 			s.Log.Error("Unable to setup environment variables: %s", err.Error())
-			os.Exit(11)
+			return staging.Wrap(staging.Unknown, err)
 		}
 
 		if err := s.ReadPackageJSON(); err != nil {
 			s.Log.Error("Failed parsing package.json: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Configuration, err)
+		}
+
+		if err := s.LoadStaticMode(); err != nil {
+			s.Log.Error(err.Error())
+			return staging.Wrap(staging.Configuration, err)
 		}
 
 		if err := s.TipVendorDependencies(); err != nil {
@@ -156,9 +222,9 @@ func Run(s *Supplier) error {
 
 		s.ListNodeConfig(os.Environ())
 
-		if err := s.OverrideCacheFromApp(); err != nil {
+		if err := s.Timer.Time("Restore cache", s.OverrideCacheFromApp); err != nil {
 			s.Log.Error("Unable to copy cache directories: %s", err.Error())
-			return err
+			return staging.Wrap(staging.Unknown, err)
 		}
 
 		defer func() {
@@ -167,19 +233,24 @@ func Run(s *Supplier) error {
 			s.WarnMissingDevDeps()
 		}()
 
-		if err := s.BuildDependencies(); err != nil {
+		if err := s.Timer.Time("Build dependencies", s.BuildDependencies); err != nil {
 			s.Log.Error("Unable to build dependencies: %s", err.Error())
-			return err
+			s.ExplainBuildFailure()
+			return staging.Wrap(staging.PackageManager, err)
 		}
 
-		if !s.UseYarn || !s.UsesYarnWorkspaces {
-			if err := s.MoveDependencyArtifacts(); err != nil {
+		if (!s.UseYarn || !s.UsesYarnWorkspaces) && !s.UseBun && !s.UseDeno {
+			if err := s.Timer.Time("Move dependencies", s.MoveDependencyArtifacts); err != nil {
 				s.Log.Error("Unable to move dependencies: %s", err.Error())
-				return err
+				return staging.Wrap(staging.Unknown, err)
 			}
 		}
 
-		deps, err := s.ListDependencies()
+		var deps string
+		err := s.Timer.Time("List dependencies", func() (err error) {
+			deps, err = s.ListDependencies()
+			return err
+		})
 		if err != nil {
 			s.Log.Error(err.Error())
 			return err
@@ -194,6 +265,15 @@ func Run(s *Supplier) error {
 
 		return nil
 	})
+
+	staging.LogHint(s.Log, err)
+	s.Timer.PrintSummary()
+
+	if reportErr := s.WriteReport(); reportErr != nil {
+		s.Log.Warning("Unable to write staging report: %s", reportErr.Error())
+	}
+
+	return err
 }
 
 func (s *Supplier) BootstrapPython() error {
@@ -287,12 +367,23 @@ func (s *Supplier) runScript(script, tool string) error {
 	args := []string{"run", script}
 	if tool == "npm" {
 		args = append(args, "--if-present")
+	} else if tool == "deno" {
+		args = []string{"task", script}
 	}
 
 	s.Log.Info("Running %s (%s)", script, tool)
 
-	return s.Command.Execute(s.Stager.BuildDir(), os.Stdout, os.Stderr, tool, args...)
+	return s.timeScript(script, func() error {
+		return s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), tool, args...)
+	})
+}
 
+// timeScript runs a script and records it in the staging report.
+func (s *Supplier) timeScript(name string, run func() error) error {
+	start := time.Now()
+	err := run()
+	s.Report.AddScript(name, time.Since(start), err)
+	return err
 }
 
 func (s *Supplier) runPrebuild(tool string) error {
@@ -305,17 +396,56 @@ func (s *Supplier) runPrebuild(tool string) error {
 
 func (s *Supplier) BuildDependencies() error {
 	tool := "npm"
-	if s.UseYarn {
+	if s.UseBun {
+		tool = "bun"
+	} else if s.UseDeno {
+		tool = "deno"
+	} else if s.UseYarn {
 		tool = "yarn"
 	}
 
 	s.Log.BeginStep("Building dependencies")
 
+	keepDevDependencies := productionModeDisabled()
+	restoreEnv := func() {}
+	if s.StaticMode != "" {
+		s.Log.Info("Building a static site (%s=%s), installing devDependencies for the build", staticsite.ModeEnv, s.StaticMode)
+	} else if s.Framework != nil {
+		s.Log.Info("%s detected, installing devDependencies for the build", s.Framework.Name)
+	} else if s.IsTypeScript {
+		s.Log.Info("TypeScript detected (tsconfig.json), installing devDependencies for the build")
+	}
+	if s.buildsApp() {
+		restoreEnv = overrideEnv(map[string]string{
+			"NPM_CONFIG_PRODUCTION": "false",
+			"NPM_CONFIG_INCLUDE":    "dev",
+			"YARN_PRODUCTION":       "false",
+		})
+	}
+	defer restoreEnv()
+
 	if err := s.runPrebuild(tool); err != nil {
+		return staging.Wrap(staging.UserScript, err)
+	}
+
+	if err := s.reportInstall(tool); err != nil {
 		return err
 	}
 
 	switch {
+	case s.UseBun:
+		if err := s.Bun.Build(s.Stager.BuildDir(), s.Stager.CacheDir()); err != nil {
+			return err
+		}
+
+	case s.UseDeno:
+		if err := s.Deno.Build(s.Stager.BuildDir(), s.Stager.CacheDir()); err != nil {
+			return err
+		}
+		if err := s.installDenoDir(); err != nil {
+			return err
+		}
+
 	case s.UseYarn:
 		if err := s.Yarn.Build(s.Stager.BuildDir(), s.Stager.CacheDir()); err != nil {
 			return err
@@ -333,13 +463,280 @@ func (s *Supplier) BuildDependencies() error {
 		}
 	}
 
+	if s.Framework != nil {
+		if err := s.restoreFrameworkCache(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case s.PostBuild != "":
+		// heroku-postbuild replaces the default build
+	case s.StaticMode != "":
+		if err := s.buildStaticSite(tool); err != nil {
+			return staging.Wrap(staging.UserScript, err)
+		}
+	case s.Framework != nil:
+		if err := s.buildFramework(tool); err != nil {
+			return staging.Wrap(staging.UserScript, err)
+		}
+	case s.IsTypeScript:
+		if err := s.compileTypeScript(tool); err != nil {
+			return staging.Wrap(staging.UserScript, err)
+		}
+	}
+
 	if err := s.runPostbuild(tool); err != nil {
+		return staging.Wrap(staging.UserScript, err)
+	}
+
+	if s.Framework != nil {
+		if err := s.saveFrameworkCache(); err != nil {
+			return err
+		}
+
+		if s.Framework.AfterBuild != nil {
+			if err := s.Framework.AfterBuild(s.Stager.BuildDir()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.StaticMode != "" {
+		if err := s.PrepareStaticSite(); err != nil {
+			return staging.WrapWithHint(staging.Configuration, err, fmt.Sprintf("Set %s to the directory your build script writes to", staticsite.OutputDirEnv))
+		}
+	}
+
+	if s.buildsApp() && !s.IsVendored {
+		if keepDevDependencies {
+			s.Log.Info("Keeping devDependencies, production mode is turned off")
+			return nil
+		}
+		restoreEnv()
+		return s.pruneDevDependencies()
+	}
+
+	return nil
+}
+
+// reportInstall records how dependencies are about to be installed.
+func (s *Supplier) reportInstall(tool string) error {
+	s.Report.PackageManager = tool
+	s.Report.Vendored = s.IsVendored
+
+	switch {
+	case s.UseBun:
+		s.Report.InstallMode = "install"
+		s.Report.Cache.PackageManager = report.CacheStatus(bun.CacheDir(s.Stager.CacheDir()))
+	case s.UseDeno:
+		s.Report.InstallMode = "install"
+		s.Report.Cache.PackageManager = report.CacheStatus(deno.CacheDir(s.Stager.CacheDir()))
+	case s.UseYarn:
+		offline, err := libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "npm-packages-offline-cache"))
+		if err != nil {
+			return err
+		}
+		s.Report.InstallMode = "install"
+		s.Report.Offline = offline
+		s.Report.Cache.PackageManager = report.CacheStatus(filepath.Join(s.Stager.CacheDir(), ".cache", "yarn"))
+	case s.IsVendored:
+		s.Report.InstallMode = "rebuild"
+	default:
+		s.Report.InstallMode = "install"
+		s.Report.Cache.PackageManager = report.CacheStatus(filepath.Join(s.Stager.CacheDir(), ".npm"))
+	}
+
+	return nil
+}
+
+// WriteReport completes the staging report and writes it to the dep dir.
+func (s *Supplier) WriteReport() error {
+	if err := s.Logfile.Sync(); err != nil {
+		return err
+	}
+
+	if err := s.Report.AddWarnings(s.Logfile.Name()); err != nil {
+		return err
+	}
+
+	if s.Timer != nil {
+		s.Report.Phases = s.Timer.Phases
+	}
+
+	// MoveDependencyArtifacts moves node_modules to the dep dir unless the
+	// app is vendored or uses workspaces, so both places are measured
+	s.Report.NodeModulesSize = 0
+	for _, dir := range []string{s.Stager.BuildDir(), s.Stager.DepDir()} {
+		size, err := report.DirSize(filepath.Join(dir, "node_modules"))
+		if err != nil {
+			return err
+		}
+		s.Report.NodeModulesSize += size
+	}
+
+	if err := s.Report.Write(s.Stager.DepDir()); err != nil {
+		return err
+	}
+
+	return s.Report.PrintMarker(s.Log, "supply")
+}
+
+// buildsApp reports whether the app is compiled during staging, which
+// requires its devDependencies to be installed.
+func (s *Supplier) buildsApp() bool {
+	return s.IsTypeScript || s.Framework != nil || s.StaticMode != ""
+}
+
+func (s *Supplier) LoadStaticMode() error {
+	var err error
+	s.StaticMode, err = staticsite.Mode()
+	return err
+}
+
+func (s *Supplier) buildStaticSite(tool string) error {
+	switch {
+	case s.BuildScript != "":
+		return s.runScript("build", tool)
+	case s.Framework != nil:
+		return s.buildFramework(tool)
+	default:
+		return staging.Wrap(staging.Configuration, fmt.Errorf("%s=%s requires a build script in package.json", staticsite.ModeEnv, s.StaticMode))
+	}
+}
+
+func (s *Supplier) PrepareStaticSite() error {
+	outputDir, err := staticsite.OutputDir(s.Stager.BuildDir())
+	if err != nil {
+		return err
+	}
+
+	s.Log.Info("Static site output: %s", outputDir)
+
+	if s.StaticMode != staticsite.ModeStaticfile {
+		return nil
+	}
+
+	if written, err := staticsite.WriteStaticfile(s.Stager.BuildDir(), outputDir); err != nil {
+		return err
+	} else if written {
+		s.Log.Info("Wrote %s (root: %s) for the staticfile buildpack", staticsite.Staticfile, outputDir)
+	} else {
+		s.Log.Info("Using the app's %s", staticsite.Staticfile)
+	}
+
+	return nil
+}
+
+func (s *Supplier) buildFramework(tool string) error {
+	if s.BuildScript != "" {
+		return s.runScript("build", tool)
+	}
+
+	name := strings.Join(s.Framework.Build, " ")
+	s.Log.Info("Running %s (%s)", name, s.Framework.Name)
+	bin := filepath.Join(s.Stager.BuildDir(), "node_modules", ".bin", s.Framework.Build[0])
+	return s.timeScript(name, func() error {
+		return s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), bin, s.Framework.Build[1:]...)
+	})
+}
+
+func (s *Supplier) frameworkCacheDir() string {
+	return filepath.Join(s.Stager.CacheDir(), "framework")
+}
+
+func (s *Supplier) restoreFrameworkCache() error {
+	if len(s.Framework.CacheDirs) == 0 {
+		return nil
+	}
+
+	s.Log.Info("Restoring %s build cache", s.Framework.Name)
+	s.Report.Cache.Framework = report.CacheMiss
+	for _, dir := range s.Framework.CacheDirs {
+		if report.CacheStatus(filepath.Join(s.frameworkCacheDir(), dir)) == report.CacheHit {
+			s.Report.Cache.Framework = report.CacheHit
+		}
+	}
+	return copyAll(s.frameworkCacheDir(), s.Stager.BuildDir(), s.Framework.CacheDirs)
+}
+
+func (s *Supplier) saveFrameworkCache() error {
+	if len(s.Framework.CacheDirs) == 0 {
+		return nil
+	}
+
+	if err := copyAll(s.Stager.BuildDir(), s.frameworkCacheDir(), s.Framework.CacheDirs); err != nil {
 		return err
 	}
 
+	for _, dir := range s.Framework.CacheDirs {
+		if err := os.RemoveAll(filepath.Join(s.Stager.BuildDir(), dir)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (s *Supplier) compileTypeScript(tool string) error {
+	if s.BuildScript != "" {
+		return s.runScript("build", tool)
+	}
+
+	s.Log.Info("Compiling TypeScript (tsc)")
+	tsc := filepath.Join(s.Stager.BuildDir(), "node_modules", ".bin", "tsc")
+	return s.timeScript("tsc", func() error {
+		return s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), tsc, "--project", typescript.ConfigFile)
+	})
+}
+
+func (s *Supplier) pruneDevDependencies() error {
+	if s.UseDeno {
+		return nil
+	}
+
+	if s.UseBun {
+		return s.Bun.Prune(s.Stager.BuildDir(), s.Stager.CacheDir())
+	}
+
+	if s.UseYarn {
+		return s.Yarn.Prune(s.Stager.BuildDir(), s.Stager.CacheDir())
+	}
+
+	return s.NPM.Prune(s.Stager.BuildDir())
+}
+
+// productionModeDisabled reports whether the user turned production mode off
+// to keep devDependencies at runtime, so they must not be pruned after a
+// build.
+func productionModeDisabled() bool {
+	return os.Getenv("NPM_CONFIG_PRODUCTION") == "false" || os.Getenv("YARN_PRODUCTION") == "false"
+}
+
+// overrideEnv sets the given environment variables and returns a function
+// that restores their previous values.
+func overrideEnv(env map[string]string) func() {
+	previous := map[string]*string{}
+	for key, value := range env {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		os.Setenv(key, value)
+	}
+
+	return func() {
+		for key, old := range previous {
+			if old == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *old)
+			}
+		}
+	}
+}
+
 func (s *Supplier) MoveDependencyArtifacts() error {
 	if s.IsVendored {
 		return nil
@@ -371,68 +768,43 @@ func (s *Supplier) MoveDependencyArtifacts() error {
 func (s *Supplier) ReadPackageJSON() error {
 	var err error
 
-	type YarnWorkspace struct {
-		Packages []string `json:"packages"`
-		Nohoist  []string `json:"nohoist"`
-	}
-
-	type yarnStructObject struct {
-		Scripts struct {
-			PreBuild    string `json:"heroku-prebuild"`
-			PostBuild   string `json:"heroku-postbuild"`
-			StartScript string `json:"start"`
-		} `json:"scripts"`
-		DevDependencies map[string]string `json:"devDependencies"`
-		Workspaces      YarnWorkspace     `json:"workspaces"`
+	if s.UseYarn, err = libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "yarn.lock")); err != nil {
+		return err
 	}
 
-	type normalStruct struct {
-		Scripts struct {
-			PreBuild    string `json:"heroku-prebuild"`
-			PostBuild   string `json:"heroku-postbuild"`
-			StartScript string `json:"start"`
-		} `json:"scripts"`
-		DevDependencies map[string]string `json:"devDependencies"`
-		Workspaces      []string          `json:"workspaces"`
+	if s.UseBun && s.UseYarn {
+		s.Log.Warning("Found both yarn.lock and a Bun project, installing dependencies with bun")
+		s.UseYarn = false
 	}
 
-	if s.UseYarn, err = libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "yarn.lock")); err != nil {
-		return err
+	if s.UseDeno && s.UseYarn {
+		s.Log.Warning("Found both yarn.lock and a Deno project, installing dependencies with deno")
+		s.UseYarn = false
 	}
 
 	if s.IsVendored, err = libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "node_modules")); err != nil {
 		return err
 	}
 
-	var p normalStruct
-
-	err = libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), "package.json"), &p)
+	p, err := package_json.Load(filepath.Join(s.Stager.BuildDir(), package_json.File))
 	if os.IsNotExist(err) {
-		s.Log.Warning("No package.json found")
+		if !s.UseDeno {
+			s.Log.Warning("No package.json found")
+		}
 		return nil
+	} else if err != nil {
+		return err
 	}
 
-	if err != nil {
-		if s.UseYarn && strings.Contains(err.Error(), "cannot unmarshal object into Go struct field normalStruct.workspaces of type []string") {
-			var p yarnStructObject
-			err = libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), "package.json"), &p)
-			if err != nil {
-				return err
-			}
-			s.UsesYarnWorkspaces = len(p.Workspaces.Packages) > 0 || len(p.Workspaces.Nohoist) > 0
-			s.HasDevDependencies = len(p.DevDependencies) > 0
-			s.PreBuild = p.Scripts.PreBuild
-			s.PostBuild = p.Scripts.PostBuild
-			s.StartScript = p.Scripts.StartScript
-			return nil
-		}
+	s.UsesYarnWorkspaces = p.Workspaces.Defined()
+	s.HasDevDependencies = len(p.DevDependencies) > 0
+	s.PreBuild = p.Scripts["heroku-prebuild"]
+	s.PostBuild = p.Scripts["heroku-postbuild"]
+	s.StartScript = p.Scripts["start"]
+	s.BuildScript = p.Scripts["build"]
+	s.Framework = framework.Detect(p.Dependencies, p.DevDependencies)
+	if s.IsTypeScript, err = typescript.IsTypeScriptApp(s.Stager.BuildDir(), p.DevDependencies); err != nil {
 		return err
-	} else {
-		s.UsesYarnWorkspaces = len(p.Workspaces) > 0
-		s.HasDevDependencies = len(p.DevDependencies) > 0
-		s.PreBuild = p.Scripts.PreBuild
-		s.PostBuild = p.Scripts.PostBuild
-		s.StartScript = p.Scripts.StartScript
 	}
 
 	return nil
@@ -547,6 +919,25 @@ func (s *Supplier) WarnMissingDevDeps() error {
 	return nil
 }
 
+// ExplainBuildFailure prints an explanation and fix for each known failure
+// signature found in the staging log.
+func (s *Supplier) ExplainBuildFailure() error {
+	if err := s.Logfile.Sync(); err != nil {
+		return err
+	}
+
+	findings, err := diagnose.ScanFile(s.Logfile.Name(), diagnose.Rules)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		s.Log.Warning("%s\nDetected: %s\n%s\nTo fix: %s", finding.Rule.Name, finding.Line, finding.Rule.Explanation, finding.Rule.Fix)
+	}
+
+	return nil
+}
+
 func fileHasString(file string, patterns ...string) (bool, error) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -580,6 +971,18 @@ func (s *Supplier) LoadPackageJSON() error {
 	s.PackageJSONNodeVersion = p.Engines.Node
 	s.NPMVersion = p.Engines.NPM
 	s.YarnVersion = p.Engines.Yarn
+	s.PackageManager = p.PackageManager
+	s.BunVersion = p.Engines.Bun
+
+	if s.UseBun, err = bun.IsBunApp(s.Stager.BuildDir(), s.BunVersion, s.PackageManager); err != nil {
+		return err
+	}
+
+	if !s.UseBun {
+		if s.UseDeno, err = deno.IsDenoApp(s.Stager.BuildDir()); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -646,14 +1049,17 @@ func (s *Supplier) ChooseNodeVersion() error {
 
 	versions := s.Manifest.AllDependencyVersions("node")
 
+	source := "default"
 	if s.PackageJSONNodeVersion != "" {
 		if selectedVersion, err = libbuildpack.FindMatchingVersion(s.PackageJSONNodeVersion, versions); err != nil {
 			return err
 		}
+		source = "package.json"
 	} else if s.NvmrcNodeVersion != "" {
 		if selectedVersion, err = libbuildpack.FindMatchingVersion(s.NvmrcNodeVersion, versions); err != nil {
 			return err
 		}
+		source = ".nvmrc"
 	} else {
 		if dep, err := s.Manifest.DefaultVersion("node"); err != nil {
 			return err
@@ -663,6 +1069,7 @@ func (s *Supplier) ChooseNodeVersion() error {
 	}
 
 	s.NodeVersion = selectedVersion
+	s.Report.Node = report.Tool{Version: selectedVersion, Source: source}
 
 	return nil
 }
@@ -750,37 +1157,179 @@ func (s *Supplier) InstallNPM() error {
 
 	if s.NPMVersion == "" {
 		s.Log.Info("Using default npm version: %s", npmVersion)
+		s.Report.NPM = report.Tool{Version: npmVersion, Source: "node"}
 		return nil
 	}
 
 	_, err := libbuildpack.FindMatchingVersion(s.NPMVersion, []string{npmVersion})
 	if err == nil {
 		s.Log.Info("npm %s already installed with node", npmVersion)
+		s.Report.NPM = report.Tool{Version: npmVersion, Source: "node"}
 		return nil
 	}
 
+	if version, err := libbuildpack.FindMatchingVersion(s.NPMVersion, s.Manifest.AllDependencyVersions("npm")); err == nil {
+		return s.installNPMFromManifest(version, npmVersion)
+	}
+
+	if !s.npmRegistryFallbackAllowed() {
+		return staging.WrapWithHint(staging.VersionResolution,
+			fmt.Errorf("package.json requested npm %s, which is not bundled with node (npm %s) or this buildpack, and installing npm from the registry is disabled by %s=false", s.NPMVersion, npmVersion, NPMRegistryFallbackEnv),
+			fmt.Sprintf("Request an npm version bundled with node or the buildpack, or unset %s to install npm from the registry", NPMRegistryFallbackEnv))
+	}
+
 	s.Log.Info("Downloading and installing npm %s (replacing version %s)...", s.NPMVersion, npmVersion)
 
 	npmArgs := []string{"install", "--unsafe-perm", "--quiet", "-g", "npm@" + s.NPMVersion, "--userconfig", filepath.Join(s.Stager.BuildDir(), ".npmrc")}
-	if err := s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), "npm", npmArgs...); err != nil {
+	err = s.Retry.Do(s.Log, "npm install -g npm@"+s.NPMVersion, func(out io.Writer) error {
+		return s.Command.Execute(s.Stager.BuildDir(), out, out, "npm", npmArgs...)
+	})
+	if err != nil {
 		s.Log.Error("We're unable to download the version of npm you've provided (%s).\nPlease remove the npm version specification in package.json", s.NPMVersion)
 		return err
 	}
+
+	buffer.Reset()
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "npm", "--version", "--loglevel", "notice"); err != nil {
+		return err
+	}
+
+	s.Report.NPM = report.Tool{Version: strings.TrimSpace(buffer.String()), Source: "registry"}
+	s.Log.Info("Using npm %s from the npm registry", s.Report.NPM.Version)
+
 	return nil
 }
 
-func (s *Supplier) InstallYarn() error {
-	if s.YarnVersion != "" {
-		versions := s.Manifest.AllDependencyVersions("yarn")
-		_, err := libbuildpack.FindMatchingVersion(s.YarnVersion, versions)
+// installNPMFromManifest replaces the npm bundled with node by the one in the
+// buildpack manifest. The dependency is the npm registry tarball, whose files
+// are under package/, so node's bin/npm link keeps working.
+func (s *Supplier) installNPMFromManifest(version, bundledVersion string) error {
+	s.Log.Info("Installing npm %s from the buildpack (replacing version %s)", version, bundledVersion)
+
+	npmDir := filepath.Join(s.Stager.DepDir(), "node", "lib", "node_modules", "npm")
+	if err := os.RemoveAll(npmDir); err != nil {
+		return err
+	}
+
+	if err := s.Installer.InstallDependencyWithStrip(libbuildpack.Dependency{Name: "npm", Version: version}, npmDir, 1); err != nil {
+		return err
+	}
+
+	s.Report.NPM = report.Tool{Version: version, Source: "manifest"}
+	s.Log.Info("Using npm %s from the buildpack", version)
+
+	return nil
+}
+
+// npmRegistryFallbackAllowed reports whether an npm version that is not
+// bundled with node or the buildpack may be installed from the registry,
+// which it may unless NODE_NPM_REGISTRY_FALLBACK=false. Cached buildpacks,
+// which are meant for offline use, warn that they are going online.
+func (s *Supplier) npmRegistryFallbackAllowed() bool {
+	if os.Getenv(NPMRegistryFallbackEnv) == "false" {
+		return false
+	}
+
+	if os.Getenv(NPMRegistryFallbackEnv) != "true" && s.Manifest.IsCached() {
+		s.Log.Warning("npm %s is not bundled with node or this cached buildpack, so it is installed from the npm registry. Set %s=false to fail instead", s.NPMVersion, NPMRegistryFallbackEnv)
+	}
+	return true
+}
+
+func (s *Supplier) ChooseYarnVersion() (string, error) {
+	if s.YarnVersion == "" {
+		dep, err := s.Manifest.DefaultVersion("yarn")
+		if err != nil {
+			return "", err
+		}
+		return dep.Version, nil
+	}
+
+	versions := s.Manifest.AllDependencyVersions("yarn")
+	version, err := libbuildpack.FindMatchingVersion(s.YarnVersion, versions)
+	if err != nil {
+		return "", staging.Wrap(staging.VersionResolution, fmt.Errorf("package.json requested %s, buildpack only includes yarn version %s", s.YarnVersion, strings.Join(versions, ", ")))
+	}
+
+	return version, nil
+}
+
+// WarnYarnVersion warns when engines.yarn does not match the yarn version
+// pinned by the packageManager field or by a yarnPath in .yarnrc or
+// .yarnrc.yml, since those take over from the yarn that was installed.
+func (s *Supplier) WarnYarnVersion() {
+	if s.YarnVersion == "" {
+		return
+	}
+
+	if version := packageManagerVersion(s.PackageManager, "yarn"); version != "" && !versionSatisfies(s.YarnVersion, version) {
+		s.Log.Warning("engines.yarn (%s) does not match the yarn version in the packageManager field of package.json (%s)", s.YarnVersion, version)
+	}
+
+	if file, version := s.yarnPathVersion(); version != "" && !versionSatisfies(s.YarnVersion, version) {
+		s.Log.Warning("engines.yarn (%s) does not match the yarn version in the yarnPath of %s (%s)", s.YarnVersion, file, version)
+	}
+}
+
+var (
+	yarnrcYarnPath     = regexp.MustCompile(`(?m)^\s*yarn-path\s+"?([^"\s]+)"?`)
+	yarnrcYmlYarnPath  = regexp.MustCompile(`(?m)^yarnPath:\s*["']?([^"'\s]+)["']?`)
+	yarnReleaseVersion = regexp.MustCompile(`yarn-(\d+\.\d+\.\d+[^/]*?)\.c?js$`)
+)
+
+// yarnPathVersion returns the yarn release that .yarnrc.yml or .yarnrc
+// points at, when its version can be read from the file name.
+func (s *Supplier) yarnPathVersion() (string, string) {
+	for _, rc := range []struct {
+		file    string
+		pattern *regexp.Regexp
+	}{
+		{".yarnrc.yml", yarnrcYmlYarnPath},
+		{".yarnrc", yarnrcYarnPath},
+	} {
+		contents, err := os.ReadFile(filepath.Join(s.Stager.BuildDir(), rc.file))
 		if err != nil {
-			return fmt.Errorf("package.json requested %s, buildpack only includes yarn version %s", s.YarnVersion, strings.Join(versions, ", "))
+			continue
 		}
+
+		if match := rc.pattern.FindSubmatch(contents); match != nil {
+			if version := yarnReleaseVersion.FindStringSubmatch(string(match[1])); version != nil {
+				return rc.file, version[1]
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// packageManagerVersion returns the version from a packageManager field such
+// as "yarn@1.22.22+sha512.abc" when it names tool.
+func packageManagerVersion(packageManager, tool string) string {
+	name, version, found := strings.Cut(packageManager, "@")
+	if !found || name != tool {
+		return ""
 	}
 
+	version, _, _ = strings.Cut(version, "+")
+	return version
+}
+
+func versionSatisfies(constraint, version string) bool {
+	_, err := libbuildpack.FindMatchingVersion(constraint, []string{version})
+	return err == nil
+}
+
+func (s *Supplier) InstallYarn() error {
+	version, err := s.ChooseYarnVersion()
+	if err != nil {
+		return err
+	}
+
+	s.WarnYarnVersion()
+
 	yarnInstallDir := filepath.Join(s.Stager.DepDir(), "yarn")
 
-	if err := s.Installer.InstallOnlyVersion("yarn", yarnInstallDir); err != nil {
+	if err := s.Installer.InstallDependency(libbuildpack.Dependency{Name: "yarn", Version: version}, yarnInstallDir); err != nil {
 		return err
 	}
 
@@ -796,9 +1345,150 @@ func (s *Supplier) InstallYarn() error {
 	yarnVersion := strings.TrimSpace(buffer.String())
 	s.Log.Info("Installed yarn %s", yarnVersion)
 
+	s.Report.Yarn = report.Tool{Version: yarnVersion, Source: "default"}
+	if s.YarnVersion != "" {
+		s.Report.Yarn.Source = "package.json"
+	}
+
 	return nil
 }
 
+func (s *Supplier) ChooseBunVersion() (string, error) {
+	versions := s.Manifest.AllDependencyVersions("bun")
+	if len(versions) == 0 {
+		return "", staging.WrapWithHint(staging.VersionResolution, fmt.Errorf("this buildpack does not include bun"), "Add a bun dependency and default version to the buildpack's manifest.yml or with an override.yml, as described in the buildpack's README, or remove the Bun lockfile, engines.bun and packageManager pin to install with npm")
+	}
+
+	requested := s.requestedBunVersion()
+	if requested == "" {
+		dep, err := s.Manifest.DefaultVersion("bun")
+		if err != nil {
+			return "", err
+		}
+		return dep.Version, nil
+	}
+
+	version, err := libbuildpack.FindMatchingVersion(requested, versions)
+	if err != nil {
+		return "", staging.Wrap(staging.VersionResolution, fmt.Errorf("package.json requested %s, buildpack only includes bun version %s", requested, strings.Join(versions, ", ")))
+	}
+
+	return version, nil
+}
+
+// requestedBunVersion is engines.bun, or the version pinned by the
+// packageManager field.
+func (s *Supplier) requestedBunVersion() string {
+	if s.BunVersion != "" {
+		return s.BunVersion
+	}
+	return packageManagerVersion(s.PackageManager, "bun")
+}
+
+// InstallBun installs bun next to node, which stays installed for hooks and
+// native addons that need it.
+func (s *Supplier) InstallBun() error {
+	version, err := s.ChooseBunVersion()
+	if err != nil {
+		return err
+	}
+
+	bunInstallDir := filepath.Join(s.Stager.DepDir(), "bun")
+
+	if err := s.Installer.InstallDependencyWithStrip(libbuildpack.Dependency{Name: "bun", Version: version}, filepath.Join(bunInstallDir, "bin"), 1); err != nil {
+		return err
+	}
+
+	if err := s.Stager.LinkDirectoryInDepDir(filepath.Join(bunInstallDir, "bin"), "bin"); err != nil {
+		return err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "bun", "--version"); err != nil {
+		return err
+	}
+
+	bunVersion := strings.TrimSpace(buffer.String())
+	s.Log.Info("Installed bun %s", bunVersion)
+
+	s.Report.Bun = report.Tool{Version: bunVersion, Source: "default"}
+	if s.requestedBunVersion() != "" {
+		s.Report.Bun.Source = "package.json"
+	}
+
+	return nil
+}
+
+func (s *Supplier) ChooseDenoVersion() (string, error) {
+	if len(s.Manifest.AllDependencyVersions("deno")) == 0 {
+		return "", staging.WrapWithHint(staging.VersionResolution, fmt.Errorf("this buildpack does not include deno"), "Add a deno dependency and default version to the buildpack's manifest.yml or with an override.yml, as described in the buildpack's README")
+	}
+
+	dep, err := s.Manifest.DefaultVersion("deno")
+	if err != nil {
+		return "", err
+	}
+
+	return dep.Version, nil
+}
+
+// InstallDeno installs deno next to node, which stays installed for hooks
+// that need it.
+func (s *Supplier) InstallDeno() error {
+	version, err := s.ChooseDenoVersion()
+	if err != nil {
+		return err
+	}
+
+	denoBinDir := filepath.Join(s.Stager.DepDir(), "deno", "bin")
+
+	if err := s.Installer.InstallDependency(libbuildpack.Dependency{Name: "deno", Version: version}, denoBinDir); err != nil {
+		return err
+	}
+
+	if err := s.Stager.LinkDirectoryInDepDir(denoBinDir, "bin"); err != nil {
+		return err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "deno", "--version"); err != nil {
+		return err
+	}
+
+	// the first line is "deno <version> (<channel>, <target>)"
+	denoVersion := strings.TrimSpace(buffer.String())
+	if fields := strings.Fields(denoVersion); len(fields) > 1 {
+		denoVersion = fields[1]
+	}
+	s.Log.Info("Installed deno %s", denoVersion)
+
+	s.Report.Deno = report.Tool{Version: denoVersion, Source: "default"}
+
+	return nil
+}
+
+// installDenoDir copies the DENO_DIR filled during the build from the cache
+// dir into the droplet, so that remote modules are not downloaded again when
+// the app starts.
+func (s *Supplier) installDenoDir() error {
+	denoDir := filepath.Join(s.Stager.DepDir(), "deno", "cache")
+	if err := os.MkdirAll(denoDir, 0755); err != nil {
+		return err
+	}
+
+	if err := libbuildpack.CopyDirectory(deno.CacheDir(s.Stager.CacheDir()), denoDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := s.Stager.WriteEnvFile("DENO_DIR", denoDir); err != nil {
+		return err
+	}
+
+	script := &profiled.Script{}
+	script.Export("DENO_DIR", profiled.EnvPath("DEPS_DIR", s.Stager.DepsIdx(), "deno", "cache"))
+	return profiled.Write(s.Stager.DepDir(), "deno.sh", script)
+}
+
 func (s *Supplier) CreateDefaultEnv() error {
 	var environmentDefaults = map[string]string{
 		"NODE_ENV":              "production",
@@ -824,19 +1514,23 @@ func (s *Supplier) CreateDefaultEnv() error {
 		return err
 	}
 
-	scriptContents := `export NODE_HOME=%[1]s
-export NODE_ENV=${NODE_ENV:-production}
-export MEMORY_AVAILABLE=$(echo $VCAP_APPLICATION | jq '.limits.mem')
-export WEB_MEMORY=${WEB_MEMORY:-512}
-export WEB_CONCURRENCY=${WEB_CONCURRENCY:-1}
-if [ ! -d "$HOME/node_modules" ]; then
-	export NODE_PATH=${NODE_PATH:-"%[2]s"}
-	ln -s "%[2]s" "$HOME/node_modules"
-else
-	export NODE_PATH=${NODE_PATH:-"$HOME/node_modules"}
-fi
-export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
-`
+	nodeModules := profiled.EnvPath("DEPS_DIR", s.Stager.DepsIdx(), "node_modules")
+
+	script := &profiled.Script{}
+	script.Export("NODE_HOME", profiled.EnvPath("DEPS_DIR", s.Stager.DepsIdx(), "node"))
+	script.Default("NODE_ENV", profiled.Literal("production"))
+	script.Line(`export MEMORY_AVAILABLE=$(echo $VCAP_APPLICATION | jq '.limits.mem')`)
+	script.Default("WEB_MEMORY", profiled.Literal("512"))
+	script.Default("WEB_CONCURRENCY", profiled.Literal("1"))
+
+	link := &profiled.Script{}
+	link.Default("NODE_PATH", nodeModules)
+	link.Line(fmt.Sprintf(`ln -s %s "$HOME/node_modules"`, nodeModules))
+	existing := &profiled.Script{}
+	existing.Default("NODE_PATH", profiled.EnvPath("HOME", "node_modules"))
+	script.If(`[ ! -d "$HOME/node_modules" ]`, link, existing)
+
+	script.Line(`export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin`)
 
 	requiresSSLEnvVars, err := nodeVersionRequiresSSLEnvVars(s.NodeVersion)
 	if err != nil {
@@ -844,13 +1538,9 @@ export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
 	}
 
 	if requiresSSLEnvVars {
-		scriptContents += `export SSL_CERT_DIR=${SSL_CERT_DIR:-/etc/ssl/certs}
-`
+		script.Default("SSL_CERT_DIR", profiled.Literal("/etc/ssl/certs"))
 	}
-	return s.Stager.WriteProfileD("node.sh",
-		fmt.Sprintf(scriptContents,
-			filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node"),
-			filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node_modules")))
+	return profiled.Write(s.Stager.DepDir(), "node.sh", script)
 }
 
 func copyAll(srcDir, destDir string, files []string) error {
@@ -887,7 +1577,7 @@ func (s *Supplier) OverrideCacheFromApp() error {
 		os.RemoveAll(filepath.Join(s.Stager.CacheDir(), name))
 	}
 
-	pkgMgrCacheDirs := []string{".cache/yarn", ".npm"}
+	pkgMgrCacheDirs := []string{".cache/yarn", ".npm", ".bun/install/cache"}
 	if err := copyAll(s.Stager.BuildDir(), s.Stager.CacheDir(), pkgMgrCacheDirs); err != nil {
 		return err
 	}
@@ -2,14 +2,21 @@ package supply_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/framework"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/staging"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/supply"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/timing"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -19,23 +26,25 @@ import (
 
 var _ = Describe("Supply", func() {
 	var (
-		err             error
-		buildDir        string
-		cacheDir        string
-		depsDir         string
-		depsIdx         string
-		depDir          string
-		supplier        *supply.Supplier
-		logger          *libbuildpack.Logger
-		buffer          *bytes.Buffer
-		mockCtrl        *gomock.Controller
-		mockYarn        *MockYarn
-		mockNPM         *MockNPM
-		mockManifest    *MockManifest
-		mockInstaller   *MockInstaller
-		mockCommand     *MockCommand
-		installNode     func(libbuildpack.Dependency, string)
-		installOnlyYarn func(string, string)
+		err           error
+		buildDir      string
+		cacheDir      string
+		depsDir       string
+		depsIdx       string
+		depDir        string
+		supplier      *supply.Supplier
+		logger        *libbuildpack.Logger
+		buffer        *bytes.Buffer
+		mockCtrl      *gomock.Controller
+		mockYarn      *MockYarn
+		mockBun       *MockBun
+		mockDeno      *MockDeno
+		mockNPM       *MockNPM
+		mockManifest  *MockManifest
+		mockInstaller *MockInstaller
+		mockCommand   *MockCommand
+		installNode   func(libbuildpack.Dependency, string)
+		installYarn   func(libbuildpack.Dependency, string)
 	)
 
 	BeforeEach(func() {
@@ -62,6 +71,8 @@ var _ = Describe("Supply", func() {
 		mockInstaller = NewMockInstaller(mockCtrl)
 		mockCommand = NewMockCommand(mockCtrl)
 		mockYarn = NewMockYarn(mockCtrl)
+		mockBun = NewMockBun(mockCtrl)
+		mockDeno = NewMockDeno(mockCtrl)
 		mockNPM = NewMockNPM(mockCtrl)
 
 		installNode = func(dep libbuildpack.Dependency, nodeDir string) {
@@ -75,7 +86,7 @@ var _ = Describe("Supply", func() {
 			Expect(err).To(BeNil())
 		}
 
-		installOnlyYarn = func(_ string, yarnDir string) {
+		installYarn = func(_ libbuildpack.Dependency, yarnDir string) {
 			err := os.MkdirAll(filepath.Join(yarnDir, "bin"), 0755)
 			Expect(err).To(BeNil())
 
@@ -92,6 +103,8 @@ var _ = Describe("Supply", func() {
 		supplier = &supply.Supplier{
 			Stager:    stager,
 			Yarn:      mockYarn,
+			Bun:       mockBun,
+			Deno:      mockDeno,
 			NPM:       mockNPM,
 			Log:       logger,
 			Manifest:  mockManifest,
@@ -148,7 +161,8 @@ var _ = Describe("Supply", func() {
 		"npm"  : "npm-x",
 		"node" : "node-y",
 		"something" : "3.2.1"
-	}
+	},
+  "packageManager": "yarn@1.22.22+sha512.abc123"
 }
 `
 				})
@@ -170,6 +184,33 @@ var _ = Describe("Supply", func() {
 					Expect(buffer.String()).To(ContainSubstring("engines.npm (package.json): npm-x"))
 				})
 
+				It("loads the packageManager field into the supplier", func() {
+					err = supplier.LoadPackageJSON()
+					Expect(err).To(BeNil())
+
+					Expect(supplier.PackageManager).To(Equal("yarn@1.22.22+sha512.abc123"))
+					Expect(supplier.UseBun).To(BeFalse())
+				})
+
+				It("detects a Bun project from its lockfile", func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "bun.lockb"), []byte{}, 0644)).To(Succeed())
+
+					err = supplier.LoadPackageJSON()
+					Expect(err).To(BeNil())
+
+					Expect(supplier.UseBun).To(BeTrue())
+					Expect(supplier.UseDeno).To(BeFalse())
+				})
+
+				It("detects a Deno project from deno.json", func() {
+					Expect(os.WriteFile(filepath.Join(buildDir, "deno.json"), []byte("{}"), 0644)).To(Succeed())
+
+					err = supplier.LoadPackageJSON()
+					Expect(err).To(BeNil())
+
+					Expect(supplier.UseDeno).To(BeTrue())
+				})
+
 				Context("the engines section contains iojs", func() {
 					BeforeEach(func() {
 						packageJSON = `
@@ -593,19 +634,21 @@ var _ = Describe("Supply", func() {
 
 		Context("yarn version is unset", func() {
 			BeforeEach(func() {
-				mockInstaller.EXPECT().InstallOnlyVersion("yarn", yarnInstallDir).Do(installOnlyYarn).Return(nil)
+				mockManifest.EXPECT().DefaultVersion("yarn").Return(libbuildpack.Dependency{Name: "yarn", Version: "1.22.22"}, nil)
+				mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "yarn", Version: "1.22.22"}, yarnInstallDir).Do(installYarn).Return(nil)
 
 				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "yarn", "--version", "--loglevel", "notice").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
-					buffer.Write([]byte("0.32.5\n"))
+					buffer.Write([]byte("1.22.22\n"))
 				}).Return(nil)
 			})
 
-			It("installs the only version in the manifest", func() {
+			It("installs the default version from the manifest", func() {
 				supplier.YarnVersion = ""
 
 				err = supplier.InstallYarn()
 				Expect(err).To(BeNil())
-				Expect(buffer.String()).To(ContainSubstring("Installed yarn 0.32.5"))
+				Expect(buffer.String()).To(ContainSubstring("Installed yarn 1.22.22"))
+				Expect(supplier.Report.Yarn).To(Equal(report.Tool{Version: "1.22.22", Source: "default"}))
 			})
 
 			It("creates a symlink in <depDir>/bin", func() {
@@ -625,27 +668,75 @@ var _ = Describe("Supply", func() {
 
 		Context("requested yarn version is in manifest", func() {
 			BeforeEach(func() {
-				versions := []string{"0.32.5"}
+				versions := []string{"1.22.19", "1.22.22", "4.5.1"}
 				mockManifest.EXPECT().AllDependencyVersions("yarn").Return(versions)
-				mockInstaller.EXPECT().InstallOnlyVersion("yarn", yarnInstallDir).Do(installOnlyYarn).Return(nil)
+				mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "yarn", Version: "1.22.22"}, yarnInstallDir).Do(installYarn).Return(nil)
 
 				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "yarn", "--version", "--loglevel", "notice").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
-					buffer.Write([]byte("0.32.5\n"))
+					buffer.Write([]byte("1.22.22\n"))
 				}).Return(nil)
 			})
 
-			It("installs the correct version from the manifest", func() {
-				supplier.YarnVersion = "0.32.x"
+			It("installs the best matching version from the manifest", func() {
+				supplier.YarnVersion = "1.22.x"
+				err = supplier.InstallYarn()
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).To(ContainSubstring("Installed yarn 1.22.22"))
+				Expect(supplier.Report.Yarn).To(Equal(report.Tool{Version: "1.22.22", Source: "package.json"}))
+			})
+
+			It("does not warn when the packageManager field agrees", func() {
+				supplier.YarnVersion = "1.22.x"
+				supplier.PackageManager = "yarn@1.22.19+sha512.abc123"
+				err = supplier.InstallYarn()
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).NotTo(ContainSubstring("**WARNING**"))
+			})
+
+			It("warns when the packageManager field disagrees", func() {
+				supplier.YarnVersion = "1.22.x"
+				supplier.PackageManager = "yarn@4.5.1+sha512.abc123"
+				err = supplier.InstallYarn()
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).To(ContainSubstring("engines.yarn (1.22.x) does not match the yarn version in the packageManager field of package.json (4.5.1)"))
+			})
+
+			It("ignores a packageManager field for another tool", func() {
+				supplier.YarnVersion = "1.22.x"
+				supplier.PackageManager = "pnpm@9.0.0"
+				err = supplier.InstallYarn()
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).NotTo(ContainSubstring("**WARNING**"))
+			})
+
+			It("warns when the yarnPath in .yarnrc.yml disagrees", func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, ".yarnrc.yml"), []byte("nodeLinker: node-modules\nyarnPath: .yarn/releases/yarn-4.5.1.cjs\n"), 0644)).To(Succeed())
+
+				supplier.YarnVersion = "1.22.x"
+				err = supplier.InstallYarn()
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).To(ContainSubstring("engines.yarn (1.22.x) does not match the yarn version in the yarnPath of .yarnrc.yml (4.5.1)"))
+			})
+
+			It("warns when the yarn-path in .yarnrc disagrees", func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, ".yarnrc"), []byte("yarn-path \".yarn/releases/yarn-1.21.1.js\"\n"), 0644)).To(Succeed())
+
+				supplier.YarnVersion = "1.22.x"
 				err = supplier.InstallYarn()
 				Expect(err).To(BeNil())
 
-				Expect(buffer.String()).To(ContainSubstring("Installed yarn 0.32.5"))
+				Expect(buffer.String()).To(ContainSubstring("engines.yarn (1.22.x) does not match the yarn version in the yarnPath of .yarnrc (1.21.1)"))
 			})
 		})
 
 		Context("requested yarn version is not in manifest", func() {
 			BeforeEach(func() {
-				versions := []string{"0.32.5"}
+				versions := []string{"1.22.22"}
 				mockManifest.EXPECT().AllDependencyVersions("yarn").Return(versions)
 			})
 
@@ -653,11 +744,116 @@ var _ = Describe("Supply", func() {
 				supplier.YarnVersion = "1.0.x"
 				err = supplier.InstallYarn()
 				Expect(err).ToNot(BeNil())
-				Expect(err.Error()).To(Equal("package.json requested 1.0.x, buildpack only includes yarn version 0.32.5"))
+				Expect(err.Error()).To(Equal("package.json requested 1.0.x, buildpack only includes yarn version 1.22.22"))
+				Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
 			})
 		})
 	})
 
+	Describe("InstallBun", func() {
+		var bunBinDir string
+
+		installBun := func(_ libbuildpack.Dependency, dir string, _ int) error {
+			Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+			return os.WriteFile(filepath.Join(dir, "bun"), []byte("bun exe"), 0755)
+		}
+
+		BeforeEach(func() {
+			bunBinDir = filepath.Join(depsDir, depsIdx, "bun", "bin")
+		})
+
+		Context("the manifest includes bun", func() {
+			BeforeEach(func() {
+				mockManifest.EXPECT().AllDependencyVersions("bun").Return([]string{"1.1.30", "1.2.4"})
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "bun", "--version").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
+					buffer.Write([]byte("1.1.30\n"))
+				}).Return(nil)
+			})
+
+			It("installs the version requested by engines.bun and links it into <depDir>/bin", func() {
+				mockInstaller.EXPECT().InstallDependencyWithStrip(libbuildpack.Dependency{Name: "bun", Version: "1.1.30"}, bunBinDir, 1).DoAndReturn(installBun)
+
+				supplier.BunVersion = "1.1.x"
+				Expect(supplier.InstallBun()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Installed bun 1.1.30"))
+				Expect(supplier.Report.Bun).To(Equal(report.Tool{Version: "1.1.30", Source: "package.json"}))
+
+				link, err := os.Readlink(filepath.Join(depsDir, depsIdx, "bin", "bun"))
+				Expect(err).To(BeNil())
+				Expect(link).To(Equal("../bun/bin/bun"))
+			})
+
+			It("uses the version pinned by the packageManager field", func() {
+				mockInstaller.EXPECT().InstallDependencyWithStrip(libbuildpack.Dependency{Name: "bun", Version: "1.1.30"}, bunBinDir, 1).DoAndReturn(installBun)
+
+				supplier.PackageManager = "bun@1.1.30"
+				Expect(supplier.InstallBun()).To(Succeed())
+			})
+
+			It("uses the default version otherwise", func() {
+				mockManifest.EXPECT().DefaultVersion("bun").Return(libbuildpack.Dependency{Name: "bun", Version: "1.1.30"}, nil)
+				mockInstaller.EXPECT().InstallDependencyWithStrip(libbuildpack.Dependency{Name: "bun", Version: "1.1.30"}, bunBinDir, 1).DoAndReturn(installBun)
+
+				Expect(supplier.InstallBun()).To(Succeed())
+				Expect(supplier.Report.Bun.Source).To(Equal("default"))
+			})
+		})
+
+		It("fails when the requested version is not in the manifest", func() {
+			mockManifest.EXPECT().AllDependencyVersions("bun").Return([]string{"1.2.4"})
+
+			supplier.BunVersion = "1.1.x"
+			err = supplier.InstallBun()
+			Expect(err).To(MatchError("package.json requested 1.1.x, buildpack only includes bun version 1.2.4"))
+			Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
+		})
+
+		It("fails when the manifest does not include bun", func() {
+			mockManifest.EXPECT().AllDependencyVersions("bun").Return(nil)
+
+			err = supplier.InstallBun()
+			Expect(err).To(MatchError("this buildpack does not include bun"))
+			Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
+
+			staging.LogHint(logger, err)
+			Expect(buffer.String()).To(ContainSubstring("Add a bun dependency and default version to the buildpack's manifest.yml or with an override.yml"))
+		})
+	})
+
+	Describe("InstallDeno", func() {
+		It("installs the default version and links it into <depDir>/bin", func() {
+			denoBinDir := filepath.Join(depsDir, depsIdx, "deno", "bin")
+			mockManifest.EXPECT().AllDependencyVersions("deno").Return([]string{"2.1.4"})
+			mockManifest.EXPECT().DefaultVersion("deno").Return(libbuildpack.Dependency{Name: "deno", Version: "2.1.4"}, nil)
+			mockInstaller.EXPECT().InstallDependency(libbuildpack.Dependency{Name: "deno", Version: "2.1.4"}, denoBinDir).DoAndReturn(func(_ libbuildpack.Dependency, dir string) error {
+				Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+				return os.WriteFile(filepath.Join(dir, "deno"), []byte("deno exe"), 0755)
+			})
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "deno", "--version").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
+				buffer.Write([]byte("deno 2.1.4 (stable, release, x86_64-unknown-linux-gnu)\nv8 13.0.245.12-rusty\ntypescript 5.6.2\n"))
+			}).Return(nil)
+
+			Expect(supplier.InstallDeno()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Installed deno 2.1.4"))
+			Expect(supplier.Report.Deno).To(Equal(report.Tool{Version: "2.1.4", Source: "default"}))
+
+			link, err := os.Readlink(filepath.Join(depsDir, depsIdx, "bin", "deno"))
+			Expect(err).To(BeNil())
+			Expect(link).To(Equal("../deno/bin/deno"))
+		})
+
+		It("fails when the manifest does not include deno", func() {
+			mockManifest.EXPECT().AllDependencyVersions("deno").Return(nil)
+
+			err = supplier.InstallDeno()
+			Expect(err).To(MatchError("this buildpack does not include deno"))
+			Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
+
+			staging.LogHint(logger, err)
+			Expect(buffer.String()).To(ContainSubstring("Add a deno dependency and default version to the buildpack's manifest.yml or with an override.yml"))
+		})
+	})
+
 	Describe("InstallNPM", func() {
 		BeforeEach(func() {
 			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "--version", "--loglevel", "notice").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
@@ -696,16 +892,107 @@ var _ = Describe("Supply", func() {
 				})
 			})
 
-			It("installs the requested npm version using packaged npm", func() {
-				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(),
-					"npm", "install", "--unsafe-perm", "--quiet", "-g", "npm@4.5.6",
-					"--userconfig", filepath.Join(buildDir, ".npmrc")).Return(nil)
+			Context("requested version is in the buildpack manifest", func() {
+				BeforeEach(func() {
+					mockManifest.EXPECT().AllDependencyVersions("npm").Return([]string{"4.5.5", "4.5.6", "5.0.0"})
+				})
 
-				supplier.NPMVersion = "4.5.6"
-				err = supplier.InstallNPM()
-				Expect(err).To(BeNil())
+				It("installs npm from the buildpack in place of the bundled npm", func() {
+					npmDir := filepath.Join(depDir, "node", "lib", "node_modules", "npm")
+					Expect(os.MkdirAll(npmDir, 0755)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(npmDir, "stale"), []byte{}, 0644)).To(Succeed())
+
+					mockInstaller.EXPECT().InstallDependencyWithStrip(libbuildpack.Dependency{Name: "npm", Version: "4.5.6"}, npmDir, 1).DoAndReturn(func(_ libbuildpack.Dependency, dir string, _ int) error {
+						Expect(filepath.Join(dir, "stale")).NotTo(BeAnExistingFile())
+						return nil
+					})
+
+					supplier.NPMVersion = "4.5.x"
+					Expect(supplier.InstallNPM()).To(Succeed())
+
+					Expect(buffer.String()).To(ContainSubstring("Installing npm 4.5.6 from the buildpack (replacing version 1.2.3)"))
+					Expect(buffer.String()).To(ContainSubstring("Using npm 4.5.6 from the buildpack"))
+					Expect(supplier.Report.NPM).To(Equal(report.Tool{Version: "4.5.6", Source: "manifest"}))
+				})
+			})
+
+			Context("requested version is not available and the registry fallback is disabled", func() {
+				BeforeEach(func() {
+					mockManifest.EXPECT().AllDependencyVersions("npm").Return(nil)
+					Expect(os.Setenv("NODE_NPM_REGISTRY_FALLBACK", "false")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("NODE_NPM_REGISTRY_FALLBACK")).To(Succeed())
+				})
 
-				Expect(buffer.String()).To(ContainSubstring("Downloading and installing npm 4.5.6 (replacing version 1.2.3)..."))
+				It("fails", func() {
+					supplier.NPMVersion = "4.5.6"
+					err = supplier.InstallNPM()
+					Expect(err).To(MatchError(ContainSubstring("package.json requested npm 4.5.6, which is not bundled with node (npm 1.2.3) or this buildpack")))
+					Expect(err).To(MatchError(ContainSubstring("installing npm from the registry is disabled by NODE_NPM_REGISTRY_FALLBACK=false")))
+					Expect(staging.KindOf(err)).To(Equal(staging.VersionResolution))
+				})
+			})
+
+			Context("requested version is not installed", func() {
+				BeforeEach(func() {
+					mockManifest.EXPECT().AllDependencyVersions("npm").Return(nil).AnyTimes()
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "--version", "--loglevel", "notice").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
+						buffer.Write([]byte("4.5.6\n"))
+					}).Return(nil)
+				})
+
+				It("installs the requested npm version using packaged npm", func() {
+					mockManifest.EXPECT().IsCached().Return(false)
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(),
+						"npm", "install", "--unsafe-perm", "--quiet", "-g", "npm@4.5.6",
+						"--userconfig", filepath.Join(buildDir, ".npmrc")).Return(nil)
+
+					supplier.NPMVersion = "4.5.6"
+					err = supplier.InstallNPM()
+					Expect(err).To(BeNil())
+
+					Expect(buffer.String()).To(ContainSubstring("Downloading and installing npm 4.5.6 (replacing version 1.2.3)..."))
+					Expect(buffer.String()).To(ContainSubstring("Using npm 4.5.6 from the npm registry"))
+					Expect(supplier.Report.NPM).To(Equal(report.Tool{Version: "4.5.6", Source: "registry"}))
+				})
+
+				It("warns that a cached buildpack installs npm from the registry", func() {
+					mockManifest.EXPECT().IsCached().Return(true)
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(),
+						"npm", "install", "--unsafe-perm", "--quiet", "-g", "npm@4.5.6",
+						"--userconfig", filepath.Join(buildDir, ".npmrc")).Return(nil)
+
+					supplier.NPMVersion = "4.5.6"
+					Expect(supplier.InstallNPM()).To(Succeed())
+
+					Expect(buffer.String()).To(ContainSubstring("npm 4.5.6 is not bundled with node or this cached buildpack, so it is installed from the npm registry"))
+					Expect(supplier.Report.NPM).To(Equal(report.Tool{Version: "4.5.6", Source: "registry"}))
+				})
+
+				It("retries the npm install after a network error", func() {
+					mockManifest.EXPECT().IsCached().Return(false)
+					sleeps := 0
+					supplier.Retry = retry.Policy{Retries: 1, Delay: time.Second, Sleep: func(time.Duration) { sleeps++ }}
+
+					gomock.InOrder(
+						mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(),
+							"npm", "install", "--unsafe-perm", "--quiet", "-g", "npm@4.5.6",
+							"--userconfig", filepath.Join(buildDir, ".npmrc")).DoAndReturn(func(_ string, stdout, _ io.Writer, _ string, _ ...string) error {
+							fmt.Fprintln(stdout, "npm ERR! code EAI_AGAIN")
+							return errors.New("exit status 1")
+						}),
+						mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(),
+							"npm", "install", "--unsafe-perm", "--quiet", "-g", "npm@4.5.6",
+							"--userconfig", filepath.Join(buildDir, ".npmrc")).Return(nil),
+					)
+
+					supplier.NPMVersion = "4.5.6"
+					Expect(supplier.InstallNPM()).To(Succeed())
+					Expect(sleeps).To(Equal(1))
+					Expect(buffer.String()).To(ContainSubstring("npm install -g npm@4.5.6 failed with a network error, retrying in 1s (attempt 2 of 2)"))
+				})
 			})
 		})
 	})
@@ -836,6 +1123,142 @@ var _ = Describe("Supply", func() {
 				Expect(supplier.HasDevDependencies).To(BeFalse())
 			})
 		})
+
+		Context("package.json has build script", func() {
+			BeforeEach(func() {
+				packageJSON := `
+{
+  "scripts" : {
+		"build": "tsc -p ."
+	}
+}
+`
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(packageJSON), 0644)).To(Succeed())
+			})
+
+			It("sets BuildScript", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.BuildScript).To(Equal("tsc -p ."))
+			})
+		})
+
+		Context("package.json has workspaces as an array", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"workspaces": ["packages/*"]}`), 0644)).To(Succeed())
+			})
+
+			It("sets UsesYarnWorkspaces", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.UsesYarnWorkspaces).To(BeTrue())
+			})
+		})
+
+		Context("package.json has workspaces as an object", func() {
+			BeforeEach(func() {
+				packageJSON := `
+{
+  "workspaces": {
+    "packages": ["packages/*"],
+    "nohoist": ["**/react-native"]
+  },
+  "scripts": {
+    "start": "node index.js"
+  }
+}
+`
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(packageJSON), 0644)).To(Succeed())
+			})
+
+			It("sets UsesYarnWorkspaces and reads the scripts", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.UsesYarnWorkspaces).To(BeTrue())
+				Expect(supplier.StartScript).To(Equal("node index.js"))
+			})
+		})
+
+		Context("package.json has a script that is not a string", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"scripts": {"build": ["tsc"]}}`), 0644)).To(Succeed())
+			})
+
+			It("returns an error naming the script", func() {
+				Expect(supplier.ReadPackageJSON()).To(MatchError(`invalid package.json: "scripts.build" must be a string, not an array`))
+			})
+		})
+
+		Context("a framework is a dependency", func() {
+			BeforeEach(func() {
+				packageJSON := `
+{
+	"dependencies": {
+    "next": "14.2.3",
+    "react": "18.3.1"
+  }
+}
+`
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(packageJSON), 0644)).To(Succeed())
+			})
+
+			It("sets Framework", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.Framework).NotTo(BeNil())
+				Expect(supplier.Framework.Name).To(Equal("Next.js"))
+			})
+		})
+
+		Context("no framework is a dependency", func() {
+			It("leaves Framework unset", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.Framework).To(BeNil())
+			})
+		})
+
+		Context("typescript is a dev dependency", func() {
+			BeforeEach(func() {
+				packageJSON := `
+{
+	"devDependencies": {
+    "typescript": "^5.4.0"
+  }
+}
+`
+				Expect(os.WriteFile(filepath.Join(buildDir, "package.json"), []byte(packageJSON), 0644)).To(Succeed())
+			})
+
+			It("sets IsTypeScript to true when tsconfig.json exists", func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte("{}"), 0644)).To(Succeed())
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.IsTypeScript).To(BeTrue())
+			})
+
+			It("sets IsTypeScript to false when tsconfig.json does not exist", func() {
+				Expect(supplier.ReadPackageJSON()).To(Succeed())
+				Expect(supplier.IsTypeScript).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("LoadStaticMode", func() {
+		var oldStaticMode string
+
+		BeforeEach(func() {
+			oldStaticMode = os.Getenv("NODE_STATIC_MODE")
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", oldStaticMode)).To(Succeed())
+		})
+
+		It("sets StaticMode from NODE_STATIC_MODE", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "staticfile")).To(Succeed())
+			Expect(supplier.LoadStaticMode()).To(Succeed())
+			Expect(supplier.StaticMode).To(Equal("staticfile"))
+		})
+
+		It("returns an error for an unknown mode", func() {
+			Expect(os.Setenv("NODE_STATIC_MODE", "cdn")).To(Succeed())
+			Expect(supplier.LoadStaticMode()).NotTo(Succeed())
+		})
 	})
 
 	Describe("TipVendorDependencies", func() {
@@ -978,6 +1401,97 @@ var _ = Describe("Supply", func() {
 		})
 	})
 
+	Describe("WriteReport", func() {
+		var logfile *os.File
+
+		BeforeEach(func() {
+			logfile, err = os.CreateTemp("", "nodejs-buildpack.log")
+			Expect(err).To(BeNil())
+			supplier.Logfile = logfile
+			supplier.Log = libbuildpack.NewLogger(io.MultiWriter(logfile, ansicleaner.New(buffer)))
+		})
+
+		AfterEach(func() {
+			Expect(logfile.Close()).To(Succeed())
+			Expect(os.Remove(logfile.Name())).To(Succeed())
+		})
+
+		It("writes the report with warnings and the node_modules size to the dep dir", func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "node_modules", "left-pad"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildDir, "node_modules", "left-pad", "index.js"), make([]byte, 100), 0644)).To(Succeed())
+			supplier.Report.Node = report.Tool{Version: "22.1.0", Source: ".nvmrc"}
+			supplier.Log.Warning("Gulp may not be tracked in package.json")
+
+			Expect(supplier.WriteReport()).To(Succeed())
+
+			r, err := report.Load(depDir)
+			Expect(err).To(BeNil())
+			Expect(r.Node).To(Equal(report.Tool{Version: "22.1.0", Source: ".nvmrc"}))
+			Expect(r.Warnings).To(Equal([]string{"Gulp may not be tracked in package.json"}))
+			Expect(r.NodeModulesSize).To(Equal(int64(100)))
+		})
+
+		It("measures node_modules after it is moved to the dep dir", func() {
+			Expect(os.MkdirAll(filepath.Join(buildDir, "node_modules", "left-pad"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(buildDir, "node_modules", "left-pad", "index.js"), make([]byte, 100), 0644)).To(Succeed())
+			defer os.Unsetenv("NODE_PATH")
+
+			Expect(supplier.MoveDependencyArtifacts()).To(Succeed())
+			Expect(filepath.Join(buildDir, "node_modules")).NotTo(BeAnExistingFile())
+			Expect(supplier.WriteReport()).To(Succeed())
+
+			r, err := report.Load(depDir)
+			Expect(err).To(BeNil())
+			Expect(r.NodeModulesSize).To(Equal(int64(100)))
+		})
+
+		It("exports the step timings", func() {
+			supplier.Timer = &timing.Timer{Stage: "supply"}
+			Expect(supplier.Timer.Time("Install node", func() error { return nil })).To(Succeed())
+
+			Expect(supplier.WriteReport()).To(Succeed())
+
+			r, err := report.Load(depDir)
+			Expect(err).To(BeNil())
+			Expect(r.Phases).To(HaveLen(1))
+			Expect(r.Phases[0].Stage).To(Equal("supply"))
+			Expect(r.Phases[0].Name).To(Equal("Install node"))
+		})
+	})
+
+	Describe("ExplainBuildFailure", func() {
+		var logfile *os.File
+
+		BeforeEach(func() {
+			logfile, err = os.CreateTemp("", "nodejs-buildpack.log")
+			Expect(err).To(BeNil())
+			supplier.Logfile = logfile
+		})
+
+		AfterEach(func() {
+			Expect(logfile.Close()).To(Succeed())
+			Expect(os.Remove(logfile.Name())).To(Succeed())
+		})
+
+		It("explains known failures found in the log", func() {
+			_, err = logfile.WriteString("npm ERR! code ETARGET\nnpm ERR! notarget No matching version found for express@99.0.0.\n")
+			Expect(err).To(BeNil())
+
+			Expect(supplier.ExplainBuildFailure()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("**WARNING** No matching version (ETARGET)"))
+			Expect(buffer.String()).To(ContainSubstring("Detected: npm ERR! code ETARGET"))
+			Expect(buffer.String()).To(ContainSubstring("To fix: Relax the version range in package.json"))
+		})
+
+		It("prints nothing when no failure is recognised", func() {
+			_, err = logfile.WriteString("npm ERR! something unusual\n")
+			Expect(err).To(BeNil())
+
+			Expect(supplier.ExplainBuildFailure()).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+
 	Describe("WarnMissingDevDeps", func() {
 		var (
 			logfile  *os.File
@@ -1085,6 +1599,68 @@ var _ = Describe("Supply", func() {
 	})
 
 	Describe("BuildDependencies", func() {
+		Context("using bun", func() {
+			BeforeEach(func() {
+				supplier.UseBun = true
+				mockBun.EXPECT().Build(buildDir, cacheDir).Return(nil)
+			})
+
+			It("installs dependencies with bun and records it in the report", func() {
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(supplier.Report.PackageManager).To(Equal("bun"))
+				Expect(supplier.Report.Cache.PackageManager).To(Equal(report.CacheMiss))
+			})
+
+			It("runs the postbuild script with bun", func() {
+				supplier.PostBuild = "descriptive"
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "bun", "run", "heroku-postbuild")
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Running heroku-postbuild (bun)"))
+			})
+
+			It("prunes devDependencies with bun after a build", func() {
+				supplier.IsTypeScript = true
+				supplier.BuildScript = "tsc"
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "bun", "run", "build")
+				mockBun.EXPECT().Prune(buildDir, cacheDir).Return(nil)
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
+		})
+
+		Context("using deno", func() {
+			BeforeEach(func() {
+				supplier.UseDeno = true
+				mockDeno.EXPECT().Build(buildDir, cacheDir).DoAndReturn(func(string, string) error {
+					return os.WriteFile(filepath.Join(cacheDir, ".deno", "dep_analysis_cache_v2"), []byte("cache"), 0644)
+				})
+				Expect(os.MkdirAll(filepath.Join(cacheDir, ".deno"), 0755)).To(Succeed())
+			})
+
+			It("ships DENO_DIR in the droplet", func() {
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(supplier.Report.PackageManager).To(Equal("deno"))
+				Expect(supplier.Report.Cache.PackageManager).To(Equal(report.CacheMiss))
+
+				Expect(filepath.Join(depDir, "deno", "cache", "dep_analysis_cache_v2")).To(BeAnExistingFile())
+
+				contents, err := os.ReadFile(filepath.Join(depDir, "env", "DENO_DIR"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(Equal(filepath.Join(depDir, "deno", "cache")))
+
+				contents, err = os.ReadFile(filepath.Join(depDir, "profile.d", "deno.sh"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(Equal("export DENO_DIR=\"$DEPS_DIR/14/deno/cache\"\n"))
+			})
+
+			It("runs package.json scripts with deno task and does not prune", func() {
+				supplier.IsTypeScript = true
+				supplier.BuildScript = "deno check main.ts"
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "deno", "task", "build")
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Running build (deno)"))
+			})
+		})
+
 		Context("using yarn", func() {
 			BeforeEach(func() {
 				supplier.UseYarn = true
@@ -1133,6 +1709,22 @@ var _ = Describe("Supply", func() {
 				Expect(supplier.BuildDependencies()).To(Succeed())
 			})
 
+			It("records the install and the scripts run in the staging report", func() {
+				Expect(os.MkdirAll(filepath.Join(cacheDir, ".npm", "_cacache"), 0755)).To(Succeed())
+				supplier.PostBuild = "descriptive"
+				mockNPM.EXPECT().Build(buildDir, cacheDir).Return(nil)
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "heroku-postbuild", "--if-present")
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(supplier.Report.PackageManager).To(Equal("npm"))
+				Expect(supplier.Report.InstallMode).To(Equal("install"))
+				Expect(supplier.Report.Vendored).To(BeFalse())
+				Expect(supplier.Report.Cache.PackageManager).To(Equal(report.CacheHit))
+				Expect(supplier.Report.Scripts).To(HaveLen(1))
+				Expect(supplier.Report.Scripts[0].Name).To(Equal("heroku-postbuild"))
+				Expect(supplier.Report.Scripts[0].Succeeded).To(BeTrue())
+			})
+
 			It("runs the prebuild script, when prebuild is specified", func() {
 				supplier.PreBuild = "prescriptive"
 				mockNPM.EXPECT().Build(gomock.Any(), gomock.Any()).DoAndReturn(func(string, string) error {
@@ -1154,6 +1746,235 @@ var _ = Describe("Supply", func() {
 				Expect(supplier.BuildDependencies()).To(Succeed())
 				Expect(buffer.String()).To(ContainSubstring("Running heroku-postbuild (npm)"))
 			})
+
+			It("classifies a failing prebuild script as a user script failure", func() {
+				supplier.PreBuild = "prescriptive"
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "heroku-prebuild", "--if-present").Return(errors.New("exit status 2"))
+				err := supplier.BuildDependencies()
+				Expect(err).To(MatchError("exit status 2"))
+				Expect(staging.KindOf(err)).To(Equal(staging.UserScript))
+			})
+		})
+
+		Describe("static site", func() {
+			var oldStaticDir string
+
+			BeforeEach(func() {
+				oldStaticDir = os.Getenv("NODE_STATIC_DIR")
+				Expect(os.Unsetenv("NODE_STATIC_DIR")).To(Succeed())
+				supplier.StaticMode = "serve"
+				supplier.BuildScript = "vite build"
+			})
+
+			AfterEach(func() {
+				Expect(os.Setenv("NODE_STATIC_DIR", oldStaticDir)).To(Succeed())
+			})
+
+			It("runs the build script, finds the output and prunes", func() {
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "build", "--if-present").DoAndReturn(func(string, io.Writer, io.Writer, string, ...string) error {
+						Expect(os.MkdirAll(filepath.Join(buildDir, "dist"), 0755)).To(Succeed())
+						return os.WriteFile(filepath.Join(buildDir, "dist", "index.html"), []byte(""), 0644)
+					}),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Building a static site (NODE_STATIC_MODE=serve)"))
+				Expect(buffer.String()).To(ContainSubstring("Static site output: dist"))
+				Expect(filepath.Join(buildDir, "Staticfile")).NotTo(BeAnExistingFile())
+			})
+
+			It("writes a Staticfile in staticfile mode", func() {
+				supplier.StaticMode = "staticfile"
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "build", "--if-present").DoAndReturn(func(string, io.Writer, io.Writer, string, ...string) error {
+						Expect(os.MkdirAll(filepath.Join(buildDir, "build"), 0755)).To(Succeed())
+						return os.WriteFile(filepath.Join(buildDir, "build", "index.html"), []byte(""), 0644)
+					}),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(os.ReadFile(filepath.Join(buildDir, "Staticfile"))).To(Equal([]byte("root: build\npushstate: enabled\n")))
+			})
+
+			It("fails without a build script", func() {
+				supplier.BuildScript = ""
+				mockNPM.EXPECT().Build(buildDir, cacheDir)
+
+				Expect(supplier.BuildDependencies()).To(MatchError("NODE_STATIC_MODE=serve requires a build script in package.json"))
+			})
+
+			It("fails when the build output cannot be found", func() {
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "build", "--if-present"),
+				)
+
+				Expect(supplier.BuildDependencies()).To(MatchError(ContainSubstring("no index.html found")))
+			})
+		})
+
+		Describe("framework app", func() {
+			BeforeEach(func() {
+				supplier.Framework = framework.Detect(map[string]string{"next": "14.2.3"}, nil)
+			})
+
+			It("restores the build cache, builds, saves the cache and prunes", func() {
+				Expect(os.MkdirAll(filepath.Join(cacheDir, "framework", ".next", "cache", "webpack"), 0755)).To(Succeed())
+
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir).DoAndReturn(func(string, string) error {
+						Expect(os.Getenv("NPM_CONFIG_INCLUDE")).To(Equal("dev"))
+						return nil
+					}),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(buildDir, "node_modules", ".bin", "next"), "build").DoAndReturn(func(string, io.Writer, io.Writer, string, ...string) error {
+						Expect(filepath.Join(buildDir, ".next", "cache", "webpack")).To(BeADirectory())
+						Expect(os.MkdirAll(filepath.Join(buildDir, ".next", "cache", "swc"), 0755)).To(Succeed())
+						return nil
+					}),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Next.js detected"))
+				Expect(buffer.String()).To(ContainSubstring("Running next build (Next.js)"))
+				Expect(filepath.Join(cacheDir, "framework", ".next", "cache", "swc")).To(BeADirectory())
+				Expect(filepath.Join(buildDir, ".next", "cache")).NotTo(BeADirectory())
+			})
+
+			It("prefers the build script", func() {
+				supplier.BuildScript = "next build --no-lint"
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "build", "--if-present"),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
+
+			It("takes precedence over the TypeScript build", func() {
+				supplier.IsTypeScript = true
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(buildDir, "node_modules", ".bin", "next"), "build"),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
+		})
+
+		Describe("TypeScript app", func() {
+			var oldNPMConfigProduction string
+
+			BeforeEach(func() {
+				oldNPMConfigProduction = os.Getenv("NPM_CONFIG_PRODUCTION")
+				Expect(os.Setenv("NPM_CONFIG_PRODUCTION", "true")).To(Succeed())
+				supplier.IsTypeScript = true
+			})
+
+			AfterEach(func() {
+				Expect(os.Setenv("NPM_CONFIG_PRODUCTION", oldNPMConfigProduction)).To(Succeed())
+			})
+
+			It("installs devDependencies, compiles with tsc and prunes", func() {
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir).DoAndReturn(func(string, string) error {
+						Expect(os.Getenv("NPM_CONFIG_PRODUCTION")).To(Equal("false"))
+						Expect(os.Getenv("NPM_CONFIG_INCLUDE")).To(Equal("dev"))
+						return nil
+					}),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(buildDir, "node_modules", ".bin", "tsc"), "--project", "tsconfig.json"),
+					mockNPM.EXPECT().Prune(buildDir).DoAndReturn(func(string) error {
+						Expect(os.Getenv("NPM_CONFIG_PRODUCTION")).To(Equal("true"))
+						_, includeSet := os.LookupEnv("NPM_CONFIG_INCLUDE")
+						Expect(includeSet).To(BeFalse())
+						return nil
+					}),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Compiling TypeScript (tsc)"))
+			})
+
+			It("runs the build script when one is specified", func() {
+				supplier.BuildScript = "tsc -p ."
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "build", "--if-present"),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Running build (npm)"))
+			})
+
+			It("leaves the build to heroku-postbuild when it is specified", func() {
+				supplier.PostBuild = "tsc"
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "run", "heroku-postbuild", "--if-present"),
+					mockNPM.EXPECT().Prune(buildDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
+
+			It("prunes with yarn when using yarn", func() {
+				supplier.UseYarn = true
+				supplier.BuildScript = "tsc"
+				gomock.InOrder(
+					mockYarn.EXPECT().Build(buildDir, cacheDir).DoAndReturn(func(string, string) error {
+						Expect(os.Getenv("YARN_PRODUCTION")).To(Equal("false"))
+						return nil
+					}),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "yarn", "run", "build"),
+					mockYarn.EXPECT().Prune(buildDir, cacheDir),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
+
+			It("keeps devDependencies when NPM_CONFIG_PRODUCTION=false", func() {
+				Expect(os.Setenv("NPM_CONFIG_PRODUCTION", "false")).To(Succeed())
+				gomock.InOrder(
+					mockNPM.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(buildDir, "node_modules", ".bin", "tsc"), "--project", "tsconfig.json"),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Keeping devDependencies, production mode is turned off"))
+				Expect(os.Getenv("NPM_CONFIG_PRODUCTION")).To(Equal("false"))
+			})
+
+			It("keeps devDependencies when YARN_PRODUCTION=false", func() {
+				Expect(os.Setenv("YARN_PRODUCTION", "false")).To(Succeed())
+				defer os.Unsetenv("YARN_PRODUCTION")
+				supplier.UseYarn = true
+				supplier.BuildScript = "tsc"
+				gomock.InOrder(
+					mockYarn.EXPECT().Build(buildDir, cacheDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "yarn", "run", "build"),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Keeping devDependencies"))
+			})
+
+			It("does not prune vendored dependencies", func() {
+				supplier.IsVendored = true
+				gomock.InOrder(
+					mockNPM.EXPECT().Rebuild(buildDir),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), filepath.Join(buildDir, "node_modules", ".bin", "tsc"), "--project", "tsconfig.json"),
+				)
+
+				Expect(supplier.BuildDependencies()).To(Succeed())
+			})
 		})
 	})
 
@@ -1404,8 +2225,8 @@ var _ = Describe("Supply", func() {
 			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "node.sh"))
 			Expect(err).To(BeNil())
 
-			Expect(string(contents)).To(ContainSubstring("export NODE_HOME=" + filepath.Join("$DEPS_DIR", depsIdx, "node")))
-			Expect(string(contents)).To(ContainSubstring("export NODE_ENV=${NODE_ENV:-production}"))
+			Expect(string(contents)).To(ContainSubstring(`export NODE_HOME="` + filepath.Join("$DEPS_DIR", depsIdx, "node") + `"`))
+			Expect(string(contents)).To(ContainSubstring("export NODE_ENV=${NODE_ENV:-'production'}"))
 			nodePathString := `
 if [ ! -d "$HOME/node_modules" ]; then
 	export NODE_PATH=${NODE_PATH:-"$DEPS_DIR/14/node_modules"}
@@ -1416,7 +2237,7 @@ fi
 export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
 `
 			Expect(string(contents)).To(ContainSubstring(nodePathString))
-			Expect(string(contents)).To(Not(ContainSubstring("export SSL_CERT_DIR=${SSL_CERT_DIR:-/etc/ssl/certs}")))
+			Expect(string(contents)).To(Not(ContainSubstring("export SSL_CERT_DIR=${SSL_CERT_DIR:-'/etc/ssl/certs'}")))
 		})
 	})
 
@@ -1481,8 +2302,8 @@ export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
 			contents, err := os.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "node.sh"))
 			Expect(err).To(BeNil())
 
-			Expect(string(contents)).To(ContainSubstring("export NODE_HOME=" + filepath.Join("$DEPS_DIR", depsIdx, "node")))
-			Expect(string(contents)).To(ContainSubstring("export NODE_ENV=${NODE_ENV:-production}"))
+			Expect(string(contents)).To(ContainSubstring(`export NODE_HOME="` + filepath.Join("$DEPS_DIR", depsIdx, "node") + `"`))
+			Expect(string(contents)).To(ContainSubstring("export NODE_ENV=${NODE_ENV:-'production'}"))
 			nodePathString := `
 if [ ! -d "$HOME/node_modules" ]; then
 	export NODE_PATH=${NODE_PATH:-"$DEPS_DIR/14/node_modules"}
@@ -1493,7 +2314,7 @@ fi
 export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
 `
 			Expect(string(contents)).To(ContainSubstring(nodePathString))
-			Expect(string(contents)).To(ContainSubstring("export SSL_CERT_DIR=${SSL_CERT_DIR:-/etc/ssl/certs}"))
+			Expect(string(contents)).To(ContainSubstring("export SSL_CERT_DIR=${SSL_CERT_DIR:-'/etc/ssl/certs'}"))
 		})
 	})
 })
@@ -0,0 +1,91 @@
+package timing
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Env, when true, logs how long each staging step took and prints a summary
+// at the end of the stage. Timings are recorded in the staging report either
+// way.
+const Env = "NODE_STAGING_TIMINGS"
+
+// Timer records the duration of the steps of a stage. The zero value records
+// without logging.
+type Timer struct {
+	Stage   string
+	Log     *libbuildpack.Logger
+	Enabled bool
+	Phases  []report.Phase
+	// Clock replaces time.Now in tests.
+	Clock func() time.Time
+}
+
+func New(stage string, log *libbuildpack.Logger) *Timer {
+	return &Timer{
+		Stage:   stage,
+		Log:     log,
+		Enabled: os.Getenv(Env) == "true",
+	}
+}
+
+// Time runs step and records how long it took, whether or not it failed.
+func (t *Timer) Time(name string, step func() error) error {
+	start := t.clock()
+	err := step()
+	elapsed := t.clock().Sub(start)
+
+	t.Phases = append(t.Phases, report.Phase{
+		Stage:           t.Stage,
+		Name:            name,
+		DurationSeconds: elapsed.Round(time.Millisecond).Seconds(),
+	})
+
+	if t.Enabled {
+		t.Log.Info("%s took %s", name, formatDuration(elapsed))
+	}
+
+	return err
+}
+
+// PrintSummary prints a table of the recorded steps when timings are
+// enabled.
+func (t *Timer) PrintSummary() {
+	if !t.Enabled || len(t.Phases) == 0 {
+		return
+	}
+
+	width := len("Total")
+	for _, phase := range t.Phases {
+		if len(phase.Name) > width {
+			width = len(phase.Name)
+		}
+	}
+
+	var total float64
+	t.Log.BeginStep("Timings (%s)", t.Stage)
+	for _, phase := range t.Phases {
+		total += phase.DurationSeconds
+		t.Log.Info("%-*s %9.3fs", width, phase.Name, phase.DurationSeconds)
+	}
+	t.Log.Info("%-*s %9.3fs", width, "Total", total)
+}
+
+func (t *Timer) clock() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,89 @@
+package timing_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/report"
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/timing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timer", func() {
+	var (
+		buffer *bytes.Buffer
+		timer  *timing.Timer
+		now    time.Time
+	)
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+		timer = timing.New("supply", libbuildpack.NewLogger(ansicleaner.New(buffer)))
+
+		now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		timer.Clock = func() time.Time { return now }
+	})
+
+	step := func(d time.Duration, err error) func() error {
+		return func() error {
+			now = now.Add(d)
+			return err
+		}
+	}
+
+	It("records each step, including failed ones", func() {
+		Expect(timer.Time("Install node", step(1500*time.Millisecond, nil))).To(Succeed())
+		Expect(timer.Time("Build dependencies", step(12*time.Second, errors.New("exit status 1")))).To(MatchError("exit status 1"))
+
+		Expect(timer.Phases).To(Equal([]report.Phase{
+			{Stage: "supply", Name: "Install node", DurationSeconds: 1.5},
+			{Stage: "supply", Name: "Build dependencies", DurationSeconds: 12},
+		}))
+	})
+
+	Context("timings are disabled", func() {
+		It("does not change the log output", func() {
+			Expect(timer.Time("Install node", step(time.Second, nil))).To(Succeed())
+			timer.PrintSummary()
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+
+	Context("NODE_STAGING_TIMINGS=true", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv(timing.Env, "true")).To(Succeed())
+			timer = timing.New("supply", libbuildpack.NewLogger(ansicleaner.New(buffer)))
+			timer.Clock = func() time.Time { return now }
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv(timing.Env)).To(Succeed())
+		})
+
+		It("logs the elapsed time of each step", func() {
+			Expect(timer.Time("Install node", step(1500*time.Millisecond, nil))).To(Succeed())
+			Expect(timer.Time("Install npm", step(250*time.Millisecond, nil))).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring("Install node took 1.5s"))
+			Expect(buffer.String()).To(ContainSubstring("Install npm took 250ms"))
+		})
+
+		It("prints a summary table", func() {
+			Expect(timer.Time("Install node", step(1500*time.Millisecond, nil))).To(Succeed())
+			Expect(timer.Time("Build dependencies", step(12*time.Second, nil))).To(Succeed())
+			buffer.Reset()
+
+			timer.PrintSummary()
+			Expect(buffer.String()).To(Equal("-----> Timings (supply)\n" +
+				"       Install node           1.500s\n" +
+				"       Build dependencies    12.000s\n" +
+				"       Total                 13.500s\n"))
+		})
+	})
+})
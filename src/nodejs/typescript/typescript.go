@@ -0,0 +1,106 @@
+package typescript
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/jsonc"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const ConfigFile = "tsconfig.json"
+
+var defaultEntryPoints = []string{"index.js", "server.js", "main.js", "app.js"}
+
+type Config struct {
+	CompilerOptions struct {
+		OutDir  string `json:"outDir"`
+		RootDir string `json:"rootDir"`
+	} `json:"compilerOptions"`
+}
+
+// IsTypeScriptApp reports whether the app ships a tsconfig.json and depends
+// on the typescript compiler.
+func IsTypeScriptApp(buildDir string, devDependencies map[string]string) (bool, error) {
+	if _, ok := devDependencies["typescript"]; !ok {
+		return false, nil
+	}
+
+	return libbuildpack.FileExists(filepath.Join(buildDir, ConfigFile))
+}
+
+// LoadConfig reads a tsconfig.json. The file is parsed leniently, as tsc
+// itself accepts comments and trailing commas.
+func LoadConfig(buildDir string) (Config, error) {
+	var c Config
+
+	contents, err := os.ReadFile(filepath.Join(buildDir, ConfigFile))
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := json.Unmarshal(jsonc.Strip(contents), &c); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// EntryPoint returns the path, relative to buildDir, of the compiled
+// JavaScript file that should be used to start the app. It returns an empty
+// string when no emitted entry point can be found.
+func (c Config) EntryPoint(buildDir, main string) (string, error) {
+	outDir := path.Clean(filepath.ToSlash(c.CompilerOptions.OutDir))
+	rootDir := path.Clean(filepath.ToSlash(c.CompilerOptions.RootDir))
+
+	var candidates []string
+
+	if main != "" {
+		main = path.Clean(filepath.ToSlash(main))
+		emitted := emittedName(main)
+
+		if rel := strings.TrimPrefix(emitted, rootDir+"/"); rootDir != "." && rel != emitted {
+			candidates = append(candidates, path.Join(outDir, rel))
+		}
+
+		if strings.HasPrefix(emitted, outDir+"/") {
+			candidates = append(candidates, emitted)
+		}
+
+		candidates = append(candidates, path.Join(outDir, emitted), path.Join(outDir, path.Base(emitted)))
+	}
+
+	for _, name := range defaultEntryPoints {
+		candidates = append(candidates, path.Join(outDir, name))
+	}
+
+	for _, candidate := range candidates {
+		if exists, err := libbuildpack.FileExists(filepath.Join(buildDir, filepath.FromSlash(candidate))); err != nil {
+			return "", err
+		} else if exists {
+			return candidate, nil
+		}
+	}
+
+	return "", nil
+}
+
+func emittedName(source string) string {
+	replacements := map[string]string{
+		".ts":  ".js",
+		".tsx": ".js",
+		".mts": ".mjs",
+		".cts": ".cjs",
+	}
+
+	ext := path.Ext(source)
+	if replacement, ok := replacements[ext]; ok {
+		return strings.TrimSuffix(source, ext) + replacement
+	}
+
+	return source
+}
@@ -0,0 +1,13 @@
+package typescript_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTypeScript(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TypeScript Suite")
+}
@@ -0,0 +1,107 @@
+package typescript_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/typescript"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TypeScript", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = os.MkdirTemp("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	Describe("IsTypeScriptApp", func() {
+		Context("tsconfig.json exists and typescript is a devDependency", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte("{}"), 0644)).To(Succeed())
+			})
+
+			It("returns true", func() {
+				Expect(typescript.IsTypeScriptApp(buildDir, map[string]string{"typescript": "^5.4.0"})).To(BeTrue())
+			})
+
+			It("returns false without the typescript devDependency", func() {
+				Expect(typescript.IsTypeScriptApp(buildDir, map[string]string{"jest": "^29.0.0"})).To(BeFalse())
+			})
+		})
+
+		Context("tsconfig.json does not exist", func() {
+			It("returns false", func() {
+				Expect(typescript.IsTypeScriptApp(buildDir, map[string]string{"typescript": "^5.4.0"})).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("LoadConfig", func() {
+		It("accepts comments and trailing commas", func() {
+			tsconfig := `{
+  // emitted output
+  "compilerOptions": {
+    /* keep sources separate */
+    "rootDir": "src",
+    "outDir": "build/out", // relative to tsconfig.json
+    "lib": ["es2022",],
+    "paths": {"@app/*": ["src/*"]},
+  },
+}`
+			Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte(tsconfig), 0644)).To(Succeed())
+
+			config, err := typescript.LoadConfig(buildDir)
+			Expect(err).To(BeNil())
+			Expect(config.CompilerOptions.OutDir).To(Equal("build/out"))
+			Expect(config.CompilerOptions.RootDir).To(Equal("src"))
+		})
+
+		It("returns an error for malformed files", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "tsconfig.json"), []byte("{not json"), 0644)).To(Succeed())
+
+			_, err := typescript.LoadConfig(buildDir)
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("EntryPoint", func() {
+		var config typescript.Config
+
+		BeforeEach(func() {
+			config = typescript.Config{}
+			config.CompilerOptions.OutDir = "dist"
+			config.CompilerOptions.RootDir = "src"
+			Expect(os.MkdirAll(filepath.Join(buildDir, "dist"), 0755)).To(Succeed())
+		})
+
+		It("maps a TypeScript main through rootDir into outDir", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "dist", "app.js"), []byte(""), 0644)).To(Succeed())
+			Expect(config.EntryPoint(buildDir, "src/app.ts")).To(Equal("dist/app.js"))
+		})
+
+		It("keeps a main that already points into outDir", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "dist", "server.mjs"), []byte(""), 0644)).To(Succeed())
+			Expect(config.EntryPoint(buildDir, "./dist/server.mjs")).To(Equal("dist/server.mjs"))
+		})
+
+		It("falls back to a conventional entry point in outDir", func() {
+			Expect(os.WriteFile(filepath.Join(buildDir, "dist", "index.js"), []byte(""), 0644)).To(Succeed())
+			Expect(config.EntryPoint(buildDir, "")).To(Equal("dist/index.js"))
+		})
+
+		It("returns an empty string when nothing was emitted", func() {
+			Expect(config.EntryPoint(buildDir, "src/app.ts")).To(Equal(""))
+		})
+	})
+})
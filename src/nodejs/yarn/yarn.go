@@ -6,6 +6,8 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
+
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -17,6 +19,7 @@ type Command interface {
 type Yarn struct {
 	Command Command
 	Log     *libbuildpack.Logger
+	Retry   retry.Policy
 }
 
 func (y *Yarn) Build(buildDir, cacheDir string) error {
@@ -57,12 +60,15 @@ func (y *Yarn) Build(buildDir, cacheDir string) error {
 		}
 	}
 
-	cmd := exec.Command("yarn", installArgs...)
-	cmd.Dir = buildDir
-	cmd.Stdout = y.Log.Output()
-	cmd.Stderr = y.Log.Output()
-	cmd.Env = append(os.Environ(), "npm_config_nodedir="+os.Getenv("NODE_HOME"))
-	if err := y.Command.Run(cmd); err != nil {
+	err = y.Retry.Do(y.Log, "yarn install", func(out io.Writer) error {
+		cmd := exec.Command("yarn", installArgs...)
+		cmd.Dir = buildDir
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = append(os.Environ(), "npm_config_nodedir="+os.Getenv("NODE_HOME"))
+		return y.Command.Run(cmd)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -73,3 +79,16 @@ func (y *Yarn) Build(buildDir, cacheDir string) error {
 
 	return nil
 }
+
+func (y *Yarn) Prune(buildDir, cacheDir string) error {
+	y.Log.Info("Pruning devDependencies")
+
+	installArgs := []string{"install", "--pure-lockfile", "--ignore-engines", "--production=true", "--ignore-scripts", "--prefer-offline", "--cache-folder", filepath.Join(cacheDir, ".cache/yarn")}
+
+	cmd := exec.Command("yarn", installArgs...)
+	cmd.Dir = buildDir
+	cmd.Stdout = y.Log.Output()
+	cmd.Stderr = y.Log.Output()
+	cmd.Env = append(os.Environ(), "npm_config_nodedir="+os.Getenv("NODE_HOME"))
+	return y.Command.Run(cmd)
+}
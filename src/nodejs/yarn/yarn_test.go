@@ -2,10 +2,14 @@ package yarn_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
+	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/retry"
 	"github.com/cloudfoundry/nodejs-buildpack/src/nodejs/yarn"
 
 	"github.com/cloudfoundry/libbuildpack"
@@ -144,4 +148,86 @@ var _ = Describe("Yarn", func() {
 			})
 		})
 	})
+
+	Describe("Build with a flaky registry", func() {
+		var sleeps int
+
+		BeforeEach(func() {
+			sleeps = 0
+			y.Retry = retry.Policy{Retries: 2, Delay: time.Second, Sleep: func(time.Duration) { sleeps++ }}
+		})
+
+		It("retries yarn install after a network error", func() {
+			installs := 0
+			mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+				if cmd.Args[1] != "install" {
+					return nil
+				}
+
+				installs++
+				Expect(cmd.Args).To(ContainElement(filepath.Join(cacheDir, ".cache/yarn")))
+				if installs == 1 {
+					fmt.Fprintln(cmd.Stdout, "info There appears to be trouble with your network connection. Retrying...")
+					fmt.Fprintln(cmd.Stdout, `error An unexpected error occurred: "https://registry.yarnpkg.com/left-pad: ESOCKETTIMEDOUT".`)
+					return errors.New("exit status 1")
+				}
+				return nil
+			}).AnyTimes()
+
+			Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(installs).To(Equal(2))
+			Expect(sleeps).To(Equal(1))
+			Expect(buffer.String()).To(ContainSubstring("yarn install failed with a network error, retrying in 1s (attempt 2 of 3)"))
+		})
+
+		It("does not retry other failures", func() {
+			installs := 0
+			mockCommand.EXPECT().Run(gomock.Any()).DoAndReturn(func(cmd *exec.Cmd) error {
+				if cmd.Args[1] != "install" {
+					return nil
+				}
+
+				installs++
+				fmt.Fprintln(cmd.Stdout, `error Couldn't find any versions for "left-pad" that matches "99.0.0"`)
+				return errors.New("exit status 1")
+			}).AnyTimes()
+
+			Expect(y.Build(buildDir, cacheDir)).To(MatchError("exit status 1"))
+			Expect(installs).To(Equal(1))
+			Expect(sleeps).To(BeZero())
+		})
+	})
+
+	Describe("Prune", func() {
+		var oldNodeHome string
+
+		BeforeEach(func() {
+			oldNodeHome = os.Getenv("NODE_HOME")
+			Expect(os.Setenv("NODE_HOME", "test_node_home")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_HOME", oldNodeHome)).To(Succeed())
+		})
+
+		It("reinstalls production dependencies only", func() {
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) error {
+				Expect(cmd.Dir).To(Equal(buildDir))
+				Expect(cmd.Env).To(ContainElement("npm_config_nodedir=test_node_home"))
+				Expect(cmd.Args).To(Equal([]string{
+					"yarn", "install",
+					"--pure-lockfile",
+					"--ignore-engines",
+					"--production=true",
+					"--ignore-scripts",
+					"--prefer-offline",
+					"--cache-folder", filepath.Join(cacheDir, ".cache/yarn"),
+				}))
+				return nil
+			})
+
+			Expect(y.Prune(buildDir, cacheDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies"))
+		})
+	})
 })
@@ -0,0 +1,170 @@
+'use strict';
+
+// Minimal static file server for single-page apps built by the Node.js
+// buildpack (NODE_STATIC_MODE=serve). It has no dependencies beyond node.
+//
+//   node server.js <root-dir>
+
+const fs = require('fs');
+const http = require('http');
+const path = require('path');
+const zlib = require('zlib');
+
+const root = path.resolve(process.argv[2] || '.');
+const port = parseInt(process.env.PORT || '8080', 10);
+const host = process.env.HOST || '0.0.0.0';
+const fallback = process.env.NODE_STATIC_FALLBACK !== 'false';
+
+const types = {
+  '.css': 'text/css; charset=utf-8',
+  '.csv': 'text/csv; charset=utf-8',
+  '.gif': 'image/gif',
+  '.htm': 'text/html; charset=utf-8',
+  '.html': 'text/html; charset=utf-8',
+  '.ico': 'image/x-icon',
+  '.jpeg': 'image/jpeg',
+  '.jpg': 'image/jpeg',
+  '.js': 'text/javascript; charset=utf-8',
+  '.json': 'application/json; charset=utf-8',
+  '.map': 'application/json; charset=utf-8',
+  '.mjs': 'text/javascript; charset=utf-8',
+  '.png': 'image/png',
+  '.svg': 'image/svg+xml',
+  '.txt': 'text/plain; charset=utf-8',
+  '.wasm': 'application/wasm',
+  '.webmanifest': 'application/manifest+json',
+  '.webp': 'image/webp',
+  '.woff': 'font/woff',
+  '.woff2': 'font/woff2',
+  '.xml': 'application/xml; charset=utf-8',
+};
+
+const compressible = /^(text\/|application\/(json|javascript|xml|manifest\+json)|image\/svg\+xml)/;
+
+// Bundlers put a content hash in the names of emitted assets, e.g.
+// main.3f2a9c1b.js or index-B5kZ3x9q.css, so those never change.
+const fingerprinted = /[.-][0-9a-zA-Z_-]{8,}\.[a-z0-9]+$/;
+
+function cacheControl(file) {
+  if (path.extname(file) === '.html') {
+    return 'no-cache';
+  }
+  if (fingerprinted.test(path.basename(file))) {
+    return 'public, max-age=31536000, immutable';
+  }
+  return 'public, max-age=3600';
+}
+
+function resolve(urlPath) {
+  let decoded;
+  try {
+    decoded = decodeURIComponent(urlPath.split('?')[0]);
+  } catch (e) {
+    return null;
+  }
+
+  const file = path.join(root, path.normalize(decoded));
+  if (file !== root && !file.startsWith(root + path.sep)) {
+    return null;
+  }
+  return file;
+}
+
+function stat(file) {
+  try {
+    const s = fs.statSync(file);
+    if (s.isDirectory()) {
+      return stat(path.join(file, 'index.html'));
+    }
+    return { file, size: s.size, mtime: s.mtime };
+  } catch (e) {
+    return null;
+  }
+}
+
+function send(req, res, found, status) {
+  const type = types[path.extname(found.file)] || 'application/octet-stream';
+  const headers = {
+    'Content-Type': type,
+    'Cache-Control': cacheControl(found.file),
+    'Last-Modified': found.mtime.toUTCString(),
+    'X-Content-Type-Options': 'nosniff',
+    'Vary': 'Accept-Encoding',
+  };
+
+  if (req.headers['if-modified-since'] && new Date(req.headers['if-modified-since']) >= new Date(found.mtime.toUTCString())) {
+    res.writeHead(304, headers);
+    res.end();
+    return;
+  }
+
+  const gzip = compressible.test(type) && /\bgzip\b/.test(req.headers['accept-encoding'] || '');
+
+  if (gzip) {
+    headers['Content-Encoding'] = 'gzip';
+  } else {
+    headers['Content-Length'] = found.size;
+  }
+
+  if (req.method === 'HEAD') {
+    res.writeHead(status, headers);
+    res.end();
+    return;
+  }
+
+  const stream = fs.createReadStream(found.file);
+  res.on('close', () => stream.destroy());
+  stream.on('open', () => {
+    res.writeHead(status, headers);
+    (gzip ? stream.pipe(zlib.createGzip()) : stream).pipe(res);
+  });
+  stream.on('error', () => {
+    if (res.headersSent) {
+      res.destroy();
+      return;
+    }
+    res.writeHead(500);
+    res.end();
+  });
+}
+
+const server = http.createServer((req, res) => {
+  if (req.method !== 'GET' && req.method !== 'HEAD') {
+    res.writeHead(405, { 'Allow': 'GET, HEAD' });
+    res.end();
+    return;
+  }
+
+  const file = resolve(req.url);
+  if (file === null) {
+    res.writeHead(400);
+    res.end();
+    return;
+  }
+
+  const found = stat(file);
+  if (found) {
+    send(req, res, found, 200);
+    return;
+  }
+
+  // Client-side routes have no file on disk; hand them to the app shell.
+  const index = fallback && path.extname(file) === '' ? stat(path.join(root, 'index.html')) : null;
+  if (index) {
+    send(req, res, index, 200);
+    return;
+  }
+
+  const notFound = stat(path.join(root, '404.html'));
+  if (notFound) {
+    send(req, res, notFound, 404);
+    return;
+  }
+
+  res.writeHead(404, { 'Content-Type': 'text/plain; charset=utf-8' });
+  res.end('Not Found');
+});
+
+server.listen(port, host, () => {
+  console.log(`Serving ${root} on ${host}:${port}`);
+});